@@ -16,6 +16,7 @@ import (
 	"syscall"
 
 	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/glob"
 	"github.com/Moonlight-Companies/goresp/logging"
 )
 
@@ -30,13 +31,14 @@ func main() {
 
 	reconn := connection.NewReconnecting(*redisAddr)
 
+	var subs []*connection.TypedSubscription[map[string]interface{}]
 	for _, channel := range channels {
 		channel = strings.TrimSpace(channel)
-		if strings.Contains(channel, "*") {
-			reconn.PSubscribe(channel)
+		sub := connection.SubscribeJSON[map[string]interface{}](reconn, channel)
+		subs = append(subs, sub)
+		if glob.IsPattern(channel) {
 			log.Infoln("PSubscribed to channel", channel)
 		} else {
-			reconn.Subscribe(channel)
 			log.Infoln("Subscribed to channel", channel)
 		}
 	}
@@ -47,22 +49,28 @@ func main() {
 	log.Infoln("Connected to Redis", *redisAddr)
 	log.Infoln("Waiting for messages. Press Ctrl+C to exit.")
 
-	go func() {
-		for msg := range reconn.Messages {
-			temp, err := msg.IntoMap()
-			if err != nil {
-				log.Errorln("Error parsing message", err)
-				continue
+	for _, sub := range subs {
+		go func(sub *connection.TypedSubscription[map[string]interface{}]) {
+			for typed := range sub.Values() {
+				msg := typed.Message
+				if typed.Err != nil {
+					// not JSON, show the payload as it is
+					log.Warn("Channel: %s, Pattern: %s, Raw message (%v): %q\n", msg.Channel, msg.Pattern, typed.Err, msg.Data)
+					continue
+				}
+				log.Info("Channel: %s, Pattern: %s, Message: %v\n", msg.Channel, msg.Pattern, typed.Value)
 			}
-			log.Info("Channel: %s, Pattern: %s, Message: %v\n", msg.Channel, msg.Pattern, temp)
-		}
-	}()
+		}(sub)
+	}
 
 	// Wait for shutdown signal
 	<-shutdown
 
 	// Perform cleanup
 	log.Infoln("Calling .Close...")
+	for _, sub := range subs {
+		sub.Close()
+	}
 	reconn.Close()
 	log.Infoln("Done!")
 }
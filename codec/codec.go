@@ -0,0 +1,137 @@
+// Package codec converts Go values to and from bus message payloads
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Codec marshals values into payloads and back
+type Codec interface {
+	// Name identifies the codec in the registry, in lower case
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON is encoding/json, the default for channels without a codec
+	JSON Codec = jsonCodec{}
+	// Raw passes []byte and string payloads through untouched
+	Raw Codec = rawCodec{}
+	// MsgPack is MessagePack, see MsgPack for the supported types
+	MsgPack Codec = msgpackCodec{}
+	// Gob is encoding/gob, one self describing stream per payload
+	Gob Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "raw" }
+
+// Marshal accepts []byte and string, and types based on them
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case !rv.IsValid():
+		return nil, nil
+	case rv.Kind() == reflect.String:
+		return []byte(rv.String()), nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		return rv.Bytes(), nil
+	}
+	return nil, fmt.Errorf("codec: raw cannot marshal %T", v)
+}
+
+// Unmarshal accepts pointers to []byte, string or an empty interface, which receives a []byte.
+// The payload is copied
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("codec: raw cannot unmarshal into %T", v)
+	}
+
+	target := rv.Elem()
+	switch {
+	case target.Kind() == reflect.String:
+		target.SetString(string(data))
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8:
+		target.SetBytes(append([]byte(nil), data...))
+	case target.Kind() == reflect.Interface && target.NumMethod() == 0:
+		target.Set(reflect.ValueOf(append([]byte(nil), data...)))
+	default:
+		return fmt.Errorf("codec: raw cannot unmarshal into %T", v)
+	}
+	return nil
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	namesMutex sync.RWMutex
+	names      = map[string]Codec{}
+)
+
+func init() {
+	for _, c := range []Codec{JSON, Raw, MsgPack, Gob} {
+		Register(c)
+	}
+}
+
+// Register makes a codec available by name, replacing one registered under the same name.
+// The built in codecs are registered already
+func Register(c Codec) {
+	namesMutex.Lock()
+	defer namesMutex.Unlock()
+
+	names[c.Name()] = c
+}
+
+// Get returns the codec registered under name
+func Get(name string) (Codec, bool) {
+	namesMutex.RLock()
+	defer namesMutex.RUnlock()
+
+	c, ok := names[name]
+	return c, ok
+}
+
+// Names returns the names of the registered codecs, sorted
+func Names() []string {
+	namesMutex.RLock()
+	defer namesMutex.RUnlock()
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,656 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxMsgpackDepth bounds nesting so a hostile payload cannot exhaust the stack
+const maxMsgpackDepth = 1000
+
+var (
+	errMsgpackTruncated = errors.New("msgpack: unexpected end of data")
+	errMsgpackTrailing  = errors.New("msgpack: trailing data after value")
+	errMsgpackDepth     = errors.New("msgpack: nesting too deep")
+
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// msgpackCodec encodes nil, bools, integers, floats, strings, []byte, time.Time (as the
+// timestamp extension), slices, arrays, maps, pointers and structs. Structs are maps keyed by
+// field name or a `msgpack:"name"` tag, "-" skips a field and ",omitempty" drops zero values.
+//
+// Decoding into an empty interface yields nil, bool, int64 (uint64 above math.MaxInt64),
+// float64, string, []byte, time.Time, []interface{} and map[string]interface{}, or
+// map[interface{}]interface{} when a key is not a string
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v))
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: cannot unmarshal into %T", v)
+	}
+
+	d := msgpackDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errMsgpackTrailing
+	}
+	return assignMsgpack(rv.Elem(), value)
+}
+
+func appendMsgpack(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(b, 0xc0), nil
+	}
+	if v.Type() == timeType {
+		return appendTimestamp(b, v.Interface().(time.Time)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		return appendMsgpack(b, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUint(b, v.Uint()), nil
+	case reflect.Float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendString(b, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendBinary(b, v.Bytes()), nil
+		}
+		return appendArray(b, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			raw := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(raw), v)
+			return appendBinary(b, raw), nil
+		}
+		return appendArray(b, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		return appendMap(b, v)
+	case reflect.Struct:
+		return appendStruct(b, v)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type %s", v.Type())
+}
+
+func appendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(int8(i)))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(i)))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+func appendUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+}
+
+// appendHeader appends the smallest of a fix format (when fixMax allows), an 8 bit, a 16 bit
+// or a 32 bit length. A zero code8 means the type has no 8 bit form
+func appendHeader(b []byte, n int, fix byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(b, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendHeader(b, len(s), 0xa0, 31, 0xd9, 0xda, 0xdb)
+	return append(b, s...)
+}
+
+func appendBinary(b []byte, raw []byte) []byte {
+	b = appendHeader(b, len(raw), 0, -1, 0xc4, 0xc5, 0xc6)
+	return append(b, raw...)
+}
+
+func appendArray(b []byte, v reflect.Value) ([]byte, error) {
+	b = appendHeader(b, v.Len(), 0x90, 15, 0, 0xdc, 0xdd)
+	for i := 0; i < v.Len(); i++ {
+		var err error
+		if b, err = appendMsgpack(b, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendMap(b []byte, v reflect.Value) ([]byte, error) {
+	keys := v.MapKeys()
+	if v.Type().Key().Kind() == reflect.String {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	}
+
+	b = appendHeader(b, len(keys), 0x80, 15, 0, 0xde, 0xdf)
+	for _, key := range keys {
+		var err error
+		if b, err = appendMsgpack(b, key); err != nil {
+			return nil, err
+		}
+		if b, err = appendMsgpack(b, v.MapIndex(key)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	fields := msgpackFields(v.Type())
+	present := fields[:0:0]
+	for _, field := range fields {
+		if field.omitEmpty && v.Field(field.index).IsZero() {
+			continue
+		}
+		present = append(present, field)
+	}
+
+	b = appendHeader(b, len(present), 0x80, 15, 0, 0xde, 0xdf)
+	for _, field := range present {
+		var err error
+		b = appendString(b, field.name)
+		if b, err = appendMsgpack(b, v.Field(field.index)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendTimestamp uses the smallest of the three timestamp extension formats
+func appendTimestamp(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	if uint64(sec)>>34 == 0 {
+		data64 := nsec<<34 | uint64(sec)
+		if data64>>32 == 0 {
+			return binary.BigEndian.AppendUint32(append(b, 0xd6, 0xff), uint32(data64))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xd7, 0xff), data64)
+	}
+	b = binary.BigEndian.AppendUint32(append(b, 0xc7, 12, 0xff), uint32(nsec))
+	return binary.BigEndian.AppendUint64(b, uint64(sec))
+}
+
+type msgpackField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func msgpackFields(t reflect.Type) []msgpackField {
+	fields := make([]msgpackField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(f.Tag.Get("msgpack"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, msgpackField{name: name, index: i, omitEmpty: options == "omitempty"})
+	}
+	return fields
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// length reads an n byte length, lengths that cannot fit the remaining data are truncation
+func (d *msgpackDecoder) length(n int) (int, error) {
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.data)-d.pos) {
+		return 0, errMsgpackTruncated
+	}
+	return int(u), nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errMsgpackDepth
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.string(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return d.mapping(int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(n)
+		return append([]byte(nil), raw...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.extension(n)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// sign extend from the top bit of the encoded size
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.extension(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.string(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapping(n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: invalid code 0x%02x", c)
+}
+
+func (d *msgpackDecoder) string(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (interface{}, error) {
+	items := make([]interface{}, n)
+	for i := range items {
+		var err error
+		if items[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) mapping(n int, depth int) (interface{}, error) {
+	keys := make([]interface{}, n)
+	values := make([]interface{}, n)
+	stringKeys := true
+	for i := 0; i < n; i++ {
+		var err error
+		if keys[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+		if values[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+
+		switch key := keys[i].(type) {
+		case string:
+		case []byte:
+			keys[i] = string(key)
+			stringKeys = false
+		case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+			return nil, fmt.Errorf("msgpack: unhashable map key of type %T", key)
+		default:
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		m := make(map[string]interface{}, n)
+		for i, key := range keys {
+			m[key.(string)] = values[i]
+		}
+		return m, nil
+	}
+
+	m := make(map[interface{}]interface{}, n)
+	for i, key := range keys {
+		m[key] = values[i]
+	}
+	return m, nil
+}
+
+// extension reads the type and n bytes of data, only timestamps (-1) are understood
+func (d *msgpackDecoder) extension(n int) (interface{}, error) {
+	header, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind := int8(header[0]); kind != -1 {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", kind)
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		data64 := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(data64&0x3ffffffff), int64(data64>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+}
+
+// assignMsgpack stores a decoded value in dst, converting between compatible types
+func assignMsgpack(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignMsgpack(dst.Elem(), src)
+	case reflect.Interface:
+		value := reflect.ValueOf(src)
+		if !value.Type().AssignableTo(dst.Type()) {
+			return msgpackMismatch(src, dst.Type())
+		}
+		dst.Set(value)
+		return nil
+	}
+
+	switch s := src.(type) {
+	case bool:
+		if dst.Kind() == reflect.Bool {
+			dst.SetBool(s)
+			return nil
+		}
+	case int64:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !dst.OverflowInt(s) {
+				dst.SetInt(s)
+				return nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if s >= 0 && !dst.OverflowUint(uint64(s)) {
+				dst.SetUint(uint64(s))
+				return nil
+			}
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(s))
+			return nil
+		}
+	case uint64:
+		switch dst.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if !dst.OverflowUint(s) {
+				dst.SetUint(s)
+				return nil
+			}
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(s))
+			return nil
+		}
+	case float64:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(s)
+			return nil
+		}
+	case string:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(s)
+			return nil
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes([]byte(s))
+			return nil
+		}
+	case []byte:
+		switch {
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes(s)
+			return nil
+		case dst.Kind() == reflect.Array && dst.Type().Elem().Kind() == reflect.Uint8 && len(s) == dst.Len():
+			reflect.Copy(dst, reflect.ValueOf(s))
+			return nil
+		case dst.Kind() == reflect.String:
+			dst.SetString(string(s))
+			return nil
+		}
+	case time.Time:
+		if dst.Type() == timeType {
+			dst.Set(reflect.ValueOf(s))
+			return nil
+		}
+	case []interface{}:
+		return assignArray(dst, s)
+	case map[string]interface{}:
+		if dst.Kind() == reflect.Struct {
+			return assignStruct(dst, s)
+		}
+		generic := make(map[interface{}]interface{}, len(s))
+		for key, value := range s {
+			generic[key] = value
+		}
+		return assignMap(dst, generic)
+	case map[interface{}]interface{}:
+		return assignMap(dst, s)
+	}
+	return msgpackMismatch(src, dst.Type())
+}
+
+func assignArray(dst reflect.Value, items []interface{}) error {
+	switch dst.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignMsgpack(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(items) > dst.Len() {
+			return msgpackMismatch(items, dst.Type())
+		}
+		for i := 0; i < dst.Len(); i++ {
+			if i >= len(items) {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+				continue
+			}
+			if err := assignMsgpack(dst.Index(i), items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return msgpackMismatch(items, dst.Type())
+}
+
+func assignMap(dst reflect.Value, m map[interface{}]interface{}) error {
+	if dst.Kind() != reflect.Map {
+		return msgpackMismatch(m, dst.Type())
+	}
+
+	result := reflect.MakeMapWithSize(dst.Type(), len(m))
+	for key, value := range m {
+		k := reflect.New(dst.Type().Key()).Elem()
+		if err := assignMsgpack(k, key); err != nil {
+			return err
+		}
+		v := reflect.New(dst.Type().Elem()).Elem()
+		if err := assignMsgpack(v, value); err != nil {
+			return err
+		}
+		result.SetMapIndex(k, v)
+	}
+	dst.Set(result)
+	return nil
+}
+
+// assignStruct matches keys to field names exactly, then ignoring case. Unknown keys are skipped
+func assignStruct(dst reflect.Value, m map[string]interface{}) error {
+	fields := msgpackFields(dst.Type())
+	for key, value := range m {
+		index := -1
+		for _, field := range fields {
+			if field.name == key {
+				index = field.index
+				break
+			}
+			if index < 0 && strings.EqualFold(field.name, key) {
+				index = field.index
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		if err := assignMsgpack(dst.Field(index), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func msgpackMismatch(src interface{}, t reflect.Type) error {
+	return fmt.Errorf("msgpack: cannot unmarshal %T into Go value of type %s", src, t)
+}
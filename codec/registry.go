@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"sync"
+
+	"github.com/Moonlight-Companies/goresp/glob"
+)
+
+type patternCodec struct {
+	pattern string
+	codec   Codec
+}
+
+// Registry chooses the codec of a channel. Channels are looked up exactly first, then against
+// patterns in the order they were set, and fall back to the default codec
+type Registry struct {
+	mutex    sync.RWMutex
+	fallback Codec
+	channels map[string]Codec
+	patterns []patternCodec
+}
+
+// NewRegistry returns a Registry using fallback for unknown channels, JSON when it is nil
+func NewRegistry(fallback Codec) *Registry {
+	if fallback == nil {
+		fallback = JSON
+	}
+	return &Registry{
+		fallback: fallback,
+		channels: make(map[string]Codec),
+	}
+}
+
+// Set chooses the codec for a channel, or for every channel matching channelOrPattern when it
+// contains glob syntax. A nil codec removes the choice
+func (reg *Registry) Set(channelOrPattern string, c Codec) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	if !glob.IsPattern(channelOrPattern) {
+		if c == nil {
+			delete(reg.channels, channelOrPattern)
+		} else {
+			reg.channels[channelOrPattern] = c
+		}
+		return
+	}
+
+	for i, entry := range reg.patterns {
+		if entry.pattern != channelOrPattern {
+			continue
+		}
+		if c == nil {
+			reg.patterns = append(reg.patterns[:i], reg.patterns[i+1:]...)
+		} else {
+			reg.patterns[i].codec = c
+		}
+		return
+	}
+	if c != nil {
+		reg.patterns = append(reg.patterns, patternCodec{pattern: channelOrPattern, codec: c})
+	}
+}
+
+// For returns the codec of channel
+func (reg *Registry) For(channel string) Codec {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	if c, ok := reg.channels[channel]; ok {
+		return c
+	}
+	for _, entry := range reg.patterns {
+		if glob.Match(entry.pattern, channel) {
+			return entry.codec
+		}
+	}
+	return reg.fallback
+}
@@ -0,0 +1,100 @@
+package codec_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+)
+
+func TestCodecRoundTrips(t *testing.T) {
+	type event struct {
+		Name  string
+		Count int
+	}
+	in := event{Name: "login", Count: 3}
+
+	for _, c := range []codec.Codec{codec.JSON, codec.MsgPack, codec.Gob} {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(in)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var out event
+			if err := c.Unmarshal(data, &out); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if out != in {
+				t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	data, err := codec.Raw.Marshal("payload")
+	if err != nil || string(data) != "payload" {
+		t.Fatalf("Marshal(string) = %q, %v", data, err)
+	}
+	if data, _ = codec.Raw.Marshal([]byte{1, 2}); !reflect.DeepEqual(data, []byte{1, 2}) {
+		t.Errorf("Marshal([]byte) = %v", data)
+	}
+	if _, err := codec.Raw.Marshal(1); err == nil {
+		t.Errorf("Marshal(int) did not fail")
+	}
+
+	var s string
+	if err := codec.Raw.Unmarshal([]byte("text"), &s); err != nil || s != "text" {
+		t.Errorf("Unmarshal(*string) = %q, %v", s, err)
+	}
+	var any interface{}
+	if err := codec.Raw.Unmarshal([]byte{7}, &any); err != nil || !reflect.DeepEqual(any, []byte{7}) {
+		t.Errorf("Unmarshal(*interface{}) = %v, %v", any, err)
+	}
+	var m map[string]interface{}
+	if err := codec.Raw.Unmarshal([]byte("{}"), &m); err == nil {
+		t.Errorf("Unmarshal(*map) did not fail")
+	}
+}
+
+func TestCodecNames(t *testing.T) {
+	if got, want := codec.Names(), []string{"gob", "json", "msgpack", "raw"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if c, ok := codec.Get("msgpack"); !ok || c != codec.MsgPack {
+		t.Errorf("Get(msgpack) = %v, %v", c, ok)
+	}
+	if _, ok := codec.Get("protobuf"); ok {
+		t.Errorf("Get(protobuf) found a codec")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := codec.NewRegistry(nil)
+	reg.Set("metrics.*", codec.MsgPack)
+	reg.Set("metrics.raw", codec.Raw)
+	reg.Set("*", codec.Gob)
+
+	tests := []struct {
+		channel string
+		want    codec.Codec
+	}{
+		{"metrics.raw", codec.Raw},
+		{"metrics.cpu", codec.MsgPack},
+		{"orders", codec.Gob},
+	}
+	for _, tt := range tests {
+		if got := reg.For(tt.channel); got != tt.want {
+			t.Errorf("For(%q) = %s, want %s", tt.channel, got.Name(), tt.want.Name())
+		}
+	}
+
+	reg.Set("*", nil)
+	reg.Set("metrics.raw", nil)
+	if got := reg.For("orders"); got != codec.JSON {
+		t.Errorf("For(orders) = %s after removing *, want json", got.Name())
+	}
+	if got := reg.For("metrics.raw"); got != codec.MsgPack {
+		t.Errorf("For(metrics.raw) = %s after removing it, want msgpack", got.Name())
+	}
+}
@@ -0,0 +1,243 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+)
+
+func TestMsgPackEncoding(t *testing.T) {
+	type tagged struct {
+		A int    `msgpack:"a"`
+		B string `msgpack:",omitempty"`
+		C bool   `msgpack:"-"`
+	}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, "c0"},
+		{"false", false, "c2"},
+		{"true", true, "c3"},
+		{"positive fixint", 1, "01"},
+		{"negative fixint", -1, "ff"},
+		{"int8", -33, "d0df"},
+		{"int16", -129, "d1ff7f"},
+		{"int32", -32769, "d2ffff7fff"},
+		{"int64", -2147483649, "d3ffffffff7fffffff"},
+		{"uint8", 128, "cc80"},
+		{"uint16", 256, "cd0100"},
+		{"uint32", 65536, "ce00010000"},
+		{"uint64", uint64(1) << 32, "cf0000000100000000"},
+		{"float32", float32(1.5), "ca3fc00000"},
+		{"float64", 1.5, "cb3ff8000000000000"},
+		{"fixstr", "a", "a161"},
+		{"str8", strings.Repeat("x", 32), "d920" + strings.Repeat("78", 32)},
+		{"bin8", []byte{1, 2}, "c4020102"},
+		{"byte array", [2]byte{1, 2}, "c4020102"},
+		{"fixarray", []int{1, 2}, "920102"},
+		{"nil slice", []int(nil), "c0"},
+		{"fixmap sorted", map[string]int{"b": 2, "a": 1}, "82a16101a16202"},
+		{"struct", tagged{A: 1, C: true}, "81a16101"},
+		{"pointer", &tagged{A: 1, B: "x"}, "82a16101a142a178"},
+		{"timestamp32", time.Unix(1, 0), "d6ff00000001"},
+		{"timestamp64", time.Unix(1, 1), "d7ff0000000400000001"},
+		{"timestamp96", time.Unix(-1, 0), "c70cff00000000ffffffffffffffff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := codec.MsgPack.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("Marshal() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgPackHeaderSizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		header string
+	}{
+		{"str16", strings.Repeat("x", 256), "da0100"},
+		{"bin16", make([]byte, 256), "c50100"},
+		{"array16", make([]bool, 16), "dc0010"},
+		{"map16", func() map[int]bool {
+			m := make(map[int]bool)
+			for i := 0; i < 16; i++ {
+				m[i] = true
+			}
+			return m
+		}(), "de0010"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := codec.MsgPack.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if header := hex.EncodeToString(got[:3]); header != tt.header {
+				t.Errorf("header = %s, want %s", header, tt.header)
+			}
+
+			// decoding into the same type gives the value back
+			target := reflect.New(reflect.TypeOf(tt.value))
+			if err := codec.MsgPack.Unmarshal(got, target.Interface()); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(target.Elem().Interface(), tt.value) {
+				t.Errorf("round trip changed the value")
+			}
+		})
+	}
+}
+
+func TestMsgPackGenericDecoding(t *testing.T) {
+	data, err := codec.MsgPack.Marshal(map[string]interface{}{
+		"int":    -5,
+		"big":    uint64(1) << 63,
+		"float":  float32(0.5),
+		"string": "text",
+		"bytes":  []byte{0},
+		"list":   []interface{}{true, nil},
+		"nested": map[int]string{1: "one"},
+		"time":   time.Unix(1700000000, 5),
+	})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var got interface{}
+	if err := codec.MsgPack.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"int":    int64(-5),
+		"big":    uint64(1) << 63,
+		"float":  0.5,
+		"string": "text",
+		"bytes":  []byte{0},
+		"list":   []interface{}{true, nil},
+		"nested": map[interface{}]interface{}{int64(1): "one"},
+		"time":   time.Unix(1700000000, 5).UTC(),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %#v, want %#v", got, want)
+	}
+}
+
+func TestMsgPackStructRoundTrip(t *testing.T) {
+	type item struct {
+		SKU   string
+		Count uint16
+	}
+	type order struct {
+		ID      int64             `msgpack:"id"`
+		Items   []item            `msgpack:"items"`
+		Labels  map[string]string `msgpack:"labels,omitempty"`
+		Note    *string           `msgpack:"note"`
+		Placed  time.Time         `msgpack:"placed"`
+		Total   float64           `msgpack:"total"`
+		Flags   [2]bool           `msgpack:"flags"`
+		private int
+	}
+
+	note := "fragile"
+	in := order{
+		ID:     42,
+		Items:  []item{{SKU: "a", Count: 2}, {SKU: "b", Count: 1}},
+		Note:   &note,
+		Placed: time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC),
+		Total:  19.99,
+		Flags:  [2]bool{true, false},
+	}
+
+	data, err := codec.MsgPack.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var out order
+	if err := codec.MsgPack.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+	}
+
+	// keys are matched ignoring case, unknown keys are skipped
+	data, _ = codec.MsgPack.Marshal(map[string]interface{}{"ID": 7, "unknown": 1})
+	out = order{}
+	if err := codec.MsgPack.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if out.ID != 7 {
+		t.Errorf("ID = %d, want 7", out.ID)
+	}
+}
+
+func TestMsgPackErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		target interface{}
+		want   string
+	}{
+		{"empty", "", new(interface{}), "unexpected end"},
+		{"truncated string", "a361", new(string), "unexpected end"},
+		{"oversized length", "dbffffffff", new(string), "unexpected end"},
+		{"trailing data", "0101", new(int), "trailing data"},
+		{"never used code", "c1", new(interface{}), "invalid code"},
+		{"unknown extension", "d40100", new(interface{}), "unsupported extension"},
+		{"type mismatch", "a161", new(int), "cannot unmarshal string"},
+		{"overflow", "cd012c", new(int8), "cannot unmarshal int64"},
+		{"negative into unsigned", "ff", new(uint), "cannot unmarshal int64"},
+		{"too deep", strings.Repeat("91", 1002) + "c0", new(interface{}), "too deep"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.data)
+			err := codec.MsgPack.Unmarshal(data, tt.target)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Unmarshal() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := codec.MsgPack.Marshal(make(chan int)); err == nil {
+		t.Errorf("Marshal() of a channel did not fail")
+	}
+	if err := codec.MsgPack.Unmarshal([]byte{0xc0}, 1); err == nil {
+		t.Errorf("Unmarshal() into a non pointer did not fail")
+	}
+}
+
+func TestMsgPackNilClearsTarget(t *testing.T) {
+	value := &struct{ A int }{A: 1}
+	if err := codec.MsgPack.Unmarshal([]byte{0xc0}, &value); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if value != nil {
+		t.Errorf("nil did not clear the pointer")
+	}
+
+	raw, _ := codec.MsgPack.Marshal([]byte("abc"))
+	if !bytes.Equal(raw, []byte{0xc4, 3, 'a', 'b', 'c'}) {
+		t.Errorf("Marshal([]byte) = %x", raw)
+	}
+}
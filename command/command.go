@@ -16,14 +16,7 @@ func FormatCommandWriter(w io.Writer, args ...string) error {
 		commandArray.Items[i] = &resp.RESPBulkString{Value: []byte(arg)}
 	}
 
-	buf := &bytes.Buffer{}
-	err := commandArray.Encode(buf)
-	if err != nil {
-		return err
-	}
-
-	_, err = w.Write(buf.Bytes())
-	return err
+	return commandArray.Encode(w)
 }
 
 func FormatCommand(args ...string) []byte {
@@ -34,3 +27,13 @@ func FormatCommand(args ...string) []byte {
 	}
 	return buf.Bytes()
 }
+
+// FormatCommandArgs encodes a command whose arguments are any Go values resp.MarshalArgs accepts,
+// numbers are sent as text and slices, maps and structs are flattened
+func FormatCommandArgs(args ...interface{}) ([]byte, error) {
+	commandArray, err := resp.MarshalArgs(args...)
+	if err != nil {
+		return nil, err
+	}
+	return commandArray.AppendRESP(nil)
+}
@@ -30,3 +30,19 @@ func TestFormatCommand(t *testing.T) {
 		t.Errorf("Expected %q, but got %q", expected, string(got))
 	}
 }
+
+func TestFormatCommandArgs(t *testing.T) {
+	got, err := command.FormatCommandArgs("EXPIRE", "key", 60, []string{"NX"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	expected := "*4\r\n$6\r\nEXPIRE\r\n$3\r\nkey\r\n$2\r\n60\r\n$2\r\nNX\r\n"
+	if string(got) != expected {
+		t.Errorf("Expected %q, but got %q", expected, string(got))
+	}
+
+	if _, err := command.FormatCommandArgs("SET", "key", make(chan int)); err == nil {
+		t.Errorf("Expected an error for an unsupported argument type")
+	}
+}
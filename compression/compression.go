@@ -0,0 +1,165 @@
+// Package compression compresses bus payloads. Payloads outside an envelope are marked with a
+// magic prefix naming the compressor, enveloped ones by the envelope's compression field
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MaxSize bounds decompressed payloads, it is the largest bulk string Redis accepts
+const MaxSize = 512 << 20
+
+// magic starts compressed payloads, followed by the length of the compressor name and the name.
+// Neither JSON nor a single MessagePack value starts with a zero byte
+var magic = []byte{0x00, 'z'}
+
+var ErrTooLarge = errors.New("compression: decompressed payload too large")
+
+// Compressor compresses and decompresses whole payloads
+type Compressor interface {
+	// Name identifies the compressor on the wire, at most 255 bytes
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	// Gzip is compress/gzip at the default level
+	Gzip Compressor = streamCompressor{
+		name: "gzip",
+		writer: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	}
+	// Deflate is compress/flate at the default level, without gzip's header and checksum
+	Deflate Compressor = streamCompressor{
+		name: "deflate",
+		writer: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		},
+	}
+)
+
+type streamCompressor struct {
+	name   string
+	writer func(io.Writer) (io.WriteCloser, error)
+	reader func(io.Reader) (io.ReadCloser, error)
+}
+
+func (c streamCompressor) Name() string { return c.name }
+
+func (c streamCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.writer(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c streamCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := c.reader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("compression: %s: %w", c.name, err)
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("compression: %s: %w", c.name, err)
+	}
+	if len(out) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
+
+var (
+	namesMutex sync.RWMutex
+	names      = map[string]Compressor{}
+)
+
+func init() {
+	Register(Gzip)
+	Register(Deflate)
+}
+
+// Register makes a compressor available by name, for decompressing what others publish
+func Register(c Compressor) {
+	namesMutex.Lock()
+	defer namesMutex.Unlock()
+
+	names[c.Name()] = c
+}
+
+// Get returns the compressor registered under name
+func Get(name string) (Compressor, bool) {
+	namesMutex.RLock()
+	defer namesMutex.RUnlock()
+
+	c, ok := names[name]
+	return c, ok
+}
+
+// Wrap compresses data and prefixes it with the magic naming c
+func Wrap(c Compressor, data []byte) ([]byte, error) {
+	name := c.Name()
+	if len(name) == 0 || len(name) > 255 {
+		return nil, fmt.Errorf("compression: invalid compressor name %q", name)
+	}
+
+	compressed, err := c.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(magic)+1+len(name)+len(compressed))
+	out = append(out, magic...)
+	out = append(out, byte(len(name)))
+	out = append(out, name...)
+	return append(out, compressed...), nil
+}
+
+// IsWrapped reports whether data starts with the magic prefix
+func IsWrapped(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Unwrap decompresses a payload made by Wrap. ok is false, without an error, for payloads
+// without the magic prefix
+func Unwrap(data []byte) (out []byte, ok bool, err error) {
+	if !IsWrapped(data) {
+		return nil, false, nil
+	}
+
+	rest := data[len(magic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return nil, true, errors.New("compression: truncated header")
+	}
+	name := string(rest[1 : 1+int(rest[0])])
+
+	c, found := Get(name)
+	if !found {
+		return nil, true, fmt.Errorf("compression: unknown compressor %q", name)
+	}
+	out, err = c.Decompress(rest[1+int(rest[0]):])
+	return out, true, err
+}
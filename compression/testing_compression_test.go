@@ -0,0 +1,85 @@
+package compression_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Moonlight-Companies/goresp/compression"
+)
+
+func TestWrapUnwrap(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"event":"created","item":"lamp"},`, 100))
+
+	for _, c := range []compression.Compressor{compression.Gzip, compression.Deflate} {
+		t.Run(c.Name(), func(t *testing.T) {
+			wrapped, err := compression.Wrap(c, payload)
+			if err != nil {
+				t.Fatalf("Wrap() error = %v", err)
+			}
+			if len(wrapped) >= len(payload) {
+				t.Errorf("Wrap() = %d bytes, not smaller than %d", len(wrapped), len(payload))
+			}
+			if !bytes.HasPrefix(wrapped, append([]byte{0, 'z', byte(len(c.Name()))}, c.Name()...)) {
+				t.Errorf("Wrap() = %q..., missing the magic prefix", wrapped[:8])
+			}
+
+			out, ok, err := compression.Unwrap(wrapped)
+			if !ok || err != nil {
+				t.Fatalf("Unwrap() = %v, %v", ok, err)
+			}
+			if !bytes.Equal(out, payload) {
+				t.Errorf("Unwrap() changed the payload")
+			}
+		})
+	}
+}
+
+func TestUnwrapPlainPayloads(t *testing.T) {
+	for _, payload := range []string{`{"id":1}`, "\x1f\x8b", "", "\x00"} {
+		out, ok, err := compression.Unwrap([]byte(payload))
+		if out != nil || ok || err != nil {
+			t.Errorf("Unwrap(%q) = %v, %v, %v, want a plain payload", payload, out, ok, err)
+		}
+	}
+}
+
+func TestUnwrapErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"no header", "\x00z", "truncated"},
+		{"short name", "\x00z\x04gz", "truncated"},
+		{"unknown compressor", "\x00z\x04zstd....", "unknown compressor"},
+		{"corrupt body", "\x00z\x04gzipnot gzip", "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := compression.Unwrap([]byte(tt.payload))
+			if !ok || err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Unwrap() = %v, %v, want %q", ok, err, tt.want)
+			}
+		})
+	}
+}
+
+type upper struct{}
+
+func (upper) Name() string                           { return "upper" }
+func (upper) Compress(data []byte) ([]byte, error)   { return bytes.ToUpper(data), nil }
+func (upper) Decompress(data []byte) ([]byte, error) { return bytes.ToLower(data), nil }
+
+func TestRegister(t *testing.T) {
+	compression.Register(upper{})
+	if _, ok := compression.Get("upper"); !ok {
+		t.Fatalf("Get(upper) did not find the registered compressor")
+	}
+
+	wrapped, _ := compression.Wrap(upper{}, []byte("abc"))
+	if out, _, err := compression.Unwrap(wrapped); err != nil || string(out) != "abc" {
+		t.Errorf("Unwrap() = %q, %v", out, err)
+	}
+}
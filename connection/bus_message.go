@@ -1,16 +1,131 @@
 package connection
 
-import "encoding/json"
+import (
+	"io"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/compression"
+	"github.com/Moonlight-Companies/goresp/envelope"
+	"github.com/Moonlight-Companies/goresp/glob"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
 
 type BusMessage struct {
 	Channel string
 	Data    []byte
 	Pattern string
+	// Codec is the codec chosen for the channel with Reconnecting.SetCodec, nil means JSON
+	Codec codec.Codec
+	// Envelope holds the metadata of an enveloped message, Data is then its body.
+	// It is nil for plain payloads
+	Envelope *envelope.Envelope
+	// Body is set instead of Data when the payload is at least the threshold given to
+	// Reconnecting.SetStreamThreshold. It is shared by every recipient of the message and has
+	// to be read or closed before the connection delivers anything else, reading fails with
+	// io.ErrClosedPipe when the connection drops first. Compressed and enveloped payloads are
+	// not unwrapped
+	Body io.ReadCloser
 }
 
 func (m *BusMessage) IntoMap() (output map[string]interface{}, err error) {
-	if err = json.Unmarshal(m.Data, &output); err != nil {
+	if err = m.Unmarshal(&output); err != nil {
 		return nil, err
 	}
 	return output, nil
 }
+
+// Unmarshal decodes the payload into v with the message's codec. A streamed Body is read
+// into Data first
+func (m *BusMessage) Unmarshal(v interface{}) error {
+	c := m.Codec
+	if c == nil {
+		c = codec.JSON
+	}
+	return m.unmarshalWith(c, v)
+}
+
+func (m *BusMessage) unmarshalWith(c codec.Codec, v interface{}) error {
+	if err := m.readBody(); err != nil {
+		return err
+	}
+	return c.Unmarshal(m.Data, v)
+}
+
+// readBody reads and closes a streamed Body, keeping the payload in Data
+func (m *BusMessage) readBody() error {
+	if m.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(m.Body)
+	m.Body.Close()
+	m.Body = nil
+	if err != nil {
+		return err
+	}
+	m.Data = data
+	return nil
+}
+
+// Matches reports whether the message's channel matches a PSUBSCRIBE style pattern
+func (m *BusMessage) Matches(pattern string) bool {
+	return glob.Match(pattern, m.Channel)
+}
+
+// setPayload sets the payload of a message from its last item, which has to be a bulk
+// string. A streamed one becomes the Body
+func (m *BusMessage) setPayload(value resp.RESPValue) bool {
+	switch payload := value.(type) {
+	case *resp.RESPBulkString:
+		m.Data = payload.Value
+	case *resp.RESPBulkStream:
+		if body, ok := payload.Body.(io.ReadCloser); ok {
+			m.Body = body
+		} else {
+			m.Body = io.NopCloser(payload.Body)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// closeStream closes the body of a value the connection does not deliver, so reading the
+// connection goes on
+func closeStream(value resp.RESPValue) {
+	if items, err := value.AsArray(); err == nil && len(items) > 0 {
+		value = items[len(items)-1]
+	}
+	if stream, ok := value.(*resp.RESPBulkStream); ok {
+		if body, ok := stream.Body.(io.Closer); ok {
+			body.Close()
+		}
+	}
+}
+
+// unwrap decompresses the payload and replaces an envelope with its body, using the body's
+// codec when it is known
+func (m *BusMessage) unwrap() error {
+	if m.Body != nil {
+		return nil
+	}
+
+	data, ok, err := compression.Unwrap(m.Data)
+	if err != nil {
+		return err
+	}
+	if ok {
+		m.Data = data
+	}
+
+	e, ok, err := envelope.Open(m.Data)
+	if !ok || err != nil {
+		return err
+	}
+
+	m.Envelope = e
+	m.Data = e.Body
+	if c, ok := codec.Get(e.Codec); ok {
+		m.Codec = c
+	}
+	return nil
+}
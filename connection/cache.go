@@ -0,0 +1,198 @@
+package connection
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// Cache is a client side cache of string keys read with GET. Values stay in an LRU until the
+// server reports a change: the Cache's Client enables CLIENT TRACKING with its invalidations
+// redirected to a Reconnecting subscribed to __redis__:invalidate, the RESP2 redirect mode.
+// The whole cache is flushed when either connection drops, invalidations may have been lost.
+// RESP3 push invalidations are not supported, the decoder speaks RESP2
+type Cache struct {
+	client        *Client
+	invalidations *Reconnecting
+	capacity      int
+	mutex         sync.Mutex
+	entries       map[string]*list.Element
+	order         *list.List // most recently used first
+	redirectID    int64      // client ID of the invalidations connection, 0 while it is down
+	tracking      bool       // the Client's connection sends its invalidations to redirectID
+	version       uint64     // changes with every invalidation, reads spanning one aren't cached
+}
+
+type cacheEntry struct {
+	key    string
+	value  []byte
+	exists bool
+}
+
+// NewCache starts a cache of up to capacity keys for the server at addr
+func NewCache(addr string, capacity int) *Cache {
+	c := &Cache{
+		client:   NewClient(addr),
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+	c.client.onDial(c.track)
+	c.client.onDrop(c.trackingLost)
+
+	r := newReconnecting(addr)
+	r.onClientID = c.redirect
+	r.onInvalidate = c.invalidate
+	r.OnDisconnect(c.redirectLost)
+	r.Subscribe(invalidationChannel)
+	r.start()
+	c.invalidations = r
+
+	return c
+}
+
+// Close closes both connections
+func (c *Cache) Close() {
+	c.invalidations.Close()
+	c.client.Close()
+}
+
+// Client returns the connection the cache reads with. Writes sent through it, or any other
+// connection, invalidate the cached keys they change
+func (c *Cache) Client() *Client {
+	return c.client
+}
+
+// Len returns the number of cached keys
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+// Get returns the value of key from the cache, or reads it with GET and caches it. A missing
+// key returns resp.ErrNil, and is cached as missing
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mutex.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cacheEntry)
+		c.mutex.Unlock()
+
+		if !entry.exists {
+			return nil, resp.ErrNil
+		}
+		return entry.value, nil
+	}
+	version := c.version
+	c.mutex.Unlock()
+
+	reply, err := c.client.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := reply.AsBytes()
+	if err != nil && err != resp.ErrNil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	if c.tracking && c.version == version {
+		c.store(&cacheEntry{key: key, value: value, exists: err == nil})
+	}
+	c.mutex.Unlock()
+	return value, err
+}
+
+// store adds or replaces an entry, evicting the least recently used one. The caller holds c.mutex
+func (c *Cache) store(entry *cacheEntry) {
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.key] = c.order.PushFront(entry)
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// flush empties the cache, the caller holds c.mutex
+func (c *Cache) flush() {
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.version++
+}
+
+// track enables tracking on a new Client connection once the invalidations connection is up,
+// until then reads are not cached
+func (c *Cache) track(do doFunc) error {
+	c.mutex.Lock()
+	id := c.redirectID
+	c.tracking = false
+	c.mutex.Unlock()
+
+	if id == 0 {
+		return nil
+	}
+	if _, err := do("CLIENT", "TRACKING", "ON", "REDIRECT", id); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.tracking = c.redirectID == id
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *Cache) trackingLost() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.tracking = false
+	c.flush()
+}
+
+// redirect receives the client ID of a new invalidations connection, the Client reconnects to
+// redirect its tracking there
+func (c *Cache) redirect(id int64) {
+	c.mutex.Lock()
+	c.redirectID = id
+	c.mutex.Unlock()
+
+	c.client.reconnect()
+}
+
+func (c *Cache) redirectLost() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.redirectID = 0
+	c.tracking = false
+	c.flush()
+}
+
+// invalidate drops keys from the cache, nil keys flush it
+func (c *Cache) invalidate(keys []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if keys == nil {
+		c.flush()
+		return
+	}
+
+	c.version++
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/logging"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// ErrClientClosed is returned by commands sent on a closed Client
+var ErrClientClosed = errors.New("client closed")
+
+// Client sends commands and reads their replies, which a subscribed Reconnecting can't do.
+// It dials on first use and again after a failure, backing off between failed attempts the
+// way Reconnecting does. Commands go out one at a time, concurrent callers wait their turn
+type Client struct {
+	logger         *logging.Logger
+	addr           string
+	mutex          sync.Mutex // held for a whole round trip
+	connMutex      sync.Mutex
+	conn           net.Conn
+	closed         bool
+	decoder        *resp.Decode
+	reconnectDelay time.Duration
+	retryAt        time.Time
+	redial         bool
+	dialHooks      []func(do doFunc) error
+	dropHooks      []func()
+}
+
+// doFunc runs a command on the connection being set up
+type doFunc func(args ...interface{}) (resp.RESPValue, error)
+
+func NewClient(addr string) *Client {
+	return &Client{
+		logger:         logging.NewLogger(logging.LogLevelInfo),
+		addr:           addr,
+		decoder:        &resp.Decode{},
+		reconnectDelay: time.Second,
+	}
+}
+
+// Close closes the connection, interrupting a command waiting for its reply
+func (c *Client) Close() {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	c.closed = true
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// Do sends a command whose arguments are any values resp.MarshalArgs accepts and returns the
+// reply. An error reply is returned as the error as well. ctx bounds the whole round trip,
+// the connection is dropped when it ends before the reply arrived
+func (c *Client) Do(ctx context.Context, args ...interface{}) (resp.RESPValue, error) {
+	cmd, err := command.FormatCommandArgs(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := c.Pipeline(ctx, cmd, 1)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], replies[0].Err()
+}
+
+// Pipeline writes encoded commands in one go and reads their n replies. Error replies are
+// returned as values, only a failed round trip is an error
+func (c *Client) Pipeline(ctx context.Context, commands []byte, n int) ([]resp.RESPValue, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.exchange(ctx, conn, commands, n)
+}
+
+// exchange writes commands to conn and reads n replies, the caller holds c.mutex
+func (c *Client) exchange(ctx context.Context, conn net.Conn, commands []byte, n int) ([]resp.RESPValue, error) {
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// interrupt the blocked write or read
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	if _, err := conn.Write(commands); err != nil {
+		return nil, c.fail(ctx, conn, err)
+	}
+
+	replies := make([]resp.RESPValue, 0, n)
+	buffer := make([]byte, 16384)
+	for len(replies) < n {
+		value, err := c.decoder.Parse()
+		if err != nil {
+			return nil, c.fail(ctx, conn, err)
+		}
+		if value != nil {
+			replies = append(replies, value)
+			continue
+		}
+
+		read, err := conn.Read(buffer)
+		if err != nil {
+			return nil, c.fail(ctx, conn, err)
+		}
+		c.decoder.Provide(buffer[:read])
+	}
+	return replies, nil
+}
+
+// dial returns the open connection or opens one, waiting out the backoff after a failed
+// attempt. The dial hooks run on every new connection
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	c.connMutex.Lock()
+	stale := c.redial && c.conn != nil
+	if stale {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.redial = false
+	conn, closed := c.conn, c.closed
+	c.connMutex.Unlock()
+
+	if stale {
+		c.dropped()
+	}
+
+	switch {
+	case closed:
+		return nil, ErrClientClosed
+	case conn != nil:
+		return conn, nil
+	}
+
+	if wait := time.Until(c.retryAt); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		c.retryAt = time.Now().Add(c.reconnectDelay)
+		c.reconnectDelay = min(c.reconnectDelay*2, maxReconnectDelay)
+		return nil, err
+	}
+	c.reconnectDelay = time.Second
+
+	c.connMutex.Lock()
+	if c.closed {
+		c.connMutex.Unlock()
+		conn.Close()
+		return nil, ErrClientClosed
+	}
+	c.conn = conn
+	c.decoder.Reset()
+	hooks := c.dialHooks
+	c.connMutex.Unlock()
+
+	c.logger.Info("Connected to Redis")
+	do := func(args ...interface{}) (resp.RESPValue, error) {
+		cmd, err := command.FormatCommandArgs(args...)
+		if err != nil {
+			return nil, err
+		}
+		replies, err := c.exchange(ctx, conn, cmd, 1)
+		if err != nil {
+			return nil, err
+		}
+		return replies[0], replies[0].Err()
+	}
+	for _, hook := range hooks {
+		if err := hook(do); err != nil {
+			return nil, c.fail(ctx, conn, err)
+		}
+	}
+	return conn, nil
+}
+
+// onDial registers fn to set up every new connection before its first command
+func (c *Client) onDial(fn func(do doFunc) error) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	c.dialHooks = append(c.dialHooks, fn)
+}
+
+// onDrop registers fn to run when a connection is dropped
+func (c *Client) onDrop(fn func()) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	c.dropHooks = append(c.dropHooks, fn)
+}
+
+// reconnect makes the next command open a new connection, the current one is left alone
+// until then so a command in flight completes
+func (c *Client) reconnect() {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	c.redial = true
+}
+
+func (c *Client) dropped() {
+	c.connMutex.Lock()
+	hooks := c.dropHooks
+	c.connMutex.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// fail drops a connection whose replies can no longer be matched to commands
+func (c *Client) fail(ctx context.Context, conn net.Conn, err error) error {
+	c.connMutex.Lock()
+	closed := c.closed
+	conn.Close()
+	c.conn = nil
+	c.connMutex.Unlock()
+	c.dropped()
+
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case closed:
+		return ErrClientClosed
+	}
+	c.logger.Info("Disconnected from Redis: %v", err)
+	return err
+}
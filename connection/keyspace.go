@@ -0,0 +1,123 @@
+package connection
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+const (
+	keyspacePrefix = "__keyspace@"
+	keyeventPrefix = "__keyevent@"
+)
+
+// KeyEvent is a keyspace notification: Event, such as "set", "del" or "expired", happened to
+// Key in database DB
+type KeyEvent struct {
+	DB    int
+	Key   string
+	Event string
+}
+
+// KeyspaceChannel returns the channel, or pattern, of the notifications for keys matching
+// keyPattern in database db, a negative db matches every database
+func KeyspaceChannel(db int, keyPattern string) string {
+	return keyspacePrefix + dbPattern(db) + "__:" + keyPattern
+}
+
+// KeyeventChannel returns the channel, or pattern, of the notifications for events matching
+// eventPattern in database db, a negative db matches every database
+func KeyeventChannel(db int, eventPattern string) string {
+	return keyeventPrefix + dbPattern(db) + "__:" + eventPattern
+}
+
+func dbPattern(db int) string {
+	if db < 0 {
+		return "*"
+	}
+	return strconv.Itoa(db)
+}
+
+// ParseKeyEvent parses a message of a __keyspace@<db>__:<key> channel, whose payload is the
+// event, or of a __keyevent@<db>__:<event> channel, whose payload is the key
+func ParseKeyEvent(msg BusMessage) (KeyEvent, bool) {
+	rest, keyspace := strings.CutPrefix(msg.Channel, keyspacePrefix)
+	if !keyspace {
+		var ok bool
+		if rest, ok = strings.CutPrefix(msg.Channel, keyeventPrefix); !ok {
+			return KeyEvent{}, false
+		}
+	}
+
+	dbText, name, found := strings.Cut(rest, "__:")
+	if !found {
+		return KeyEvent{}, false
+	}
+	db, err := strconv.Atoi(dbText)
+	if err != nil {
+		return KeyEvent{}, false
+	}
+
+	if keyspace {
+		return KeyEvent{DB: db, Key: name, Event: string(msg.Data)}, true
+	}
+	return KeyEvent{DB: db, Key: string(msg.Data), Event: name}, true
+}
+
+// HandleKeyEvents registers fn for the notifications of a channel or pattern built with
+// KeyspaceChannel or KeyeventChannel. Like any handler its subscription is restored after a
+// reconnect. Messages that aren't notifications are dropped
+func (r *Reconnecting) HandleKeyEvents(channelOrPattern string, fn func(KeyEvent), options ...HandlerOption) *Handler {
+	return r.Handle(channelOrPattern, func(msg BusMessage) {
+		event, ok := ParseKeyEvent(msg)
+		if !ok {
+			r.logger.Warn("Dropping malformed keyspace notification on %s", msg.Channel)
+			return
+		}
+		fn(event)
+	}, options...)
+}
+
+// ConfigureKeyspaceEvents makes sure notify-keyspace-events includes every class in flags,
+// such as "Kx" for keyspace notifications of expirations, adding the missing ones with
+// CONFIG SET. It returns the resulting setting. The setting is lost when the server restarts
+// without it in its configuration, Reconnecting.OnConnect can apply it again
+func ConfigureKeyspaceEvents(ctx context.Context, client *Client, flags string) (string, error) {
+	reply, err := client.Do(ctx, "CONFIG", "GET", "notify-keyspace-events")
+	if err != nil {
+		return "", err
+	}
+	values, err := reply.AsMap()
+	if err != nil {
+		return "", err
+	}
+
+	current := values["notify-keyspace-events"]
+	merged := mergeKeyspaceFlags(current, flags)
+	if merged == current {
+		return current, nil
+	}
+
+	if _, err := client.Do(ctx, "CONFIG", "SET", "notify-keyspace-events", merged); err != nil {
+		return "", err
+	}
+	return merged, nil
+}
+
+// keyspaceAllFlags are the event classes the A flag stands for
+const keyspaceAllFlags = "g$lshzxetd"
+
+// mergeKeyspaceFlags adds the flags of extra missing from current
+func mergeKeyspaceFlags(current, extra string) string {
+	has := func(flag rune) bool {
+		return strings.ContainsRune(current, flag) || (strings.ContainsRune(current, 'A') && strings.ContainsRune(keyspaceAllFlags, flag))
+	}
+
+	merged := current
+	for _, flag := range extra {
+		if !has(flag) && !strings.ContainsRune(merged, flag) {
+			merged += string(flag)
+		}
+	}
+	return merged
+}
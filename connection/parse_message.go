@@ -1,6 +1,8 @@
 package connection
 
 import (
+	"strings"
+
 	"github.com/Moonlight-Companies/goresp/resp"
 )
 
@@ -18,9 +20,9 @@ func ParseMessage(value resp.RESPValue) (*BusMessage, bool) {
 		return nil, false // Not enough data to form a message
 	}
 
-	messageType, ok := array.Items[0].(*resp.RESPBulkString)
-	if !ok || (messageType.String() != "message" && messageType.String() != "pmessage") {
-		return nil, false // Not a message or pmessage
+	messageType, ok := bulkString(array.Items[0])
+	if !ok {
+		return nil, false
 	}
 
 	busMessage := BusMessage{
@@ -28,44 +30,116 @@ func ParseMessage(value resp.RESPValue) (*BusMessage, bool) {
 		Pattern: "",
 	}
 
-	switch messageType.String() {
+	switch messageType {
 	case "message":
 		if len(array.Items) != 3 {
 			return nil, false // Incorrect format for message
 		}
-		channel, ok := array.Items[1].(*resp.RESPBulkString)
-		if !ok {
+		if busMessage.Channel, ok = bulkString(array.Items[1]); !ok {
 			return nil, false
 		}
-		data, ok := array.Items[2].(*resp.RESPBulkString)
-		if !ok {
+		if !busMessage.setPayload(array.Items[2]) {
 			return nil, false
 		}
-		busMessage.Channel = channel.String()
-		busMessage.Data = []byte(data.String())
 
 	case "pmessage":
 		if len(array.Items) != 4 {
 			return nil, false // Incorrect format for pmessage
 		}
-		pattern, ok := array.Items[1].(*resp.RESPBulkString)
-		if !ok {
+		if busMessage.Pattern, ok = bulkString(array.Items[1]); !ok {
 			return nil, false
 		}
-		channel, ok := array.Items[2].(*resp.RESPBulkString)
-		if !ok {
+		if busMessage.Channel, ok = bulkString(array.Items[2]); !ok {
 			return nil, false
 		}
-		data, ok := array.Items[3].(*resp.RESPBulkString)
-		if !ok {
+		if !busMessage.setPayload(array.Items[3]) {
 			return nil, false
 		}
-		busMessage.Pattern = pattern.String()
-		busMessage.Channel = channel.String()
-		busMessage.Data = []byte(data.String())
 	default:
-		return nil, false
+		return nil, false // Not a message or pmessage
 	}
 
 	return &busMessage, true
 }
+
+// bulkString returns the text of a non nil bulk string, the only type the names of a pub/sub
+// message come as
+func bulkString(value resp.RESPValue) (string, bool) {
+	b, ok := value.(*resp.RESPBulkString)
+	if !ok || b.Value == nil {
+		return "", false
+	}
+	return string(b.Value), true
+}
+
+// subscriptionAck is the server's reply to one channel or pattern of a (un)subscribe command,
+// Count is the number of channels and patterns the connection is subscribed to afterwards
+type subscriptionAck struct {
+	Kind  string
+	Name  string
+	Count int64
+}
+
+func parseAck(value resp.RESPValue) (*subscriptionAck, bool) {
+	if value == nil {
+		return nil, false
+	}
+
+	items, err := value.AsArray()
+	if err != nil || len(items) != 3 {
+		return nil, false
+	}
+
+	ackType, err := items[0].AsString()
+	if err != nil {
+		return nil, false
+	}
+
+	ack := subscriptionAck{}
+	switch ackType {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe":
+		ack.Kind = strings.ToUpper(ackType)
+	default:
+		return nil, false
+	}
+
+	// unsubscribing while subscribed to nothing acks a nil name
+	if !items[1].IsNil() {
+		if ack.Name, err = items[1].AsString(); err != nil {
+			return nil, false
+		}
+	}
+	if ack.Count, err = items[2].AsInt64(); err != nil {
+		return nil, false
+	}
+
+	return &ack, true
+}
+
+// invalidationChannel carries the invalidations of keys tracked with CLIENT TRACKING ON
+// REDIRECT in RESP2
+const invalidationChannel = "__redis__:invalidate"
+
+// parseInvalidation parses a message of the invalidation channel, whose payload is an array
+// of keys. nil keys mean every key was invalidated, after FLUSHALL or FLUSHDB
+func parseInvalidation(value resp.RESPValue) ([]string, bool) {
+	items, err := value.AsArray()
+	if err != nil || len(items) != 3 {
+		return nil, false
+	}
+	if kind, err := items[0].AsString(); err != nil || kind != "message" {
+		return nil, false
+	}
+	if channel, err := items[1].AsString(); err != nil || channel != invalidationChannel {
+		return nil, false
+	}
+
+	if items[2].IsNil() {
+		return nil, true
+	}
+	keys, err := items[2].AsStringSlice()
+	if err != nil {
+		return nil, false
+	}
+	return keys, true
+}
@@ -0,0 +1,400 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+)
+
+const (
+	// ackTimeout is how long Reconcile leaves out a subscription waiting for its ack, a
+	// command dropped from a full queue is never acknowledged
+	ackTimeout = 10 * time.Second
+	// introspectionTimeout bounds the CLIENT LIST query of Reconcile
+	introspectionTimeout = 5 * time.Second
+)
+
+// ReconcileReport is the difference between the desired subscriptions and the ones the
+// server acknowledged on the current connection
+type ReconcileReport struct {
+	// Missing are registered but not acknowledged, they were subscribed again
+	Missing []ReconnectingChannel
+	// Extra are acknowledged but no longer registered, they were unsubscribed again
+	Extra []ReconnectingChannel
+	// ServerCount is the subscription count of the last ack, Acked the number of
+	// subscriptions tracked from acks. They differ when acks were missed
+	ServerCount int64
+	Acked       int
+	// Introspection is what the server reports about the connection, nil without
+	// SetReconcileClient, while acks are in flight or when the query failed
+	Introspection *Introspection
+}
+
+// Introspection compares the subscription counts CLIENT LIST reports for the connection with
+// the registered ones
+type Introspection struct {
+	Channels     int
+	Patterns     int
+	WantChannels int
+	WantPatterns int
+}
+
+func (i *Introspection) mismatch() bool {
+	return i != nil && (i.Channels != i.WantChannels || i.Patterns != i.WantPatterns)
+}
+
+// Drift reports whether the server side state did not match
+func (report ReconcileReport) Drift() bool {
+	return len(report.Missing) > 0 || len(report.Extra) > 0 || report.ServerCount != int64(report.Acked) ||
+		report.Introspection.mismatch()
+}
+
+// ackState is the server side subscription set of the current connection as told by acks,
+// and the subscriptions whose (un)subscribe command is still waiting for its ack
+type ackState struct {
+	mutex      sync.Mutex
+	subscribed map[routeKey]ReconnectingChannel
+	inFlight   map[routeKey]inFlight
+	count      int64
+}
+
+// inFlight counts the commands sent for a subscription that were not acknowledged yet
+type inFlight struct {
+	commands int
+	since    time.Time
+}
+
+func newAckState() *ackState {
+	return &ackState{
+		subscribed: make(map[routeKey]ReconnectingChannel),
+		inFlight:   make(map[routeKey]inFlight),
+	}
+}
+
+// expect records that a subscribe or unsubscribe command for channels was sent
+func (state *ackState) expect(channels []ReconnectingChannel) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	now := time.Now()
+	for _, channel := range channels {
+		key := registryKey(channel)
+		f := state.inFlight[key]
+		f.commands++
+		f.since = now
+		state.inFlight[key] = f
+	}
+}
+
+// pending reports whether key waits for an ack, the caller holds state.mutex
+func (state *ackState) pending(key routeKey) bool {
+	f, ok := state.inFlight[key]
+	return ok && time.Since(f.since) < ackTimeout
+}
+
+// settled reports whether no ack is awaited
+func (state *ackState) settled() bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	for key := range state.inFlight {
+		if state.pending(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// acknowledged returns the acknowledged subscriptions of kind, every kind when it is empty
+func (state *ackState) acknowledged(kind string) []ReconnectingChannel {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	channels := []ReconnectingChannel{}
+	for _, channel := range state.subscribed {
+		if kind == "" || channel.Kind == kind {
+			channels = append(channels, channel)
+		}
+	}
+	sortChannels(channels)
+	return channels
+}
+
+// reset forgets everything, a new connection starts without subscriptions
+func (state *ackState) reset() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.subscribed = make(map[routeKey]ReconnectingChannel)
+	state.inFlight = make(map[routeKey]inFlight)
+	state.count = 0
+}
+
+func (state *ackState) apply(ack *subscriptionAck) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.count = ack.Count
+	var key routeKey
+	switch ack.Kind {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		channel := ReconnectingChannel{Channel: ack.Name, Kind: ack.Kind}
+		key = registryKey(channel)
+		state.subscribed[key] = channel
+	case "UNSUBSCRIBE":
+		key = routeKey{Kind: "SUBSCRIBE", Name: ack.Name}
+		delete(state.subscribed, key)
+	case "PUNSUBSCRIBE":
+		key = routeKey{Kind: "PSUBSCRIBE", Name: ack.Name}
+		delete(state.subscribed, key)
+	}
+	if f, ok := state.inFlight[key]; ok {
+		if f.commands--; f.commands > 0 {
+			state.inFlight[key] = f
+		} else {
+			delete(state.inFlight, key)
+		}
+	}
+	if ack.Count == 0 {
+		state.subscribed = make(map[routeKey]ReconnectingChannel)
+	}
+}
+
+// diff compares desired against the acknowledged subscriptions, leaving out the ones waiting
+// for an ack
+func (state *ackState) diff(desired []ReconnectingChannel) ReconcileReport {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	report := ReconcileReport{
+		ServerCount: state.count,
+		Acked:       len(state.subscribed),
+	}
+
+	wanted := make(map[routeKey]bool, len(desired))
+	for _, channel := range desired {
+		key := registryKey(channel)
+		wanted[key] = true
+		if _, ok := state.subscribed[key]; !ok && !state.pending(key) {
+			report.Missing = append(report.Missing, channel)
+		}
+	}
+	for key, channel := range state.subscribed {
+		if !wanted[key] && !state.pending(key) {
+			report.Extra = append(report.Extra, channel)
+		}
+	}
+	sortChannels(report.Extra)
+	return report
+}
+
+// Acknowledged returns the channels and patterns the server acknowledged on the current
+// connection, patterns last. Subscriptions returns the desired state
+func (r *Reconnecting) Acknowledged() []ReconnectingChannel {
+	return r.acked.acknowledged("")
+}
+
+// Settled reports whether every subscribe and unsubscribe command sent on the current
+// connection was acknowledged. A command waiting for longer than ackTimeout is given up on
+func (r *Reconnecting) Settled() bool {
+	return r.acked.settled()
+}
+
+// Reconcile compares the registered subscriptions with the ones the server acknowledged,
+// subscribes to the missing ones and unsubscribes from the extra ones. Subscriptions whose
+// command waits for its ack are left out. With SetReconcileClient the subscription counts the
+// server reports for the connection are compared too. Drift is logged as a warning
+func (r *Reconnecting) Reconcile() ReconcileReport {
+	if !r.Connected() {
+		return ReconcileReport{}
+	}
+
+	desired := r.registry.list()
+	report := r.acked.diff(desired)
+	report.Introspection = r.introspect(desired)
+	if !report.Drift() {
+		return report
+	}
+
+	r.logger.Warn("Subscription drift: %d missing, %d extra, server count %d, acknowledged %d",
+		len(report.Missing), len(report.Extra), report.ServerCount, report.Acked)
+	if i := report.Introspection; i.mismatch() {
+		r.logger.Warn("Server reports %d channels and %d patterns for the connection, %d and %d are registered",
+			i.Channels, i.Patterns, i.WantChannels, i.WantPatterns)
+	}
+
+	// the repairs are written to the connection directly like resubscribe does, the command
+	// queue drops commands when it is full
+	conn := r.currentConn()
+	if conn == nil {
+		return report
+	}
+
+	batchSize := r.getResubscribeBatchSize()
+	if len(report.Missing) > 0 || len(report.Extra) > 0 {
+		r.acked.expect(report.Missing)
+		r.acked.expect(report.Extra)
+		r.writeRepair(conn, append(batchSubscriptions(report.Missing, batchSize),
+			batchUnsubscriptions(report.Extra, batchSize)...))
+		return report
+	}
+
+	// the server's state differs without the acks telling how, start over from the registry.
+	// Extra subscriptions can only be found by dropping every subscription of their kind, the
+	// unsubscribe acks of the known ones are expected so they don't settle the subscribe
+	// commands that follow
+	var commands [][]byte
+	if i := report.Introspection; i != nil && i.Channels > i.WantChannels {
+		r.acked.expect(r.acked.acknowledged("SUBSCRIBE"))
+		commands = append(commands, command.FormatCommand("UNSUBSCRIBE"))
+	}
+	if i := report.Introspection; i != nil && i.Patterns > i.WantPatterns {
+		r.acked.expect(r.acked.acknowledged("PSUBSCRIBE"))
+		commands = append(commands, command.FormatCommand("PUNSUBSCRIBE"))
+	}
+	r.acked.expect(desired)
+	r.writeRepair(conn, append(commands, batchSubscriptions(desired, batchSize)...))
+	return report
+}
+
+// writeRepair writes the commands of Reconcile to conn, dropping the connection when that
+// fails so the reconnect restores the subscriptions instead
+func (r *Reconnecting) writeRepair(conn net.Conn, commands [][]byte) {
+	for _, cmd := range commands {
+		if _, err := conn.Write(cmd); err != nil {
+			r.logger.Error("Failed to repair subscriptions: %v", err)
+			r.disconnect()
+			return
+		}
+	}
+}
+
+// SetReconcileClient makes Reconcile compare the subscription counts the server reports for the
+// connection, with CLIENT LIST over c, against the registry. The acks don't show subscriptions
+// the server lost without telling, and a connection in subscribe mode can't send CLIENT LIST
+// itself. The ID is asked for when connecting, a connection made without it is dropped so the
+// next one learns it. nil turns the check off
+func (r *Reconnecting) SetReconcileClient(c *Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reconcileClient = c
+	if c != nil && r.conn != nil && !r.clientIDRequested {
+		r.conn.Close()
+	}
+}
+
+// introspect asks the server for the connection's subscription counts, nil when there is no
+// reconcile client, acks are awaited or the query fails
+func (r *Reconnecting) introspect(desired []ReconnectingChannel) *Introspection {
+	r.mutex.Lock()
+	client, id := r.reconcileClient, r.clientID
+	r.mutex.Unlock()
+
+	if client == nil || id == 0 || !r.acked.settled() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), introspectionTimeout)
+	defer cancel()
+	reply, err := client.Do(ctx, "CLIENT", "LIST", "ID", id)
+	if err != nil {
+		r.logger.Warn("Failed to list the connection for reconciliation: %v", err)
+		return nil
+	}
+	text, _ := reply.AsString()
+	fields := parseClientInfo(text)
+	channels, err := strconv.Atoi(fields["sub"])
+	if err != nil {
+		r.logger.Warn("Unexpected CLIENT LIST reply for reconciliation: %q", text)
+		return nil
+	}
+	patterns, err := strconv.Atoi(fields["psub"])
+	if err != nil {
+		r.logger.Warn("Unexpected CLIENT LIST reply for reconciliation: %q", text)
+		return nil
+	}
+
+	i := &Introspection{Channels: channels, Patterns: patterns}
+	for _, channel := range desired {
+		if channel.Kind == "PSUBSCRIBE" {
+			i.WantPatterns++
+		} else {
+			i.WantChannels++
+		}
+	}
+	return i
+}
+
+// parseClientInfo splits the first line of a CLIENT LIST reply into its name=value fields
+func parseClientInfo(text string) map[string]string {
+	line, _, _ := strings.Cut(text, "\n")
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(line) {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// SetReconcileInterval runs Reconcile periodically, zero disables it which is the default
+func (r *Reconnecting) SetReconcileInterval(interval time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reconcileInterval = interval
+}
+
+func (r *Reconnecting) getReconcileInterval() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.reconcileInterval
+}
+
+func (r *Reconnecting) handleReconcile() {
+	for {
+		interval := r.getReconcileInterval()
+		enabled := interval > 0
+		if !enabled {
+			interval = time.Second
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-time.After(interval):
+			if enabled {
+				r.Reconcile()
+			}
+		}
+	}
+}
+
+// batchUnsubscriptions is batchSubscriptions for UNSUBSCRIBE and PUNSUBSCRIBE
+func batchUnsubscriptions(channels []ReconnectingChannel, size int) [][]byte {
+	var batches [][]byte
+	for _, batch := range groupByKind(channels, size) {
+		verb := "UNSUBSCRIBE"
+		if batch[0].Kind == "PSUBSCRIBE" {
+			verb = "PUNSUBSCRIBE"
+		}
+		batches = append(batches, formatBatch(verb, batch))
+	}
+	return batches
+}
+
+func formatBatch(verb string, channels []ReconnectingChannel) []byte {
+	args := make([]string, 0, len(channels)+1)
+	args = append(args, verb)
+	for _, channel := range channels {
+		args = append(args, channel.Channel)
+	}
+	return command.FormatCommand(args...)
+}
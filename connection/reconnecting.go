@@ -1,13 +1,18 @@
 package connection
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/Moonlight-Companies/goresp/codec"
 	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/glob"
 	"github.com/Moonlight-Companies/goresp/logging"
 	"github.com/Moonlight-Companies/goresp/resp"
 )
@@ -17,45 +22,96 @@ const (
 	maxReconnectDelay   = 30 * time.Second
 )
 
+// ErrNotConnected is returned by SendWait when the connection was down, or failed, by the time
+// the command was due to be written. The command was not sent
+var ErrNotConnected = errors.New("not connected")
+
+// outgoing is a queued command, written reports the outcome to SendWait
+type outgoing struct {
+	data    []byte
+	written chan error
+}
+
 type ReconnectingChannel struct {
 	Channel string
 	Kind    string
 }
 
+// received is data read from the connection of a generation, the decoder is reset when the
+// generation changes so a new connection never continues a reply cut by the old one
+type received struct {
+	generation uint64
+	data       []byte
+	clientID   bool
+}
+
 type Reconnecting struct {
-	logger         *logging.Logger
-	addr           string
-	conn           net.Conn
-	decoder        *resp.Decode
-	lastData       time.Time
-	connected      bool
-	mutex          sync.Mutex
-	done           chan struct{}
-	data           chan []byte
-	commands       chan []byte
-	reconnectDelay time.Duration
-	channels       sync.Map
-	Messages       chan BusMessage
+	logger              *logging.Logger
+	addr                string
+	healthCheckInterval time.Duration
+	batchSize           int
+	reconcileInterval   time.Duration
+	conn                net.Conn
+	generation          uint64
+	decoder             *resp.Decode
+	streamThreshold     int
+	streaming           io.Closer
+	lastData            time.Time
+	connected           bool
+	mutex               sync.Mutex
+	done                chan struct{}
+	data                chan received
+	commands            chan outgoing
+	reconnectDelay      time.Duration
+	registry            *subscriptionRegistry
+	resubscribing       resubscription
+	acked               *ackState
+	router              *router
+	codecs              *codec.Registry
+	connectHooks        []func()
+	disconnectHooks     []func()
+	onClientID          func(id int64)
+	clientIDPending     bool
+	clientIDRequested   bool
+	clientID            int64
+	reconcileClient     *Client
+	onInvalidate        func(keys []string)
+	Messages            chan BusMessage
 }
 
 func NewReconnecting(addr string) *Reconnecting {
-	result := &Reconnecting{
-		logger:         logging.NewLogger(logging.LogLevelInfo),
-		addr:           addr,
-		decoder:        &resp.Decode{},
-		done:           make(chan struct{}),
-		reconnectDelay: time.Second,
-		data:           make(chan []byte, 255),
-		commands:       make(chan []byte, 255),
-		Messages:       make(chan BusMessage, 255),
-	}
+	r := newReconnecting(addr)
+	r.start()
+	return r
+}
 
-	go result.handleReconnect()
-	go result.handleHealthCheck()
-	go result.handleData()
-	go result.handleSend()
+// newReconnecting returns a Reconnecting that connects once started, so a Cache can set
+// onClientID and onInvalidate first
+func newReconnecting(addr string) *Reconnecting {
+	return &Reconnecting{
+		logger:              logging.NewLogger(logging.LogLevelInfo),
+		addr:                addr,
+		healthCheckInterval: healthCheckInterval,
+		batchSize:           defaultResubscribeBatchSize,
+		decoder:             &resp.Decode{},
+		done:                make(chan struct{}),
+		reconnectDelay:      time.Second,
+		data:                make(chan received, 255),
+		commands:            make(chan outgoing, 255),
+		registry:            newSubscriptionRegistry(),
+		acked:               newAckState(),
+		router:              newRouter(),
+		codecs:              codec.NewRegistry(codec.JSON),
+		Messages:            make(chan BusMessage, 255),
+	}
+}
 
-	return result
+func (r *Reconnecting) start() {
+	go r.handleReconnect()
+	go r.handleHealthCheck()
+	go r.handleData()
+	go r.handleSend()
+	go r.handleReconcile()
 }
 
 func (r *Reconnecting) Close() {
@@ -63,44 +119,121 @@ func (r *Reconnecting) Close() {
 	r.disconnect()
 }
 
-func (r *Reconnecting) onConnect() {
+func (r *Reconnecting) onConnect(conn net.Conn) error {
 	r.Send(command.FormatCommand("PING"))
 
-	r.channels.Range(func(key, value interface{}) bool {
-		channelItem := value.(ReconnectingChannel)
-		switch channelItem.Kind {
-		case "SUBSCRIBE":
-			r.subscribe(channelItem.Channel)
-		case "PSUBSCRIBE":
-			r.psubscribe(channelItem.Channel)
+	if err := r.resubscribe(conn); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	hooks := r.connectHooks
+	r.mutex.Unlock()
+	for _, fn := range hooks {
+		go fn()
+	}
+	return nil
+}
+
+// OnConnect registers fn to run on its own goroutine every time a connection is established,
+// after the subscriptions are restored. Use it to restore server state a restart loses
+func (r *Reconnecting) OnConnect(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.connectHooks = append(r.connectHooks, fn)
+}
+
+// resubscribe restores the registered subscriptions in batches. They are written to conn
+// directly, the command queue is too small to hold thousands of them
+func (r *Reconnecting) resubscribe(conn net.Conn) error {
+	channels := r.registry.list()
+	if len(channels) == 0 {
+		return nil
+	}
+
+	r.resubscribing.start(channels)
+	r.acked.expect(channels)
+	batches := batchSubscriptions(channels, r.getResubscribeBatchSize())
+	for _, batch := range batches {
+		if _, err := conn.Write(batch); err != nil {
+			return err
 		}
-		return true
-	})
+	}
+
+	r.logger.Info("Resubscribing to %d channels and patterns in %d commands", len(channels), len(batches))
+	return nil
+}
+
+// SetResubscribeBatchSize changes how many channels or patterns are sent per SUBSCRIBE or
+// PSUBSCRIBE command when subscriptions are restored after a reconnect
+func (r *Reconnecting) SetResubscribeBatchSize(size int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if size < 1 {
+		size = 1
+	}
+	r.batchSize = size
+}
+
+func (r *Reconnecting) getResubscribeBatchSize() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.batchSize
+}
+
+// onAck tracks the server side subscriptions and checks the subscription count once every restored subscription is acknowledged
+func (r *Reconnecting) onAck(ack *subscriptionAck) {
+	r.acked.apply(ack)
+
+	count, expected, done := r.resubscribing.ack(ack)
+	if !done {
+		return
+	}
+
+	if count != int64(expected) {
+		r.logger.Warn("Resubscribed to %d channels and patterns but the server reports %d", expected, count)
+		return
+	}
+	r.logger.Info("Resubscribed to %d channels and patterns", expected)
 }
 
 func (r *Reconnecting) onDisconnect() {
 	r.logger.Info("Disconnected from Redis")
-}
 
-func (r *Reconnecting) Subscribe(channels ...string) {
-	for _, channel := range channels {
-		if _, loaded := r.channels.LoadOrStore(channel, ReconnectingChannel{Channel: channel, Kind: "SUBSCRIBE"}); !loaded {
-			r.subscribe(channel)
-		}
+	r.mutex.Lock()
+	hooks := r.disconnectHooks
+	r.mutex.Unlock()
+	for _, fn := range hooks {
+		fn()
 	}
 }
 
+// OnDisconnect registers fn to run when the connection is lost, before reconnecting. Messages
+// published meanwhile are missed
+func (r *Reconnecting) OnDisconnect(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.disconnectHooks = append(r.disconnectHooks, fn)
+}
+
+// Subscribe subscribes to channels and returns a handle holding a reference to them.
+// Messages go to Messages unless the handle's own Messages channel is used
+func (r *Reconnecting) Subscribe(channels ...string) *Subscription {
+	return r.newSubscription("SUBSCRIBE", channels)
+}
+
 func (r *Reconnecting) subscribe(channel string) {
 	cmd := command.FormatCommand("SUBSCRIBE", channel)
 	r.Send(cmd)
 }
 
-func (r *Reconnecting) PSubscribe(patterns ...string) {
-	for _, pattern := range patterns {
-		if _, loaded := r.channels.LoadOrStore(pattern, ReconnectingChannel{Channel: pattern, Kind: "PSUBSCRIBE"}); !loaded {
-			r.psubscribe(pattern)
-		}
-	}
+// PSubscribe subscribes to patterns and returns a handle holding a reference to them
+func (r *Reconnecting) PSubscribe(patterns ...string) *Subscription {
+	return r.newSubscription("PSUBSCRIBE", patterns)
 }
 
 func (r *Reconnecting) psubscribe(pattern string) {
@@ -108,24 +241,29 @@ func (r *Reconnecting) psubscribe(pattern string) {
 	r.Send(cmd)
 }
 
+// Unsubscribe drops channels no matter how many handles still hold them,
+// prefer Subscription.Close when several components share the connection
 func (r *Reconnecting) Unsubscribe(channels ...string) {
 	for _, channel := range channels {
-		if _, loaded := r.channels.LoadAndDelete(channel); loaded {
-			r.unsubscribe(channel)
-		}
+		r.registry.remove(ReconnectingChannel{Channel: channel, Kind: "SUBSCRIBE"}, r.sendUnsubscribe)
 	}
 }
 
+// Subscriptions returns the channels and patterns restored after every reconnect,
+// patterns last. This is the desired state, not what the server acknowledged
+func (r *Reconnecting) Subscriptions() []ReconnectingChannel {
+	return r.registry.list()
+}
+
 func (r *Reconnecting) unsubscribe(channel string) {
 	cmd := command.FormatCommand("UNSUBSCRIBE", channel)
 	r.Send(cmd)
 }
 
+// PUnsubscribe drops patterns no matter how many handles still hold them
 func (r *Reconnecting) PUnsubscribe(patterns ...string) {
 	for _, pattern := range patterns {
-		if _, loaded := r.channels.LoadAndDelete(pattern); loaded {
-			r.punsubscribe(pattern)
-		}
+		r.registry.remove(ReconnectingChannel{Channel: pattern, Kind: "PSUBSCRIBE"}, r.sendUnsubscribe)
 	}
 }
 
@@ -134,22 +272,121 @@ func (r *Reconnecting) punsubscribe(pattern string) {
 	r.Send(cmd)
 }
 
+// Handle registers fn for messages of a channel, or of a pattern when channelOrPattern contains
+// glob syntax, subscribing to it if needed. Messages with a handler are not sent to Messages.
+// fn runs on its own goroutine, in order, unless WithWorkers spreads channels over several
+func (r *Reconnecting) Handle(channelOrPattern string, fn func(BusMessage), options ...HandlerOption) *Handler {
+	key := routeKey{Kind: "SUBSCRIBE", Name: channelOrPattern}
+	if glob.IsPattern(channelOrPattern) {
+		key.Kind = "PSUBSCRIBE"
+	}
+
+	entry := r.acquire(ReconnectingChannel{Channel: key.Name, Kind: key.Kind})
+	return r.route(key, fn, options, entry)
+}
+
+// route registers a handler, entry is the subscription reference it releases on Remove
+func (r *Reconnecting) route(key routeKey, fn func(BusMessage), options []HandlerOption, entry *registryEntry) *Handler {
+	h := newHandler(r, key, fn, options)
+	h.entry = entry
+	r.router.add(h)
+	return h
+}
+
+func (r *Reconnecting) removeHandler(h *Handler) {
+	r.router.remove(h)
+	if h.entry != nil {
+		r.registry.release(h.entry, false, r.sendUnsubscribe)
+	}
+}
+
+// acquire takes a handler's reference on a subscription, subscribing on the first one
+func (r *Reconnecting) acquire(channelItem ReconnectingChannel) *registryEntry {
+	entries := r.registry.acquire([]ReconnectingChannel{channelItem}, false, func(first []ReconnectingChannel) {
+		r.sendSubscribe(first[0])
+	})
+	return entries[0]
+}
+
+func (r *Reconnecting) sendSubscribe(channelItem ReconnectingChannel) {
+	r.acked.expect([]ReconnectingChannel{channelItem})
+	switch channelItem.Kind {
+	case "SUBSCRIBE":
+		r.subscribe(channelItem.Channel)
+	case "PSUBSCRIBE":
+		r.psubscribe(channelItem.Channel)
+	}
+}
+
+func (r *Reconnecting) sendUnsubscribe(channelItem ReconnectingChannel) {
+	r.acked.expect([]ReconnectingChannel{channelItem})
+	switch channelItem.Kind {
+	case "SUBSCRIBE":
+		r.unsubscribe(channelItem.Channel)
+	case "PSUBSCRIBE":
+		r.punsubscribe(channelItem.Channel)
+	}
+}
+
 func (r *Reconnecting) Send(cmd []byte) {
 	select {
-	case r.commands <- cmd:
+	case r.commands <- outgoing{data: cmd}:
 		r.logger.Debug("Sent command: %s", cmd)
 	default:
 		r.logger.Warn("Command queue full, dropping command: %s", cmd)
 	}
 }
 
+// SendContext is Send waiting for room in the command queue until ctx is done. Commands are
+// still dropped when the connection is down by the time they are written
+func (r *Reconnecting) SendContext(ctx context.Context, cmd []byte) error {
+	select {
+	case r.commands <- outgoing{data: cmd}:
+		r.logger.Debug("Sent command: %s", cmd)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendWait is SendContext waiting until the command is written to the connection, it returns
+// ErrNotConnected when the command was dropped instead and can be sent again. ctx bounds the
+// wait for room in the queue only, once queued the outcome is always reported so a command is
+// never both written and reported as failed. A write blocked by a stalled server ends when the
+// health check drops the connection
+func (r *Reconnecting) SendWait(ctx context.Context, cmd []byte) error {
+	written := make(chan error, 1)
+	select {
+	case r.commands <- outgoing{data: cmd, written: written}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-written
+}
+
+// Connected reports whether the connection is currently up
+func (r *Reconnecting) Connected() bool {
+	return r.currentConn() != nil
+}
+
+// currentConn returns the connection, nil while disconnected
+func (r *Reconnecting) currentConn() net.Conn {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.connected {
+		return nil
+	}
+	return r.conn
+}
+
 func (r *Reconnecting) handleReconnect() {
 	for {
 		select {
 		case <-r.done:
 			return
 		default:
-			if !r.isConnected() {
+			if !r.Connected() {
 				if err := r.connect_and_produce_data(); err != nil {
 					r.logger.Error("Failed to connect: %v", err)
 					time.Sleep(r.reconnectDelay)
@@ -163,32 +400,72 @@ func (r *Reconnecting) handleReconnect() {
 	}
 }
 
-func (r *Reconnecting) handleHealthCheck() {
-	ticker := time.NewTicker(healthCheckInterval)
-	defer ticker.Stop()
+// SetCodec chooses the codec messages of a channel, or of channels matching a pattern, are
+// decoded with by BusMessage.Unmarshal, IntoMap and Decode. Channels without one use JSON
+func (r *Reconnecting) SetCodec(channelOrPattern string, c codec.Codec) {
+	r.codecs.Set(channelOrPattern, c)
+}
 
+// SetStreamThreshold makes messages whose payload has at least n bytes arrive with Body set
+// instead of Data, so large payloads are not held in memory. 0, the default, disables
+// streaming
+func (r *Reconnecting) SetStreamThreshold(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.streamThreshold = n
+}
+
+func (r *Reconnecting) getStreamThreshold() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.streamThreshold
+}
+
+// SetHealthCheckInterval changes how often the connection is checked for silence. A PING is
+// sent after one interval without data and the connection is dropped after four
+func (r *Reconnecting) SetHealthCheckInterval(interval time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.healthCheckInterval = interval
+}
+
+func (r *Reconnecting) getHealthCheckInterval() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.healthCheckInterval
+}
+
+func (r *Reconnecting) handleHealthCheck() {
 	for {
 		select {
 		case <-r.done:
 			return
-		case <-ticker.C:
+		case <-time.After(r.getHealthCheckInterval()):
 			r.healthCheck()
 		}
 	}
 }
 
 func (r *Reconnecting) healthCheck() {
-	if !r.isConnected() {
+	r.mutex.Lock()
+	connected, silence, healthCheckInterval := r.connected, time.Since(r.lastData), r.healthCheckInterval
+	r.mutex.Unlock()
+
+	if !connected {
 		return
 	}
 
-	if time.Since(r.lastData) > 4*healthCheckInterval {
+	if silence > 4*healthCheckInterval {
 		r.logger.Warn("No data received for a while, disconnecting")
 		r.disconnect()
 		return
 	}
 
-	if time.Since(r.lastData) > healthCheckInterval {
+	if silence > healthCheckInterval {
 		randomString := fmt.Sprintf("%d", rand.Int())
 		pingCmd := command.FormatCommand("PING", randomString)
 		r.Send(pingCmd)
@@ -197,13 +474,18 @@ func (r *Reconnecting) healthCheck() {
 
 func (r *Reconnecting) handleSend() {
 	for cmd := range r.commands {
-		if r.isConnected() {
-			_, err := r.conn.Write([]byte(cmd))
-			if err != nil {
-				r.logger.Error("Failed to send command: %v", err)
+		err := ErrNotConnected
+		if conn := r.currentConn(); conn != nil {
+			if _, writeErr := conn.Write(cmd.data); writeErr != nil {
+				r.logger.Error("Failed to send command: %v", writeErr)
 				r.disconnect()
+			} else {
+				err = nil
 			}
 		}
+		if cmd.written != nil {
+			cmd.written <- err
+		}
 	}
 }
 
@@ -213,36 +495,66 @@ func (r *Reconnecting) connect_and_produce_data() error {
 		return err
 	}
 
+	// RESP2 only allows CLIENT ID before the connection subscribes. It is written before
+	// handleSend can use the connection so its reply is the first one, and only when the
+	// Cache or reconciliation needs the ID
+	r.mutex.Lock()
+	wantID := r.onClientID != nil || r.reconcileClient != nil
+	r.mutex.Unlock()
+	if wantID {
+		if _, err := conn.Write(command.FormatCommand("CLIENT", "ID")); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
 	r.mutex.Lock()
 	r.conn = conn
+	r.clientIDRequested = wantID
+	r.generation++
+	generation := r.generation
+	r.clientID = 0
 	r.connected = true
 	r.lastData = time.Now()
-	r.decoder.Reset()
+	r.acked.reset()
 	r.mutex.Unlock()
 
 	defer func() {
-		r.conn.Close()
+		conn.Close()
+		r.mutex.Lock()
 		r.conn = nil
 		r.connected = false
+		streaming := r.streaming
+		r.streaming = nil
+		r.mutex.Unlock()
+		// handleData may be waiting for the body to be read, it can't be completed anymore
+		if streaming != nil {
+			streaming.Close()
+		}
 		r.onDisconnect()
 	}()
 
 	r.logger.Info("Connected to Redis")
-	r.onConnect()
+	if err := r.onConnect(conn); err != nil {
+		r.logger.Error("Failed to resubscribe: %v", err)
+		return err
+	}
 
 	for {
 		buffer := make([]byte, 16384)
-		n, err := r.conn.Read(buffer)
+		n, err := conn.Read(buffer)
 		if err != nil {
 			r.logger.Error("Read failed: %v", err)
 			return err
 		}
 
+		r.mutex.Lock()
 		r.lastData = time.Now()
+		r.mutex.Unlock()
 		r.logger.Debug("RECEIVED %s", string(buffer[:n]))
 
 		select {
-		case r.data <- buffer[:n]:
+		case r.data <- received{generation: generation, data: buffer[:n], clientID: wantID}:
 		default:
 			r.logger.Warn("Data queue full, aborting connection")
 			return nil
@@ -256,21 +568,56 @@ func (r *Reconnecting) disconnect() {
 
 	if c := r.conn; c != nil {
 		c.Close()
-		r.decoder.Reset()
 	}
 }
 
-func (r *Reconnecting) isConnected() bool {
-	return r.conn != nil && r.connected
+// setStreaming records the body handleData is about to feed so a disconnect can release it,
+// false when the connection already dropped
+func (r *Reconnecting) setStreaming(body io.Closer) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.connected {
+		return false
+	}
+	r.streaming = body
+	return true
+}
+
+func (r *Reconnecting) setClientID(id int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.clientID = id
+}
+
+// isCurrent reports whether generation is the connection still up
+func (r *Reconnecting) isCurrent(generation uint64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.connected && r.generation == generation
 }
 
+// handleData owns the decoder and clientIDPending. Data of a dropped connection is discarded, and so is the rest
+// of a connection's data after a parse error
 func (r *Reconnecting) handleData() {
-	for data := range r.data {
-		if r.isConnected() {
-			r.decoder.Provide(data)
-			r.parse()
-		} else {
+	var decoding, failed uint64
+	for chunk := range r.data {
+		if chunk.generation != decoding {
 			r.decoder.Reset()
+			r.clientIDPending = chunk.clientID
+			decoding = chunk.generation
+		}
+		if chunk.generation == failed || !r.isCurrent(chunk.generation) {
+			continue
+		}
+
+		r.decoder.SetStreamThreshold(r.getStreamThreshold())
+		r.decoder.Provide(chunk.data)
+		if err := r.parse(); err != nil {
+			r.decoder.Reset()
+			failed = chunk.generation
 		}
 	}
 }
@@ -288,8 +635,45 @@ func (r *Reconnecting) parse() error {
 			return nil
 		}
 
+		if r.clientIDPending {
+			r.clientIDPending = false
+			if id, ok := value.(*resp.RESPInteger); ok {
+				r.setClientID(id.Value)
+				if r.onClientID != nil {
+					r.onClientID(id.Value)
+				}
+				continue
+			}
+			if e, ok := value.(*resp.RESPError); ok {
+				// a server without CLIENT ID, the connection just goes without its ID
+				r.logger.Debug("CLIENT ID failed: %v", e.Value)
+				continue
+			}
+			r.logger.Warn("Unexpected reply to CLIENT ID: %v", value)
+		}
+
 		message, ok := ParseMessage(value)
 		if !ok {
+			closeStream(value)
+			if ack, ok := parseAck(value); ok {
+				r.onAck(ack)
+			} else if keys, ok := parseInvalidation(value); ok && r.onInvalidate != nil {
+				r.onInvalidate(keys)
+			}
+			continue
+		}
+
+		if message.Body != nil && !r.setStreaming(message.Body) {
+			message.Body.Close()
+			continue
+		}
+
+		message.Codec = r.codecs.For(message.Channel)
+		if err := message.unwrap(); err != nil {
+			r.logger.Warn("Delivering malformed envelope on %s as is: %v", message.Channel, err)
+		}
+
+		if r.router.dispatch(*message) && !r.registry.isShared(keyForMessage(*message)) {
 			continue
 		}
 
@@ -0,0 +1,138 @@
+package connection
+
+import (
+	"sort"
+	"sync"
+)
+
+// registryKey keeps a channel and a pattern with the same name apart
+func registryKey(channel ReconnectingChannel) routeKey {
+	return routeKey{Kind: channel.Kind, Name: channel.Channel}
+}
+
+// registryEntry is one desired server side subscription and the number of handles holding it.
+// shared counts the Subscriptions among them delivering to Reconnecting.Messages
+type registryEntry struct {
+	channel ReconnectingChannel
+	refs    int
+	shared  int
+}
+
+// subscriptionRegistry is the set of subscriptions restored after every reconnect
+type subscriptionRegistry struct {
+	mutex   sync.Mutex
+	entries map[routeKey]*registryEntry
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{
+		entries: make(map[routeKey]*registryEntry),
+	}
+}
+
+// acquire adds a reference to each subscription, shared when the handle delivers to
+// Reconnecting.Messages. subscribe is called with the subscriptions nobody held yet. It runs
+// under the registry lock like the unsubscribe of release and remove, so SUBSCRIBE and
+// UNSUBSCRIBE are queued in the order the references changed
+func (reg *subscriptionRegistry) acquire(channels []ReconnectingChannel, shared bool, subscribe func(first []ReconnectingChannel)) []*registryEntry {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	entries := make([]*registryEntry, 0, len(channels))
+	var first []ReconnectingChannel
+	for _, channel := range channels {
+		key := registryKey(channel)
+		entry, ok := reg.entries[key]
+		if !ok {
+			entry = &registryEntry{channel: channel}
+			reg.entries[key] = entry
+			first = append(first, channel)
+		}
+		entry.refs++
+		if shared {
+			entry.shared++
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(first) > 0 {
+		subscribe(first)
+	}
+	return entries
+}
+
+// release drops a reference, calling unsubscribe after the last one. Entries that were
+// removed in the meantime are ignored
+func (reg *subscriptionRegistry) release(entry *registryEntry, shared bool, unsubscribe func(ReconnectingChannel)) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	key := registryKey(entry.channel)
+	if reg.entries[key] != entry {
+		return
+	}
+
+	entry.refs--
+	if shared {
+		entry.shared--
+	}
+	if entry.refs > 0 {
+		return
+	}
+	delete(reg.entries, key)
+	unsubscribe(entry.channel)
+}
+
+// unshare turns a shared reference into one that no longer delivers to Reconnecting.Messages
+func (reg *subscriptionRegistry) unshare(entry *registryEntry) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	entry.shared--
+}
+
+// isShared reports whether a handle holding the subscription delivers to Reconnecting.Messages
+func (reg *subscriptionRegistry) isShared(key routeKey) bool {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	entry, ok := reg.entries[key]
+	return ok && entry.shared > 0
+}
+
+// remove drops the subscription regardless of the references held on it, calling unsubscribe
+// when it was registered
+func (reg *subscriptionRegistry) remove(channel ReconnectingChannel, unsubscribe func(ReconnectingChannel)) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	key := registryKey(channel)
+	if _, ok := reg.entries[key]; !ok {
+		return
+	}
+	delete(reg.entries, key)
+	unsubscribe(channel)
+}
+
+// list returns the registered subscriptions sorted by kind and name
+func (reg *subscriptionRegistry) list() []ReconnectingChannel {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	channels := make([]ReconnectingChannel, 0, len(reg.entries))
+	for _, entry := range reg.entries {
+		channels = append(channels, entry.channel)
+	}
+	sortChannels(channels)
+	return channels
+}
+
+// sortChannels orders channels before patterns, each by name
+func sortChannels(channels []ReconnectingChannel) {
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Kind != channels[j].Kind {
+			return channels[i].Kind > channels[j].Kind
+		}
+		return channels[i].Channel < channels[j].Channel
+	})
+}
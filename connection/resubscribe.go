@@ -0,0 +1,68 @@
+package connection
+
+import (
+	"sync"
+)
+
+const defaultResubscribeBatchSize = 100
+
+// resubscription tracks the acks of the subscriptions restored after a connect
+type resubscription struct {
+	mutex    sync.Mutex
+	pending  map[routeKey]bool
+	expected int
+}
+
+// start forgets any unfinished resubscription and waits for acks of channels instead
+func (rs *resubscription) start(channels []ReconnectingChannel) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rs.pending = make(map[routeKey]bool, len(channels))
+	for _, channel := range channels {
+		rs.pending[registryKey(channel)] = true
+	}
+	rs.expected = len(rs.pending)
+}
+
+// ack marks a subscription as acknowledged, done is true for the last pending one and
+// count is then the server's subscription count against expected
+func (rs *resubscription) ack(a *subscriptionAck) (count int64, expected int, done bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := routeKey{Kind: a.Kind, Name: a.Name}
+	if !rs.pending[key] {
+		return 0, 0, false
+	}
+	delete(rs.pending, key)
+	return a.Count, rs.expected, len(rs.pending) == 0
+}
+
+// batchSubscriptions encodes channels as SUBSCRIBE and PSUBSCRIBE commands of at most size
+// names each. channels must be grouped by kind, as returned by the registry
+func batchSubscriptions(channels []ReconnectingChannel, size int) [][]byte {
+	var batches [][]byte
+	for _, batch := range groupByKind(channels, size) {
+		batches = append(batches, formatBatch(batch[0].Kind, batch))
+	}
+	return batches
+}
+
+// groupByKind splits runs of the same kind into groups of at most size
+func groupByKind(channels []ReconnectingChannel, size int) [][]ReconnectingChannel {
+	if size < 1 {
+		size = 1
+	}
+
+	var groups [][]ReconnectingChannel
+	for start := 0; start < len(channels); {
+		end := start
+		for end < len(channels) && channels[end].Kind == channels[start].Kind && end-start < size {
+			end++
+		}
+		groups = append(groups, channels[start:end])
+		start = end
+	}
+	return groups
+}
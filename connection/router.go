@@ -0,0 +1,232 @@
+package connection
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const handlerQueueSize = 255
+
+// dropLogInterval is how often a handler dropping messages logs its count
+const dropLogInterval = 10 * time.Second
+
+type routeKey struct {
+	Kind string
+	Name string
+}
+
+// keyForMessage returns the subscription a message was delivered for, the originating
+// pattern for pmessage and the channel for message
+func keyForMessage(msg BusMessage) routeKey {
+	if msg.Pattern != "" {
+		return routeKey{Kind: "PSUBSCRIBE", Name: msg.Pattern}
+	}
+	return routeKey{Kind: "SUBSCRIBE", Name: msg.Channel}
+}
+
+type handlerConfig struct {
+	workers    int
+	dropOnFull bool
+}
+
+// HandlerOption configures a handler registered with Reconnecting.Handle
+type HandlerOption func(*handlerConfig)
+
+// WithWorkers runs the handler on n goroutines. Messages of the same channel always go to
+// the same worker so they are still handled in order, different channels run in parallel
+func WithWorkers(n int) HandlerOption {
+	return func(c *handlerConfig) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithDropOnFull drops messages arriving while the handler's queue is full instead of waiting
+// for room, so a slow handler never holds up the connection or the other handlers. Dropped
+// counts them
+func WithDropOnFull() HandlerOption {
+	return func(c *handlerConfig) {
+		c.dropOnFull = true
+	}
+}
+
+// Handler is a callback registered for a channel or pattern. Each worker has a queue of
+// handlerQueueSize messages, a message arriving while it is full waits for room like one for a
+// Subscription does, unless the handler was registered WithDropOnFull
+type Handler struct {
+	owner       *Reconnecting
+	key         routeKey
+	entry       *registryEntry
+	fn          func(BusMessage)
+	dropOnFull  bool
+	mutex       sync.Mutex
+	removed     bool
+	done        chan struct{}
+	delivering  sync.WaitGroup
+	queues      []chan BusMessage
+	dropped     atomic.Uint64
+	lastDropLog time.Time
+	once        sync.Once
+	wg          sync.WaitGroup
+}
+
+func newHandler(owner *Reconnecting, key routeKey, fn func(BusMessage), options []HandlerOption) *Handler {
+	config := handlerConfig{workers: 1}
+	for _, option := range options {
+		option(&config)
+	}
+
+	h := &Handler{
+		owner:      owner,
+		key:        key,
+		fn:         fn,
+		dropOnFull: config.dropOnFull,
+		done:       make(chan struct{}),
+		queues:     make([]chan BusMessage, config.workers),
+	}
+	for i := range h.queues {
+		h.queues[i] = make(chan BusMessage, handlerQueueSize)
+		h.wg.Add(1)
+		go h.work(h.queues[i])
+	}
+	return h
+}
+
+// Remove unregisters the handler, messages already queued are still handled and one waiting
+// for room is discarded. The handler holds a reference on its subscription like a Subscription
+// does, removing the last reference unsubscribes
+func (h *Handler) Remove() {
+	h.once.Do(func() {
+		h.owner.removeHandler(h)
+
+		h.mutex.Lock()
+		h.removed = true
+		h.mutex.Unlock()
+
+		// release a deliver waiting for room before closing the queues it sends on
+		close(h.done)
+		h.delivering.Wait()
+		for _, queue := range h.queues {
+			close(queue)
+		}
+	})
+}
+
+// Dropped returns how many messages were discarded because the queue of a handler registered
+// WithDropOnFull was full
+func (h *Handler) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+func (h *Handler) work(queue chan BusMessage) {
+	defer h.wg.Done()
+
+	for msg := range queue {
+		h.fn(msg)
+	}
+}
+
+// wait blocks until the queued messages have been handled after Remove
+func (h *Handler) wait() {
+	h.wg.Wait()
+}
+
+// deliver queues msg, waiting for room in a full queue until the handler is removed. With
+// dropOnFull the message is dropped instead
+func (h *Handler) deliver(msg BusMessage) {
+	queue := h.queues[0]
+	if len(h.queues) > 1 {
+		hash := fnv.New32a()
+		hash.Write([]byte(msg.Channel))
+		queue = h.queues[hash.Sum32()%uint32(len(h.queues))]
+	}
+
+	h.mutex.Lock()
+	if h.removed {
+		h.mutex.Unlock()
+		return
+	}
+	h.delivering.Add(1)
+	h.mutex.Unlock()
+	defer h.delivering.Done()
+
+	if !h.dropOnFull {
+		select {
+		case queue <- msg:
+		case <-h.done:
+		}
+		return
+	}
+
+	select {
+	case queue <- msg:
+	default:
+		h.logDrop(h.dropped.Add(1))
+	}
+}
+
+// logDrop warns about a full queue on the first drop and then every dropLogInterval, with the
+// count so far
+func (h *Handler) logDrop(dropped uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if now := time.Now(); now.Sub(h.lastDropLog) >= dropLogInterval {
+		h.lastDropLog = now
+		h.owner.logger.Warn("Handler queue for %s full, %d messages dropped", h.key.Name, dropped)
+	}
+}
+
+// router dispatches messages to the handlers of the subscription they arrived for
+type router struct {
+	mutex  sync.RWMutex
+	routes map[routeKey][]*Handler
+}
+
+func newRouter() *router {
+	return &router{
+		routes: make(map[routeKey][]*Handler),
+	}
+}
+
+func (rt *router) add(h *Handler) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	rt.routes[h.key] = append(rt.routes[h.key], h)
+}
+
+func (rt *router) remove(h *Handler) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	handlers := rt.routes[h.key]
+	for i, candidate := range handlers {
+		if candidate == h {
+			handlers = append(handlers[:i:i], handlers[i+1:]...)
+			break
+		}
+	}
+
+	if len(handlers) == 0 {
+		delete(rt.routes, h.key)
+		return
+	}
+	rt.routes[h.key] = handlers
+}
+
+// dispatch hands msg to every handler of its subscription, false when there are none. The
+// handlers are delivered to outside the lock so one can Remove itself meanwhile
+func (rt *router) dispatch(msg BusMessage) bool {
+	rt.mutex.RLock()
+	handlers := rt.routes[keyForMessage(msg)]
+	rt.mutex.RUnlock()
+
+	for _, h := range handlers {
+		h.deliver(msg)
+	}
+	return len(handlers) > 0
+}
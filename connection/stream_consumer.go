@@ -0,0 +1,361 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/logging"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+const (
+	defaultStreamReadCount = 10
+	defaultStreamBlock     = 5 * time.Second
+	defaultClaimIdle       = time.Minute
+
+	// streamCommandTimeout bounds every stream command, on top of the BLOCK time of a read
+	streamCommandTimeout = 10 * time.Second
+	// streamRetryDelay paces the retries after a failed command
+	streamRetryDelay = time.Second
+)
+
+// ConsumerOption configures a StreamConsumer
+type ConsumerOption func(*StreamConsumer)
+
+// WithReadCount sets how many entries are read per stream and command, 10 by default
+func WithReadCount(n int) ConsumerOption {
+	return func(c *StreamConsumer) {
+		if n > 0 {
+			c.readCount = n
+		}
+	}
+}
+
+// WithBlock sets how long a read waits for new entries, 5 seconds by default. Streams passed
+// to Handle are read once the current wait is over
+func WithBlock(d time.Duration) ConsumerOption {
+	return func(c *StreamConsumer) {
+		if d > 0 {
+			c.block = d
+		}
+	}
+}
+
+// WithClaimIdle claims entries that have been pending in the group for d, whichever consumer
+// they were delivered to, and hands them to the handlers again. 1 minute by default, 0 turns
+// claiming off
+func WithClaimIdle(d time.Duration) ConsumerOption {
+	return func(c *StreamConsumer) {
+		c.claimIdle = d
+	}
+}
+
+// WithGroupStart sets the ID a group created by the consumer starts after, "$" by default so
+// only new entries are read. "0" reads the whole stream
+func WithGroupStart(id string) ConsumerOption {
+	return func(c *StreamConsumer) {
+		c.groupStart = id
+	}
+}
+
+// StreamConsumer reads streams as a consumer of a consumer group, creating the group when it
+// does not exist. Entries are passed to the handler of their stream and acknowledged with XACK
+// once it returns nil, an entry whose handler fails stays pending until it is claimed.
+//
+// After a reconnect the consumer first reads back the entries the group delivered to it after
+// the last one it received, which were lost with the connection, then goes on with new ones
+type StreamConsumer struct {
+	logger     *logging.Logger
+	client     *Client
+	group      string
+	consumer   string
+	readCount  int
+	block      time.Duration
+	claimIdle  time.Duration
+	groupStart string
+	mutex      sync.Mutex
+	handlers   map[string]func(StreamMessage) error
+	lastIDs    map[string]string
+	codecs     *codec.Registry
+	changed    chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+
+	// owned by the run goroutine
+	created    map[string]bool
+	recovering bool
+	lastClaim  time.Time
+}
+
+// NewStreamConsumer starts a consumer named consumer in group, reading from addr. Streams
+// are added with Handle
+func NewStreamConsumer(addr, group, consumer string, options ...ConsumerOption) *StreamConsumer {
+	c := &StreamConsumer{
+		logger:     logging.NewLogger(logging.LogLevelInfo),
+		client:     NewClient(addr),
+		group:      group,
+		consumer:   consumer,
+		readCount:  defaultStreamReadCount,
+		block:      defaultStreamBlock,
+		claimIdle:  defaultClaimIdle,
+		groupStart: "$",
+		handlers:   make(map[string]func(StreamMessage) error),
+		lastIDs:    make(map[string]string),
+		codecs:     codec.NewRegistry(codec.JSON),
+		changed:    make(chan struct{}, 1),
+		stopped:    make(chan struct{}),
+		created:    make(map[string]bool),
+		recovering: true,
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for _, option := range options {
+		option(c)
+	}
+
+	go c.run()
+	return c
+}
+
+// Close stops reading and closes the connection. Entries being handled are left pending
+func (c *StreamConsumer) Close() {
+	c.cancel()
+	c.client.Close()
+	<-c.stopped
+}
+
+// Handle reads stream with the consumer's group and passes its entries to fn. An entry is
+// acknowledged when fn returns nil
+func (c *StreamConsumer) Handle(stream string, fn func(StreamMessage) error) {
+	c.mutex.Lock()
+	c.handlers[stream] = fn
+	c.mutex.Unlock()
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// SetCodec chooses the codec payloads of a stream, or of streams matching a pattern, are
+// decoded with. Streams without one use JSON
+func (c *StreamConsumer) SetCodec(streamOrPattern string, cd codec.Codec) {
+	c.codecs.Set(streamOrPattern, cd)
+}
+
+// LastID returns the ID of the last entry read from stream, "0" before the first one
+func (c *StreamConsumer) LastID(stream string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if id, ok := c.lastIDs[stream]; ok {
+		return id
+	}
+	return "0"
+}
+
+func (c *StreamConsumer) streams() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	streams := make([]string, 0, len(c.handlers))
+	for stream := range c.handlers {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+func (c *StreamConsumer) handler(stream string) func(StreamMessage) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.handlers[stream]
+}
+
+func (c *StreamConsumer) run() {
+	defer close(c.stopped)
+
+	for c.ctx.Err() == nil {
+		streams := c.streams()
+		if len(streams) == 0 {
+			select {
+			case <-c.changed:
+			case <-c.ctx.Done():
+			}
+			continue
+		}
+
+		if err := c.poll(streams); err != nil && c.ctx.Err() == nil {
+			c.logger.Error("Reading streams failed: %v", err)
+
+			// the group may have gone with the server's data, and a reply may have been lost
+			// with the connection
+			c.created = make(map[string]bool)
+			c.recovering = true
+
+			select {
+			case <-time.After(streamRetryDelay):
+			case <-c.ctx.Done():
+			}
+		}
+	}
+}
+
+// poll creates missing groups, claims stale entries when it is time to and reads once
+func (c *StreamConsumer) poll(streams []string) error {
+	for _, stream := range streams {
+		if c.created[stream] {
+			continue
+		}
+		if err := c.createGroup(stream); err != nil {
+			return err
+		}
+		c.created[stream] = true
+	}
+
+	if c.claimIdle > 0 && time.Since(c.lastClaim) >= c.claimIdle {
+		for _, stream := range streams {
+			if err := c.claim(stream); err != nil {
+				return err
+			}
+		}
+		c.lastClaim = time.Now()
+	}
+
+	messages, err := c.read(streams)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		c.setLastID(msg.Channel, msg.ID)
+		if err := c.deliver(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *StreamConsumer) do(timeout time.Duration, args ...interface{}) (resp.RESPValue, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+
+	return c.client.Do(ctx, args...)
+}
+
+func (c *StreamConsumer) createGroup(stream string) error {
+	_, err := c.do(streamCommandTimeout, "XGROUP", "CREATE", stream, c.group, c.groupStart, "MKSTREAM")
+
+	var respErr *resp.RESPError
+	if errors.As(err, &respErr) && respErr.Prefix() == "BUSYGROUP" {
+		return nil
+	}
+	return err
+}
+
+// read reads new entries, or while recovering the pending ones after the last ID read
+func (c *StreamConsumer) read(streams []string) ([]StreamMessage, error) {
+	args := []interface{}{"XREADGROUP", "GROUP", c.group, c.consumer, "COUNT", c.readCount}
+	timeout := streamCommandTimeout
+
+	ids := make([]string, len(streams))
+	for i, stream := range streams {
+		ids[i] = ">"
+		if c.recovering {
+			ids[i] = c.LastID(stream)
+		}
+	}
+	if !c.recovering {
+		args = append(args, "BLOCK", c.block.Milliseconds())
+		timeout += c.block
+	}
+	args = append(args, "STREAMS", streams, ids)
+
+	value, err := c.do(timeout, args...)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := parseStreamReply(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.recovering && len(messages) == 0 {
+		c.recovering = false
+	}
+	return messages, nil
+}
+
+// claim takes over the entries of stream pending for longer than the claim idle time and
+// delivers them
+func (c *StreamConsumer) claim(stream string) error {
+	cursor := "0-0"
+	for {
+		value, err := c.do(streamCommandTimeout, "XAUTOCLAIM", stream, c.group, c.consumer, c.claimIdle.Milliseconds(), cursor, "COUNT", c.readCount)
+		if err != nil {
+			return err
+		}
+		items, err := value.AsArray()
+		if err != nil {
+			return err
+		}
+		if len(items) < 2 {
+			return errors.New("malformed XAUTOCLAIM reply")
+		}
+		if cursor, err = items[0].AsString(); err != nil {
+			return err
+		}
+		messages, err := parseStreamEntries(stream, items[1])
+		if err != nil {
+			return err
+		}
+
+		if len(messages) > 0 {
+			c.logger.Info("Claimed %d pending entries of %s", len(messages), stream)
+		}
+		for _, msg := range messages {
+			if err := c.deliver(msg); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0-0" {
+			return nil
+		}
+	}
+}
+
+// deliver runs the handler of the entry's stream and acknowledges the entry when it succeeds.
+// Only failing to acknowledge is returned
+func (c *StreamConsumer) deliver(msg StreamMessage) error {
+	// an entry deleted while pending is acknowledged, there is nothing left to handle
+	if msg.Fields != nil {
+		fn := c.handler(msg.Channel)
+		if fn == nil {
+			return nil
+		}
+
+		msg.Codec = c.codecs.For(msg.Channel)
+		if err := msg.unwrap(); err != nil {
+			c.logger.Warn("Delivering malformed envelope on %s as is: %v", msg.Channel, err)
+		}
+		if err := fn(msg); err != nil {
+			c.logger.Warn("Handler failed on %s %s, leaving it pending: %v", msg.Channel, msg.ID, err)
+			return nil
+		}
+	}
+
+	_, err := c.do(streamCommandTimeout, "XACK", msg.Channel, c.group, msg.ID)
+	return err
+}
+
+func (c *StreamConsumer) setLastID(stream, id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastIDs[stream] = id
+}
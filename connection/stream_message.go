@@ -0,0 +1,90 @@
+package connection
+
+import (
+	"fmt"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// StreamDataField is the entry field carrying the payload of a StreamMessage
+const StreamDataField = "data"
+
+// StreamMessage is a stream entry. The embedded BusMessage has the stream as its Channel and
+// the data field as its Data, so Unmarshal, IntoMap and Decode work as they do for pub/sub
+type StreamMessage struct {
+	BusMessage
+	ID string
+	// Fields holds every field of the entry, nil when it was deleted before being read
+	Fields map[string]string
+}
+
+func newStreamMessage(stream, id string, fields map[string]string) StreamMessage {
+	msg := StreamMessage{BusMessage: BusMessage{Channel: stream}, ID: id, Fields: fields}
+	if data, ok := fields[StreamDataField]; ok {
+		msg.Data = []byte(data)
+	}
+	return msg
+}
+
+// parseStreamEntries parses a list of [id, [field, value, ...]] entries, skipping the nil
+// placeholders older servers reply with for deleted entries
+func parseStreamEntries(stream string, value resp.RESPValue) ([]StreamMessage, error) {
+	items, err := value.AsArray()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]StreamMessage, 0, len(items))
+	for _, item := range items {
+		if item.IsNil() {
+			continue
+		}
+		entry, err := item.AsArray()
+		if err != nil || len(entry) != 2 {
+			return nil, fmt.Errorf("malformed stream entry: %v", item)
+		}
+		id, err := entry[0].AsString()
+		if err != nil {
+			return nil, err
+		}
+
+		var fields map[string]string
+		if !entry[1].IsNil() {
+			if fields, err = entry[1].AsMap(); err != nil {
+				return nil, err
+			}
+		}
+		messages = append(messages, newStreamMessage(stream, id, fields))
+	}
+	return messages, nil
+}
+
+// parseStreamReply parses an XREAD or XREADGROUP reply, [[stream, entries], ...], or nil
+// when it timed out
+func parseStreamReply(value resp.RESPValue) ([]StreamMessage, error) {
+	if value.IsNil() {
+		return nil, nil
+	}
+	streams, err := value.AsArray()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []StreamMessage
+	for _, item := range streams {
+		pair, err := item.AsArray()
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("malformed stream reply: %v", item)
+		}
+		stream, err := pair[0].AsString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseStreamEntries(stream, pair[1])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, entries...)
+	}
+	return messages, nil
+}
@@ -0,0 +1,118 @@
+package connection
+
+import (
+	"sync"
+)
+
+const subscriptionQueueSize = 255
+
+// Subscription is a reference counted claim on channels or patterns of a Reconnecting.
+// Several components can subscribe to the same channel, the server side UNSUBSCRIBE is only
+// sent when the last Subscription holding it is closed
+type Subscription struct {
+	owner    *Reconnecting
+	kind     string
+	entries  []*registryEntry
+	mutex    sync.Mutex
+	handlers []*Handler
+	routed   bool
+	messages chan BusMessage
+	done     chan struct{}
+	closed   bool
+	once     sync.Once
+}
+
+func (r *Reconnecting) newSubscription(kind string, names []string) *Subscription {
+	channels := make([]ReconnectingChannel, len(names))
+	for i, name := range names {
+		channels[i] = ReconnectingChannel{Channel: name, Kind: kind}
+	}
+
+	// one command per batch instead of per name keeps large subscriptions out of the queue
+	batchSize := r.getResubscribeBatchSize()
+	entries := r.registry.acquire(channels, true, func(first []ReconnectingChannel) {
+		r.acked.expect(first)
+		for _, batch := range batchSubscriptions(first, batchSize) {
+			r.Send(batch)
+		}
+	})
+
+	return &Subscription{
+		owner:   r,
+		kind:    kind,
+		entries: entries,
+		done:    make(chan struct{}),
+	}
+}
+
+// Names returns the channels or patterns the subscription holds
+func (s *Subscription) Names() []string {
+	names := make([]string, len(s.entries))
+	for i, entry := range s.entries {
+		names[i] = entry.channel.Channel
+	}
+	return names
+}
+
+// Messages returns a channel with the messages of this subscription only. Until it is first
+// called the messages are delivered to Reconnecting.Messages, as long as another handle holding
+// the same channel without calling Messages remains they still are. The channel is closed by
+// Close
+func (s *Subscription) Messages() <-chan BusMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.messages != nil {
+		return s.messages
+	}
+
+	s.messages = make(chan BusMessage, subscriptionQueueSize)
+	if s.closed {
+		close(s.messages)
+		return s.messages
+	}
+
+	for _, entry := range s.entries {
+		key := routeKey{Kind: entry.channel.Kind, Name: entry.channel.Channel}
+		s.handlers = append(s.handlers, s.owner.route(key, s.deliver, nil, nil))
+		s.owner.registry.unshare(entry)
+	}
+	s.routed = true
+	return s.messages
+}
+
+func (s *Subscription) deliver(msg BusMessage) {
+	select {
+	case s.messages <- msg:
+	case <-s.done:
+	}
+}
+
+// Close releases the subscription, unsubscribing from anything no other Subscription or
+// handler still holds. It is safe to call more than once
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+
+		s.mutex.Lock()
+		s.closed = true
+		handlers, shared := s.handlers, !s.routed
+		s.mutex.Unlock()
+
+		for _, h := range handlers {
+			h.Remove()
+		}
+		for _, entry := range s.entries {
+			s.owner.registry.release(entry, shared, s.owner.sendUnsubscribe)
+		}
+		for _, h := range handlers {
+			h.wait()
+		}
+
+		s.mutex.Lock()
+		if s.messages != nil {
+			close(s.messages)
+		}
+		s.mutex.Unlock()
+	})
+}
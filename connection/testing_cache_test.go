@@ -0,0 +1,129 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// newCache returns a Cache whose invalidations connection is subscribed
+func newCache(t *testing.T, s *redistest.Server, capacity int) *connection.Cache {
+	t.Helper()
+
+	c := connection.NewCache(s.Addr(), capacity)
+	t.Cleanup(c.Close)
+	if !s.WaitForSubscribers("__redis__:invalidate", 1, 5*time.Second) {
+		t.Fatalf("cache did not subscribe to invalidations")
+	}
+	time.Sleep(20 * time.Millisecond)
+	return c
+}
+
+func expectGet(t *testing.T, c *connection.Cache, key, want string) {
+	t.Helper()
+
+	value, err := c.Get(context.Background(), key)
+	if err != nil || string(value) != want {
+		t.Fatalf("Get(%q) = %q, %v, want %q", key, value, err, want)
+	}
+}
+
+func TestCacheServesRepeatedReads(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("user:1", "alice")
+	c := newCache(t, s, 100)
+
+	expectGet(t, c, "user:1", "alice")
+	expectGet(t, c, "user:1", "alice")
+	if got := s.CommandCount("GET"); got != 1 {
+		t.Errorf("GET sent %d times, want 1", got)
+	}
+
+	if _, err := c.Get(context.Background(), "user:2"); err != resp.ErrNil {
+		t.Errorf("Get() of a missing key = %v, want ErrNil", err)
+	}
+	if _, err := c.Get(context.Background(), "user:2"); err != resp.ErrNil || s.CommandCount("GET") != 2 {
+		t.Errorf("missing key was not cached")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("user:1", "alice")
+	c := newCache(t, s, 100)
+
+	expectGet(t, c, "user:1", "alice")
+	s.Set("user:1", "bob")
+	if !s.WaitFor(5*time.Second, func() bool { return c.Len() == 0 }) {
+		t.Fatalf("key was not invalidated")
+	}
+	expectGet(t, c, "user:1", "bob")
+
+	if _, err := c.Client().Do(context.Background(), "SET", "user:1", "carol"); err != nil {
+		t.Fatalf("SET error = %v", err)
+	}
+	if !s.WaitFor(5*time.Second, func() bool { return c.Len() == 0 }) {
+		t.Fatalf("key was not invalidated by the cache's own write")
+	}
+	expectGet(t, c, "user:1", "carol")
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	s := redistest.NewServer(t)
+	for _, key := range []string{"a", "b", "c"} {
+		s.Set(key, key)
+	}
+	c := newCache(t, s, 2)
+
+	expectGet(t, c, "a", "a")
+	expectGet(t, c, "b", "b")
+	expectGet(t, c, "a", "a")
+	expectGet(t, c, "c", "c")
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+
+	s.ClearCommands()
+	expectGet(t, c, "a", "a")
+	expectGet(t, c, "b", "b")
+	if got := s.CommandCount("GET"); got != 1 {
+		t.Errorf("GET sent %d times, want 1 for the evicted key", got)
+	}
+}
+
+func TestCacheFlushedOnDisconnect(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("user:1", "alice")
+	c := newCache(t, s, 100)
+
+	expectGet(t, c, "user:1", "alice")
+	if c.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", c.Len())
+	}
+
+	s.DropConnections()
+	if !s.WaitFor(5*time.Second, func() bool { return c.Len() == 0 }) {
+		t.Fatalf("cache was not flushed on disconnect")
+	}
+
+	// reads are cached again once the invalidations connection is back
+	if !s.WaitForCommand("SUBSCRIBE", 2, 5*time.Second) {
+		t.Fatalf("invalidations connection did not come back")
+	}
+	s.Set("user:1", "bob")
+	if !s.WaitFor(5*time.Second, func() bool {
+		value, err := c.Get(context.Background(), "user:1")
+		return err == nil && string(value) == "bob" && c.Len() == 1
+	}) {
+		t.Fatalf("reads were not cached after the reconnect")
+	}
+	s.Set("user:1", "carol")
+	if !s.WaitFor(5*time.Second, func() bool { return c.Len() == 0 }) {
+		t.Fatalf("key was not invalidated after the reconnect")
+	}
+	expectGet(t, c, "user:1", "carol")
+}
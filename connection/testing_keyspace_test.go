@@ -0,0 +1,123 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func TestParseKeyEvent(t *testing.T) {
+	tests := []struct {
+		channel string
+		payload string
+		want    connection.KeyEvent
+		ok      bool
+	}{
+		{"__keyspace@0__:session:42", "expired", connection.KeyEvent{DB: 0, Key: "session:42", Event: "expired"}, true},
+		{"__keyevent@3__:set", "user:1", connection.KeyEvent{DB: 3, Key: "user:1", Event: "set"}, true},
+		{"__keyspace@12__:a__:b", "del", connection.KeyEvent{DB: 12, Key: "a__:b", Event: "del"}, true},
+		{"__keyspace@x__:key", "del", connection.KeyEvent{}, false},
+		{"__keyevent@0", "key", connection.KeyEvent{}, false},
+		{"orders", "1", connection.KeyEvent{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := connection.ParseKeyEvent(connection.BusMessage{Channel: tt.channel, Data: []byte(tt.payload)})
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseKeyEvent(%q, %q) = %+v, %v, want %+v, %v", tt.channel, tt.payload, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestKeyspaceChannels(t *testing.T) {
+	if got := connection.KeyspaceChannel(0, "session:*"); got != "__keyspace@0__:session:*" {
+		t.Errorf("KeyspaceChannel() = %q", got)
+	}
+	if got := connection.KeyeventChannel(-1, "expired"); got != "__keyevent@*__:expired" {
+		t.Errorf("KeyeventChannel() = %q", got)
+	}
+}
+
+func TestHandleKeyEvents(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	events := make(chan connection.KeyEvent, 10)
+	reconn.HandleKeyEvents(connection.KeyeventChannel(-1, "expired"), func(event connection.KeyEvent) {
+		events <- event
+	})
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 }) {
+		t.Fatalf("handler did not subscribe")
+	}
+
+	expect := func(want connection.KeyEvent) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("received %+v, want %+v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%+v was not delivered", want)
+		}
+	}
+
+	s.Publish("__keyevent@0__:expired", "session:1")
+	expect(connection.KeyEvent{DB: 0, Key: "session:1", Event: "expired"})
+
+	s.DropConnections()
+	if !s.WaitForCommand("PSUBSCRIBE", 2, 5*time.Second) || !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 }) {
+		t.Fatalf("handler was not resubscribed")
+	}
+	s.Publish("__keyevent@2__:expired", "session:2")
+	expect(connection.KeyEvent{DB: 2, Key: "session:2", Event: "expired"})
+}
+
+func TestConfigureKeyspaceEvents(t *testing.T) {
+	s := redistest.NewServer(t)
+	client := connection.NewClient(s.Addr())
+	defer client.Close()
+	ctx := context.Background()
+
+	got, err := connection.ConfigureKeyspaceEvents(ctx, client, "Kx")
+	if err != nil || got != "Kx" {
+		t.Fatalf("ConfigureKeyspaceEvents() = %q, %v, want Kx", got, err)
+	}
+	if got, _ := connection.ConfigureKeyspaceEvents(ctx, client, "Eg"); got != "KxEg" {
+		t.Errorf("ConfigureKeyspaceEvents() = %q, want the flags merged into KxEg", got)
+	}
+
+	s.ClearCommands()
+	if _, err := client.Do(ctx, "CONFIG", "SET", "notify-keyspace-events", "KEA"); err != nil {
+		t.Fatalf("CONFIG SET error = %v", err)
+	}
+	if got, _ := connection.ConfigureKeyspaceEvents(ctx, client, "Kx$"); got != "KEA" {
+		t.Errorf("ConfigureKeyspaceEvents() = %q, want KEA which covers x and $", got)
+	}
+	if s.Config("notify-keyspace-events") != "KEA" || s.CommandCount("CONFIG") != 2 {
+		t.Errorf("ConfigureKeyspaceEvents() changed a setting that already covered the flags")
+	}
+}
+
+func TestOnConnect(t *testing.T) {
+	s := redistest.NewServer(t)
+	connects := make(chan struct{}, 10)
+	reconn := connection.NewReconnecting(s.Addr())
+	defer reconn.Close()
+	reconn.OnConnect(func() { connects <- struct{}{} })
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-connects:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("OnConnect hook did not run for connection %d", i+1)
+		}
+		if !s.WaitForCommand("PING", i+1, 5*time.Second) {
+			t.Fatalf("connection %d was not established", i+1)
+		}
+		s.DropConnections()
+	}
+}
@@ -1,7 +1,9 @@
 package connection_test
 
 import (
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/Moonlight-Companies/goresp/connection"
@@ -124,6 +126,42 @@ func TestParseMessage(t *testing.T) {
 			expectedMsg:    nil,
 			expectedReturn: false,
 		},
+		{
+			name: "Simple string message type",
+			input: &resp.RESPArray{
+				Items: []resp.RESPValue{
+					&resp.RESPSimpleString{Value: "message"},
+					&resp.RESPBulkString{Value: []byte("channel1")},
+					&resp.RESPBulkString{Value: []byte("data")},
+				},
+			},
+			expectedMsg:    nil,
+			expectedReturn: false,
+		},
+		{
+			name: "Integer payload",
+			input: &resp.RESPArray{
+				Items: []resp.RESPValue{
+					&resp.RESPBulkString{Value: []byte("message")},
+					&resp.RESPBulkString{Value: []byte("channel1")},
+					&resp.RESPInteger{Value: 1},
+				},
+			},
+			expectedMsg:    nil,
+			expectedReturn: false,
+		},
+		{
+			name: "Nil channel",
+			input: &resp.RESPArray{
+				Items: []resp.RESPValue{
+					&resp.RESPBulkString{Value: []byte("message")},
+					&resp.RESPBulkString{},
+					&resp.RESPBulkString{Value: []byte("data")},
+				},
+			},
+			expectedMsg:    nil,
+			expectedReturn: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -138,3 +176,19 @@ func TestParseMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMessageStream(t *testing.T) {
+	msg, ok := connection.ParseMessage(&resp.RESPArray{
+		Items: []resp.RESPValue{
+			&resp.RESPBulkString{Value: []byte("message")},
+			&resp.RESPBulkString{Value: []byte("channel1")},
+			&resp.RESPBulkStream{Length: 4, Body: strings.NewReader("blob")},
+		},
+	})
+	if !ok || msg.Channel != "channel1" || msg.Data != nil || msg.Body == nil {
+		t.Fatalf("ParseMessage() = %+v, %v, want a message with a Body", msg, ok)
+	}
+	if body, err := io.ReadAll(msg.Body); err != nil || string(body) != "blob" {
+		t.Errorf("ReadAll(Body) = %q, %v, want blob", body, err)
+	}
+}
@@ -0,0 +1,198 @@
+package connection_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func TestReconcileRepairsDrift(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	reconn.Subscribe("orders", "returns")
+	waitAcknowledged(t, s, reconn, sub("orders"), sub("returns"))
+	if report := reconn.Reconcile(); report.Drift() {
+		t.Fatalf("Reconcile() = %+v without drift", report)
+	}
+
+	// change the server side state behind the registry's back
+	reconn.Send(command.FormatCommand("UNSUBSCRIBE", "returns"))
+	reconn.Send(command.FormatCommand("PSUBSCRIBE", "audit.*"))
+	waitAcknowledged(t, s, reconn, sub("orders"), psub("audit.*"))
+
+	report := reconn.Reconcile()
+	want := connection.ReconcileReport{
+		Missing:     []connection.ReconnectingChannel{{Channel: "returns", Kind: "SUBSCRIBE"}},
+		Extra:       []connection.ReconnectingChannel{{Channel: "audit.*", Kind: "PSUBSCRIBE"}},
+		ServerCount: 2,
+		Acked:       2,
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Reconcile() = %+v, want %+v", report, want)
+	}
+
+	waitAcknowledged(t, s, reconn, sub("orders"), sub("returns"))
+	if s.NumSub("returns") != 1 || s.NumPat() != 0 {
+		t.Fatalf("drift was not repaired on the server")
+	}
+	if report := reconn.Reconcile(); report.Drift() {
+		t.Errorf("Reconcile() = %+v after repair", report)
+	}
+}
+
+func TestReconcileInterval(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	reconn.SetReconcileInterval(50 * time.Millisecond)
+
+	reconn.Subscribe("orders")
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("channel was not subscribed")
+	}
+
+	reconn.Send(command.FormatCommand("UNSUBSCRIBE", "orders"))
+	if !s.WaitForCommand("UNSUBSCRIBE", 1, 5*time.Second) {
+		t.Fatalf("UNSUBSCRIBE was not sent")
+	}
+	if !s.WaitForCommand("SUBSCRIBE", 2, 5*time.Second) {
+		t.Fatalf("periodic reconciliation did not subscribe again")
+	}
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Errorf("channel was not subscribed again")
+	}
+}
+
+func TestReconcileSkipsSubscriptionsInFlight(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	// Subscribe expects the ack before the command is queued, the stalled server never
+	// answers it
+	s.Stall()
+	reconn.Subscribe("late")
+	if reconn.Settled() {
+		t.Fatalf("Settled() = true with a SUBSCRIBE in flight")
+	}
+	if report := reconn.Reconcile(); report.Drift() {
+		t.Errorf("Reconcile() = %+v while the SUBSCRIBE waits for its ack", report)
+	}
+
+	s.Resume()
+	waitAcknowledged(t, s, reconn, sub("late"))
+	if report := reconn.Reconcile(); report.Drift() {
+		t.Errorf("Reconcile() = %+v after the ack", report)
+	}
+}
+
+func TestReconcileClientRequestsClientID(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	if n := s.CommandCount("CLIENT"); n != 0 {
+		t.Fatalf("CLIENT sent %d times without a reconcile client", n)
+	}
+
+	client := connection.NewClient(s.Addr())
+	t.Cleanup(client.Close)
+	reconn.SetReconcileClient(client)
+	if !s.WaitForCommand("CLIENT", 1, 5*time.Second) {
+		t.Fatalf("the connection was not made again with CLIENT ID")
+	}
+}
+
+func TestReconcileIntrospection(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	client := connection.NewClient(s.Addr())
+	t.Cleanup(client.Close)
+	reconn.SetReconcileClient(client)
+	// the connection is made again to learn its CLIENT ID
+	if !s.WaitForCommand("CLIENT", 1, 5*time.Second) {
+		t.Fatalf("CLIENT ID was not sent")
+	}
+
+	reconn.Subscribe("orders")
+	reconn.PSubscribe("audit.*")
+	waitAcknowledged(t, s, reconn, sub("orders"), psub("audit.*"))
+
+	report := reconn.Reconcile()
+	want := &connection.Introspection{Channels: 1, Patterns: 1, WantChannels: 1, WantPatterns: 1}
+	if report.Drift() || !reflect.DeepEqual(report.Introspection, want) {
+		t.Fatalf("Reconcile() = %+v, introspection %+v, want %+v without drift", report, report.Introspection, want)
+	}
+
+	// the server loses the subscription without an ack telling the connection
+	s.DropSubscribers("orders")
+	report = reconn.Reconcile()
+	want = &connection.Introspection{Channels: 0, Patterns: 1, WantChannels: 1, WantPatterns: 1}
+	if !report.Drift() || len(report.Missing) != 0 || !reflect.DeepEqual(report.Introspection, want) {
+		t.Fatalf("Reconcile() = %+v, introspection %+v, want drift with %+v", report, report.Introspection, want)
+	}
+
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("drift was not repaired")
+	}
+	waitAcknowledged(t, s, reconn, sub("orders"), psub("audit.*"))
+	if report := reconn.Reconcile(); report.Drift() || report.Introspection == nil {
+		t.Errorf("Reconcile() = %+v, introspection %+v after repair", report, report.Introspection)
+	}
+}
+
+func TestReconcileStartsOverOnUnknownSubscriptions(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	client := connection.NewClient(s.Addr())
+	t.Cleanup(client.Close)
+	reconn.SetReconcileClient(client)
+	if !s.WaitForCommand("CLIENT", 1, 5*time.Second) {
+		t.Fatalf("CLIENT ID was not sent")
+	}
+
+	reconn.Subscribe("orders")
+	waitAcknowledged(t, s, reconn, sub("orders"))
+
+	// the server holds a subscription the connection never saw an ack for, only dropping
+	// every channel finds it
+	s.CopySubscribers("orders", "ghost")
+	report := reconn.Reconcile()
+	want := &connection.Introspection{Channels: 2, Patterns: 0, WantChannels: 1, WantPatterns: 0}
+	if !report.Drift() || len(report.Missing) != 0 || len(report.Extra) != 0 || !reflect.DeepEqual(report.Introspection, want) {
+		t.Fatalf("Reconcile() = %+v, introspection %+v, want drift with %+v", report, report.Introspection, want)
+	}
+
+	if !s.WaitForCommand("UNSUBSCRIBE", 1, 5*time.Second) {
+		t.Fatalf("UNSUBSCRIBE was not sent")
+	}
+	if !s.WaitFor(5*time.Second, func() bool { return reconn.Settled() && s.NumSub("ghost") == 0 }) {
+		t.Fatalf("the unknown subscription was not dropped, Settled() = %v", reconn.Settled())
+	}
+	waitAcknowledged(t, s, reconn, sub("orders"))
+	if s.NumSub("orders") != 1 {
+		t.Errorf("NumSub(orders) = %d after starting over, want 1", s.NumSub("orders"))
+	}
+	if report := reconn.Reconcile(); report.Drift() || report.Introspection == nil {
+		t.Errorf("Reconcile() = %+v, introspection %+v after starting over", report, report.Introspection)
+	}
+}
+
+func sub(channel string) connection.ReconnectingChannel {
+	return connection.ReconnectingChannel{Channel: channel, Kind: "SUBSCRIBE"}
+}
+
+func psub(pattern string) connection.ReconnectingChannel {
+	return connection.ReconnectingChannel{Channel: pattern, Kind: "PSUBSCRIBE"}
+}
+
+// waitAcknowledged waits until the server acknowledged exactly want on the connection and no
+// subscription the registry sent waits for its ack
+func waitAcknowledged(t *testing.T, s *redistest.Server, reconn *connection.Reconnecting, want ...connection.ReconnectingChannel) {
+	t.Helper()
+
+	if !s.WaitFor(5*time.Second, func() bool { return reconn.Settled() && reflect.DeepEqual(reconn.Acknowledged(), want) }) {
+		t.Fatalf("Acknowledged() = %v, Settled() = %v, want %v", reconn.Acknowledged(), reconn.Settled(), want)
+	}
+}
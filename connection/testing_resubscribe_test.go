@@ -0,0 +1,57 @@
+package connection_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func TestResubscribeInBatches(t *testing.T) {
+	s := redistest.NewServer(t)
+	// subscribing once connected keeps the first connection's commands apart from the
+	// resubscription
+	reconn := newConnected(t, s)
+	reconn.SetResubscribeBatchSize(100)
+
+	channels := make([]string, 1000)
+	for i := range channels {
+		channels[i] = fmt.Sprintf("channel.%d", i)
+	}
+	reconn.Subscribe(channels...)
+	reconn.PSubscribe("audit.*", "billing.*")
+
+	subscribed := func() bool {
+		for _, channel := range channels {
+			if s.NumSub(channel) != 1 {
+				return false
+			}
+		}
+		return s.NumPat() == 2
+	}
+	if !s.WaitFor(5*time.Second, func() bool { return subscribed() && reconn.Settled() }) {
+		t.Fatalf("channels were not subscribed")
+	}
+
+	s.ClearCommands()
+	s.DropConnections()
+	if !s.WaitForCommand("PING", 1, 10*time.Second) {
+		t.Fatalf("Reconnecting did not reconnect")
+	}
+	if !s.WaitFor(5*time.Second, subscribed) {
+		t.Fatalf("channels were not resubscribed")
+	}
+
+	if got := s.CommandCount("SUBSCRIBE"); got != 10 {
+		t.Errorf("SUBSCRIBE sent %d times, want 10", got)
+	}
+	if got := s.CommandCount("PSUBSCRIBE"); got != 1 {
+		t.Errorf("PSUBSCRIBE sent %d times, want 1", got)
+	}
+	for _, cmd := range s.Commands() {
+		if cmd.Name == "SUBSCRIBE" && len(cmd.Args) != 100 {
+			t.Errorf("SUBSCRIBE with %d channels, want 100", len(cmd.Args))
+		}
+	}
+}
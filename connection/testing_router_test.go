@@ -0,0 +1,231 @@
+package connection_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func TestHandleRouting(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	orders := make(chan connection.BusMessage, 10)
+	audit := make(chan connection.BusMessage, 10)
+	reconn.Handle("orders", func(msg connection.BusMessage) { orders <- msg })
+	reconn.Handle("audit.*", func(msg connection.BusMessage) { audit <- msg })
+	reconn.Subscribe("other")
+
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("orders") == 1 && s.NumPat() == 1 && s.NumSub("other") == 1 }) {
+		t.Fatalf("handlers did not subscribe")
+	}
+
+	s.Publish("orders", "1")
+	s.Publish("audit.login", "2")
+	s.Publish("other", "3")
+
+	expectRouted(t, orders, "orders", "", "1")
+	expectRouted(t, audit, "audit.login", "audit.*", "2")
+	expectRouted(t, reconn.Messages, "other", "", "3")
+}
+
+func TestHandleRemoveUnsubscribes(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	first := reconn.Handle("orders", func(connection.BusMessage) {})
+	second := reconn.Handle("orders", func(connection.BusMessage) {})
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("handler did not subscribe")
+	}
+	if got := s.CommandCount("SUBSCRIBE"); got != 1 {
+		t.Errorf("SUBSCRIBE sent %d times, want 1", got)
+	}
+
+	first.Remove()
+	first.Remove()
+	time.Sleep(100 * time.Millisecond)
+	if s.CommandCount("UNSUBSCRIBE") != 0 {
+		t.Fatalf("UNSUBSCRIBE sent while a handler remains")
+	}
+
+	second.Remove()
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("orders") == 0 }) {
+		t.Errorf("removing the last handler did not unsubscribe")
+	}
+
+	reconn.Subscribe("explicit")
+	handler := reconn.Handle("explicit", func(connection.BusMessage) {})
+	s.WaitForSubscribers("explicit", 1, 5*time.Second)
+	handler.Remove()
+	time.Sleep(100 * time.Millisecond)
+	if s.NumSub("explicit") != 1 {
+		t.Errorf("removing a handler dropped an explicit subscription")
+	}
+}
+
+func TestHandleWorkersKeepChannelOrder(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	var mutex sync.Mutex
+	received := map[string][]string{}
+	var wg sync.WaitGroup
+	wg.Add(60)
+	reconn.Handle("shard.*", func(msg connection.BusMessage) {
+		mutex.Lock()
+		received[msg.Channel] = append(received[msg.Channel], string(msg.Data))
+		mutex.Unlock()
+		wg.Done()
+	}, connection.WithWorkers(4))
+
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 }) {
+		t.Fatalf("handler did not subscribe")
+	}
+
+	for i := 0; i < 20; i++ {
+		for _, channel := range []string{"shard.a", "shard.b", "shard.c"} {
+			s.Publish(channel, fmt.Sprint(i))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not every message was handled")
+	}
+
+	for channel, values := range received {
+		for i, value := range values {
+			if value != fmt.Sprint(i) {
+				t.Fatalf("%s handled out of order: %v", channel, values)
+			}
+		}
+	}
+}
+
+func TestHandleSlowHandlerDropsInsteadOfBlocking(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	slow := reconn.Handle("slow", func(connection.BusMessage) { <-unblock }, connection.WithDropOnFull())
+	fast := make(chan connection.BusMessage, 10)
+	reconn.Handle("fast", func(msg connection.BusMessage) { fast <- msg })
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("slow") == 1 && s.NumSub("fast") == 1 }) {
+		t.Fatalf("handlers did not subscribe")
+	}
+
+	for i := 0; i < 300; i++ {
+		s.Publish("slow", fmt.Sprint(i))
+	}
+	s.Publish("fast", "1")
+
+	expectRouted(t, fast, "fast", "", "1")
+	if !s.WaitFor(5*time.Second, func() bool { return slow.Dropped() > 0 }) {
+		t.Errorf("Dropped() = 0 after overflowing the handler's queue")
+	}
+	if got := s.CommandCount("PING"); got != 1 {
+		t.Errorf("connection was reset, PING sent %d times", got)
+	}
+}
+
+func TestHandleSlowHandlerBlocksByDefault(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	unblock := make(chan struct{})
+	var handled atomic.Int64
+	handler := reconn.Handle("slow", func(connection.BusMessage) {
+		<-unblock
+		handled.Add(1)
+	})
+	if !s.WaitForSubscribers("slow", 1, 5*time.Second) {
+		t.Fatalf("handler did not subscribe")
+	}
+
+	for i := 0; i < 300; i++ {
+		s.Publish("slow", fmt.Sprint(i))
+	}
+	close(unblock)
+
+	if !s.WaitFor(5*time.Second, func() bool { return handled.Load() == 300 }) {
+		t.Errorf("handled %d of 300 messages", handled.Load())
+	}
+	if handler.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0 without WithDropOnFull", handler.Dropped())
+	}
+}
+
+func TestHandleRemoveFromHandlerWithFullQueue(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	unblock := make(chan struct{})
+	removed := make(chan struct{})
+	var handler *connection.Handler
+	var once sync.Once
+	ready := make(chan struct{})
+	handler = reconn.Handle("orders", func(connection.BusMessage) {
+		<-ready
+		<-unblock
+		once.Do(func() {
+			handler.Remove()
+			close(removed)
+		})
+	})
+	close(ready)
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("handler did not subscribe")
+	}
+
+	for i := 0; i < 300; i++ {
+		s.Publish("orders", fmt.Sprint(i))
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(unblock)
+
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Remove() from the handler did not return")
+	}
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("orders") == 0 }) {
+		t.Errorf("removing the handler did not unsubscribe")
+	}
+}
+
+func expectRouted(t *testing.T, messages <-chan connection.BusMessage, channel, pattern, data string) {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		if msg.Channel != channel || msg.Pattern != pattern || string(msg.Data) != data {
+			t.Errorf("message = %+v, want %s %s %s", msg, channel, pattern, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message for %s", channel)
+	}
+}
+
+// newConnected returns a Reconnecting that has finished its initial connect, so commands
+// sent afterwards are not folded into the resubscription done by onConnect
+func newConnected(t *testing.T, s *redistest.Server) *connection.Reconnecting {
+	t.Helper()
+
+	reconn := connection.NewReconnecting(s.Addr())
+	t.Cleanup(reconn.Close)
+	if !s.WaitForCommand("PING", 1, 5*time.Second) {
+		t.Fatalf("Reconnecting did not connect")
+	}
+	time.Sleep(20 * time.Millisecond)
+	return reconn
+}
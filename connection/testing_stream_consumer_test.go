@@ -0,0 +1,172 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+// newStreamConsumer starts a consumer of group "billing" handling "orders", once the group exists
+func newStreamConsumer(t *testing.T, s *redistest.Server, addr string, fn func(connection.StreamMessage) error, options ...connection.ConsumerOption) *connection.StreamConsumer {
+	t.Helper()
+
+	c := connection.NewStreamConsumer(addr, "billing", "worker-1", append([]connection.ConsumerOption{connection.WithBlock(50 * time.Millisecond)}, options...)...)
+	t.Cleanup(c.Close)
+	c.Handle("orders", fn)
+	if !s.WaitForCommand("XREADGROUP", 1, 5*time.Second) {
+		t.Fatalf("consumer did not read the stream")
+	}
+	return c
+}
+
+func expectEntry(t *testing.T, received chan connection.StreamMessage, id string) connection.StreamMessage {
+	t.Helper()
+
+	select {
+	case msg := <-received:
+		if msg.ID != id {
+			t.Fatalf("received entry %s, want %s", msg.ID, id)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("entry %s was not delivered", id)
+	}
+	return connection.StreamMessage{}
+}
+
+func TestClientDo(t *testing.T) {
+	s := redistest.NewServer(t)
+	client := connection.NewClient(s.Addr())
+	defer client.Close()
+
+	ctx := context.Background()
+	reply, err := client.Do(ctx, "ECHO", 42)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if got, _ := reply.AsString(); got != "42" {
+		t.Errorf("ECHO replied %q, want 42", got)
+	}
+
+	if _, err := client.Do(ctx, "NOPE"); err == nil {
+		t.Errorf("Do() of an unknown command returned no error")
+	}
+
+	s.DropConnections()
+	if _, err := client.Do(ctx, "PING"); err == nil {
+		t.Errorf("Do() on a dropped connection returned no error")
+	}
+	if _, err := client.Do(ctx, "PING"); err != nil {
+		t.Errorf("Do() did not reconnect: %v", err)
+	}
+
+	client.Close()
+	if _, err := client.Do(ctx, "PING"); err != connection.ErrClientClosed {
+		t.Errorf("Do() after Close = %v, want ErrClientClosed", err)
+	}
+}
+
+func TestStreamConsumerAcknowledges(t *testing.T) {
+	s := redistest.NewServer(t)
+	received := make(chan connection.StreamMessage, 10)
+	newStreamConsumer(t, s, s.Addr(), func(msg connection.StreamMessage) error {
+		received <- msg
+		return nil
+	})
+
+	id := s.XAdd("orders", "data", `{"id":7}`, "source", "web")
+	msg := expectEntry(t, received, id)
+	if msg.Channel != "orders" || msg.Fields["source"] != "web" {
+		t.Errorf("received %+v", msg)
+	}
+	order, err := connection.Decode[map[string]int](msg.BusMessage)
+	if err != nil || order["id"] != 7 {
+		t.Errorf("Decode() = %v, %v", order, err)
+	}
+
+	if !s.WaitFor(5*time.Second, func() bool { return s.Pending("orders", "billing") == 0 }) {
+		t.Errorf("entry was not acknowledged")
+	}
+}
+
+func TestStreamConsumerClaimsFailedEntries(t *testing.T) {
+	s := redistest.NewServer(t)
+	received := make(chan connection.StreamMessage, 10)
+	failures := 1
+	newStreamConsumer(t, s, s.Addr(), func(msg connection.StreamMessage) error {
+		received <- msg
+		if failures > 0 {
+			failures--
+			return errors.New("database unavailable")
+		}
+		return nil
+	}, connection.WithClaimIdle(100*time.Millisecond))
+
+	id := s.XAdd("orders", "data", "1")
+	expectEntry(t, received, id)
+	if s.Pending("orders", "billing") != 1 {
+		t.Fatalf("failed entry is not pending")
+	}
+
+	expectEntry(t, received, id)
+	if !s.WaitFor(5*time.Second, func() bool { return s.Pending("orders", "billing") == 0 }) {
+		t.Errorf("claimed entry was not acknowledged")
+	}
+}
+
+func TestStreamConsumerReadsPendingEntriesFirst(t *testing.T) {
+	s := redistest.NewServer(t)
+
+	// a previous run of worker-1 received two entries and stopped before handling them
+	client := connection.NewClient(s.Addr())
+	defer client.Close()
+	if _, err := client.Do(context.Background(), "XGROUP", "CREATE", "orders", "billing", "$", "MKSTREAM"); err != nil {
+		t.Fatalf("XGROUP CREATE error = %v", err)
+	}
+	first := s.XAdd("orders", "data", "1")
+	second := s.XAdd("orders", "data", "2")
+	if _, err := client.Do(context.Background(), "XREADGROUP", "GROUP", "billing", "worker-1", "STREAMS", "orders", ">"); err != nil {
+		t.Fatalf("XREADGROUP error = %v", err)
+	}
+
+	received := make(chan connection.StreamMessage, 10)
+	c := newStreamConsumer(t, s, s.Addr(), func(msg connection.StreamMessage) error {
+		received <- msg
+		return nil
+	})
+	expectEntry(t, received, first)
+	expectEntry(t, received, second)
+	if !s.WaitFor(5*time.Second, func() bool { return s.Pending("orders", "billing") == 0 }) {
+		t.Errorf("recovered entries were not acknowledged")
+	}
+	if c.LastID("orders") != second {
+		t.Errorf("LastID() = %s, want %s", c.LastID("orders"), second)
+	}
+}
+
+func TestStreamConsumerResumesAfterReconnect(t *testing.T) {
+	s := redistest.NewServer(t)
+	proxy := redistest.NewProxy(t, s.Addr())
+	received := make(chan connection.StreamMessage, 10)
+	newStreamConsumer(t, s, proxy.Addr(), func(msg connection.StreamMessage) error {
+		received <- msg
+		return nil
+	}, connection.WithBlock(time.Second))
+
+	expectEntry(t, received, s.XAdd("orders", "data", "1"))
+
+	// the entry is delivered to the blocked read of a connection that is gone
+	time.Sleep(50 * time.Millisecond)
+	proxy.Reset()
+	lost := s.XAdd("orders", "data", "2")
+	expectEntry(t, received, lost)
+
+	expectEntry(t, received, s.XAdd("orders", "data", "3"))
+	if !s.WaitFor(5*time.Second, func() bool { return s.Pending("orders", "billing") == 0 }) {
+		t.Errorf("entries were not acknowledged after the reconnect")
+	}
+}
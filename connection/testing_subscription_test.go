@@ -0,0 +1,256 @@
+package connection_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func TestSubscriptionReferenceCounting(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	billing := reconn.Subscribe("orders")
+	shipping := reconn.Subscribe("orders", "returns")
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("orders") == 1 && s.NumSub("returns") == 1 }) {
+		t.Fatalf("subscriptions were not made")
+	}
+	if got := s.CommandCount("SUBSCRIBE"); got != 2 {
+		t.Errorf("SUBSCRIBE sent %d times, want 2", got)
+	}
+
+	billingMessages := billing.Messages()
+	shippingMessages := shipping.Messages()
+
+	s.Publish("orders", "1")
+	expectRouted(t, billingMessages, "orders", "", "1")
+	expectRouted(t, shippingMessages, "orders", "", "1")
+
+	billing.Close()
+	billing.Close()
+	if _, ok := <-billingMessages; ok {
+		t.Errorf("closed subscription still delivers messages")
+	}
+
+	s.Publish("orders", "2")
+	expectRouted(t, shippingMessages, "orders", "", "2")
+	if s.CommandCount("UNSUBSCRIBE") != 0 {
+		t.Errorf("UNSUBSCRIBE sent while another subscription holds the channel")
+	}
+
+	shipping.Close()
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("orders") == 0 && s.NumSub("returns") == 0 }) {
+		t.Errorf("closing the last subscription did not unsubscribe")
+	}
+}
+
+func TestSubscriptionWithoutMessagesUsesSharedChannel(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	sub := reconn.PSubscribe("audit.*")
+	defer sub.Close()
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 }) {
+		t.Fatalf("pattern was not subscribed")
+	}
+
+	s.Publish("audit.login", "1")
+	expectRouted(t, reconn.Messages, "audit.login", "audit.*", "1")
+}
+
+func TestSubscriptionMixedWithSharedChannel(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	own := reconn.Subscribe("orders")
+	defer own.Close()
+	shared := reconn.Subscribe("orders")
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("channel was not subscribed")
+	}
+	messages := own.Messages()
+
+	s.Publish("orders", "1")
+	expectRouted(t, messages, "orders", "", "1")
+	expectRouted(t, reconn.Messages, "orders", "", "1")
+
+	// once the shared handle is gone only the handle's own channel gets messages
+	shared.Close()
+	s.Publish("orders", "2")
+	expectRouted(t, messages, "orders", "", "2")
+	select {
+	case msg := <-reconn.Messages:
+		t.Errorf("message %+v delivered to Messages without a shared handle", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSubscriptionConcurrentAcquireAndRelease(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	var wg sync.WaitGroup
+	// 200 commands at most, within the command queue
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				reconn.Subscribe("orders").Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	held := reconn.Subscribe("orders")
+	defer held.Close()
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("channel was not subscribed")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := s.NumSub("orders"); got != 1 {
+		t.Errorf("NumSub(orders) = %d while a handle holds it, want 1", got)
+	}
+}
+
+func TestSubscriptionSurvivesForcedUnsubscribe(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	stale := reconn.Subscribe("orders")
+	reconn.Unsubscribe("orders")
+	fresh := reconn.Subscribe("orders")
+	defer fresh.Close()
+
+	// closing a handle from before the forced unsubscribe must not release the new one
+	stale.Close()
+	if !s.WaitForCommand("SUBSCRIBE", 2, 5*time.Second) {
+		t.Fatalf("resubscribe was not sent")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if s.CommandCount("UNSUBSCRIBE") != 1 {
+		t.Errorf("UNSUBSCRIBE sent %d times, want 1", s.CommandCount("UNSUBSCRIBE"))
+	}
+	if got := s.NumSub("orders"); got != 1 {
+		t.Errorf("NumSub(orders) = %d, want 1", got)
+	}
+}
+
+func TestChannelAndPatternWithSameName(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	reconn.Subscribe("news")
+	reconn.PSubscribe("news")
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("news") == 1 && s.NumPat() == 1 }) {
+		t.Fatalf("channel and pattern were not both subscribed")
+	}
+
+	want := []connection.ReconnectingChannel{
+		{Channel: "news", Kind: "SUBSCRIBE"},
+		{Channel: "news", Kind: "PSUBSCRIBE"},
+	}
+	if got := reconn.Subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions() = %v, want %v", got, want)
+	}
+
+	reconn.Unsubscribe("news")
+	reconn.PUnsubscribe("missing")
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("news") == 0 }) {
+		t.Fatalf("channel was not unsubscribed")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := s.NumPat(); got != 1 {
+		t.Errorf("NumPat() = %d after unsubscribing the channel, want 1", got)
+	}
+	if got := s.CommandCount("PUNSUBSCRIBE"); got != 0 {
+		t.Errorf("PUNSUBSCRIBE sent %d times, want 0", got)
+	}
+
+	want = want[1:]
+	if got := reconn.Subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscriptions() = %v, want %v", got, want)
+	}
+}
+
+func TestSubscriptionStreamsLargePayloads(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	reconn.SetStreamThreshold(64 * 1024)
+
+	sub := reconn.Subscribe("blobs")
+	defer sub.Close()
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("blobs") == 1 }) {
+		t.Fatalf("subscription was not made")
+	}
+	messages := sub.Messages()
+
+	blob := strings.Repeat("b", 1<<20)
+	s.Publish("blobs", blob)
+	s.Publish("blobs", "small")
+
+	select {
+	case msg := <-messages:
+		if msg.Body == nil || msg.Data != nil {
+			t.Fatalf("large message = %+v, want a Body", msg)
+		}
+		body, err := io.ReadAll(msg.Body)
+		if err != nil || string(body) != blob {
+			t.Fatalf("ReadAll(Body) = %d bytes, %v, want the blob", len(body), err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message for blobs")
+	}
+
+	expectRouted(t, messages, "blobs", "", "small")
+}
+
+func TestSubscriptionStreamCutByDisconnect(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	reconn.SetStreamThreshold(64 * 1024)
+
+	sub := reconn.Subscribe("blobs")
+	defer sub.Close()
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("blobs") == 1 }) {
+		t.Fatalf("subscription was not made")
+	}
+	messages := sub.Messages()
+
+	s.Publish("blobs", strings.Repeat("b", 1<<20))
+
+	var body io.ReadCloser
+	select {
+	case msg := <-messages:
+		body = msg.Body
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message for blobs")
+	}
+
+	// read only once the drop was seen, the whole blob may already be queued for decoding
+	disconnected := make(chan struct{})
+	var once sync.Once
+	reconn.OnDisconnect(func() { once.Do(func() { close(disconnected) }) })
+	s.DropConnections()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection was not dropped")
+	}
+
+	if _, err := io.ReadAll(body); err != io.ErrClosedPipe {
+		t.Errorf("ReadAll(Body) error = %v, want io.ErrClosedPipe", err)
+	}
+
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumSub("blobs") == 1 }) {
+		t.Fatalf("subscription was not restored")
+	}
+	s.Publish("blobs", "after")
+	expectRouted(t, messages, "blobs", "", "after")
+}
@@ -0,0 +1,217 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func newClient(t *testing.T, s *redistest.Server) *connection.Client {
+	t.Helper()
+
+	c := connection.NewClient(s.Addr())
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestClientMulti(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("name", "alice")
+	c := newClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := c.Multi(ctx, func(tx *connection.Tx) error {
+		tx.Queue("INCR", "visits")
+		tx.Queue("INCR", "name")
+		tx.Queue("GET", "name")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Multi() error = %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Multi() returned %d results, want 3", len(results))
+	}
+	if n, _ := results[0].AsInt64(); n != 1 {
+		t.Errorf("INCR result = %v, want 1", results[0])
+	}
+	if results[1].Err() == nil {
+		t.Errorf("INCR of a string result = %v, want an error reply", results[1])
+	}
+	if name, _ := results[2].AsString(); name != "alice" {
+		t.Errorf("GET result = %v, want alice", results[2])
+	}
+}
+
+func TestClientMultiExecAbort(t *testing.T) {
+	s := redistest.NewServer(t)
+	c := newClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.Multi(ctx, func(tx *connection.Tx) error {
+		tx.Queue("INCR", "visits")
+		tx.Queue("NOSUCH")
+		tx.Queue("INCR", "visits", "twice")
+		return nil
+	})
+	var txErr *connection.TxError
+	if !errors.As(err, &txErr) {
+		t.Fatalf("Multi() error = %v, want a TxError", err)
+	}
+	if len(txErr.Queued) != 3 || txErr.Queued[0] != nil || txErr.Queued[1] == nil || txErr.Queued[2] == nil {
+		t.Errorf("Queued = %v, want the unknown command and the wrong argument count refused", txErr.Queued)
+	}
+	if _, ok := s.Get("visits"); ok {
+		t.Errorf("aborted transaction ran its commands")
+	}
+
+	// the connection is still usable
+	if _, err := c.Do(ctx, "INCR", "visits"); err != nil {
+		t.Errorf("Do() after EXECABORT error = %v", err)
+	}
+}
+
+func TestClientWatchRetriesAfterConflict(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("counter", "1")
+	c := newClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	attempts := 0
+	results, err := c.Watch(ctx, []string{"counter"}, func(tx *connection.Tx) error {
+		attempts++
+		reply, err := tx.Do("GET", "counter")
+		if err != nil {
+			return err
+		}
+		value, _ := reply.AsString()
+		n, _ := strconv.Atoi(value)
+		if attempts == 1 {
+			// another client wins the race
+			s.Set("counter", "100")
+		}
+		tx.Queue("SET", "counter", n+1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("fn ran %d times, want 2", attempts)
+	}
+	if len(results) != 1 {
+		t.Errorf("Watch() returned %d results, want 1", len(results))
+	}
+	if value, _ := s.Get("counter"); value != "101" {
+		t.Errorf("counter = %q, want 101", value)
+	}
+}
+
+func TestClientWatchGivesUp(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("counter", "1")
+	c := newClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	attempts := 0
+	_, err := c.Watch(ctx, []string{"counter"}, func(tx *connection.Tx) error {
+		attempts++
+		// another client wins every race
+		s.Set("counter", strconv.Itoa(attempts))
+		tx.Queue("INCR", "counter")
+		return nil
+	})
+	if err != connection.ErrTxAborted {
+		t.Fatalf("Watch() error = %v, want %v", err, connection.ErrTxAborted)
+	}
+	if attempts != 10 || s.CommandCount("EXEC") != 10 {
+		t.Errorf("fn ran %d times and EXEC was sent %d times, want 10", attempts, s.CommandCount("EXEC"))
+	}
+	if value, _ := s.Get("counter"); value != "10" {
+		t.Errorf("counter = %q, want 10 without any INCR applied", value)
+	}
+}
+
+func TestClientWatchConcurrentCounters(t *testing.T) {
+	s := redistest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const clients, increments = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		c := newClient(t, s)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				_, err := c.Watch(ctx, []string{"counter"}, func(tx *connection.Tx) error {
+					reply, err := tx.Do("GET", "counter")
+					if err != nil {
+						return err
+					}
+					value, _ := reply.AsString()
+					n, _ := strconv.Atoi(value)
+					tx.Queue("SET", "counter", n+1)
+					return nil
+				})
+				if err != nil {
+					t.Errorf("Watch() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, _ := s.Get("counter"); value != strconv.Itoa(clients*increments) {
+		t.Errorf("counter = %q, want %d", value, clients*increments)
+	}
+}
+
+func TestClientWatchCancelled(t *testing.T) {
+	s := redistest.NewServer(t)
+	s.Set("seats", "0")
+	c := newClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	soldOut := errors.New("sold out")
+	_, err := c.Watch(ctx, []string{"seats"}, func(tx *connection.Tx) error {
+		reply, err := tx.Do("GET", "seats")
+		if err != nil {
+			return err
+		}
+		if seats, _ := reply.AsString(); seats == "0" {
+			return soldOut
+		}
+		tx.Queue("DECR", "seats")
+		return nil
+	})
+	if err != soldOut {
+		t.Fatalf("Watch() error = %v, want %v", err, soldOut)
+	}
+	if s.CommandCount("UNWATCH") != 1 || s.CommandCount("MULTI") != 0 {
+		t.Errorf("cancelled transaction sent UNWATCH %d times and MULTI %d times, want 1 and 0",
+			s.CommandCount("UNWATCH"), s.CommandCount("MULTI"))
+	}
+
+	// the keys are no longer watched, a change doesn't fail the next transaction
+	s.Set("seats", "5")
+	if _, err := c.Multi(ctx, func(tx *connection.Tx) error {
+		tx.Queue("GET", "seats")
+		return nil
+	}); err != nil {
+		t.Errorf("Multi() after a cancelled Watch error = %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package connection_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/compression"
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/envelope"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+type order struct {
+	ID    int    `json:"id"`
+	Item  string `json:"item"`
+	Price float64
+}
+
+func TestDecode(t *testing.T) {
+	msg := connection.BusMessage{Channel: "orders", Data: []byte(`{"id":7,"item":"lamp","Price":12.5}`)}
+	got, err := connection.Decode[order](msg)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if want := (order{ID: 7, Item: "lamp", Price: 12.5}); got != want {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+
+	if _, err := connection.Decode[order](connection.BusMessage{Data: []byte(`{"id":"seven"}`)}); err == nil {
+		t.Errorf("Decode() of a mistyped field did not fail")
+	}
+}
+
+func TestSubscribeJSON(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	sub := connection.SubscribeJSON[order](reconn, "orders.*")
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 }) {
+		t.Fatalf("pattern was not subscribed")
+	}
+	if sub.Channel() != "orders.*" {
+		t.Errorf("Channel() = %q, want orders.*", sub.Channel())
+	}
+
+	s.Publish("orders.eu", `{"id":1,"item":"desk"}`)
+	s.Publish("orders.us", `not json`)
+	s.Publish("orders.eu", `{"id":2,"item":"chair"}`)
+
+	expect := func(id int, wantErr bool) {
+		t.Helper()
+		select {
+		case typed := <-sub.Values():
+			if (typed.Err != nil) != wantErr {
+				t.Fatalf("Err = %v, want error %v", typed.Err, wantErr)
+			}
+			if typed.Value.ID != id {
+				t.Errorf("Value.ID = %d, want %d", typed.Value.ID, id)
+			}
+			if typed.Message.Pattern != "orders.*" {
+				t.Errorf("Message.Pattern = %q, want orders.*", typed.Message.Pattern)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no value")
+		}
+	}
+	expect(1, false)
+	expect(0, true)
+	expect(2, false)
+
+	sub.Close()
+	if _, ok := <-sub.Values(); ok {
+		t.Errorf("Values() still open after Close")
+	}
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 0 }) {
+		t.Errorf("Close did not unsubscribe")
+	}
+}
+
+func TestSubscribeJSONStreamThreshold(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	reconn.SetStreamThreshold(16)
+
+	sub := connection.SubscribeJSON[order](reconn, "orders")
+	t.Cleanup(sub.Close)
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("channel was not subscribed")
+	}
+
+	// both payloads are over the threshold, the second one is only delivered once the
+	// first Body was read
+	s.Publish("orders", `{"id":1,"item":"standing desk"}`)
+	s.Publish("orders", `{"id":2,"item":"office chair"}`)
+	for _, id := range []int{1, 2} {
+		select {
+		case typed := <-sub.Values():
+			if typed.Err != nil || typed.Value.ID != id {
+				t.Fatalf("Values() = %+v, %v, want id %d", typed.Value, typed.Err, id)
+			}
+			if typed.Message.Body != nil || len(typed.Message.Data) == 0 {
+				t.Errorf("Message = %+v, want the streamed payload read into Data", typed.Message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no value for id %d", id)
+		}
+	}
+}
+
+func TestSetCodec(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+	reconn.SetCodec("metrics.*", codec.MsgPack)
+
+	sub := reconn.PSubscribe("*")
+	defer sub.Close()
+	messages := sub.Messages()
+	if !s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 }) {
+		t.Fatalf("pattern was not subscribed")
+	}
+
+	payload, _ := codec.MsgPack.Marshal(map[string]interface{}{"id": 3, "item": "fan"})
+	s.Publish("metrics.cpu", string(payload))
+	s.Publish("orders", `{"id":4}`)
+
+	next := func() connection.BusMessage {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no message")
+			return connection.BusMessage{}
+		}
+	}
+
+	msg := next()
+	if msg.Codec != codec.MsgPack {
+		t.Fatalf("Codec = %v, want msgpack", msg.Codec)
+	}
+	fields, err := msg.IntoMap()
+	if err != nil || fields["item"] != "fan" {
+		t.Errorf("IntoMap() = %v, %v", fields, err)
+	}
+	if got, err := connection.Decode[order](msg); err != nil || got.ID != 3 {
+		t.Errorf("Decode() = %+v, %v", got, err)
+	}
+
+	msg = next()
+	if got, err := connection.Decode[order](msg); err != nil || got.ID != 4 {
+		t.Errorf("Decode() of a JSON channel = %+v, %v", got, err)
+	}
+}
+
+func TestEnvelopeUnwrapping(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	sub := connection.SubscribeJSON[order](reconn, "orders")
+	defer sub.Close()
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("channel was not subscribed")
+	}
+
+	e := envelope.New([]byte(`{"id":5}`), codec.JSON)
+	e.Headers["event"] = "created"
+	payload, _ := e.Marshal()
+	s.Publish("orders", string(payload))
+	s.Publish("orders", `{"id":6}`)
+
+	for _, id := range []int{5, 6} {
+		select {
+		case typed := <-sub.Values():
+			if typed.Err != nil || typed.Value.ID != id {
+				t.Fatalf("Values() = %+v, want id %d", typed, id)
+			}
+			if id == 5 && (typed.Message.Envelope == nil || typed.Message.Envelope.Headers["event"] != "created") {
+				t.Errorf("Envelope = %+v, want the published headers", typed.Message.Envelope)
+			}
+			if id == 6 && typed.Message.Envelope != nil {
+				t.Errorf("plain message has an envelope")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no value")
+		}
+	}
+}
+
+func TestCompressedPayloads(t *testing.T) {
+	s := redistest.NewServer(t)
+	reconn := newConnected(t, s)
+
+	sub := connection.SubscribeJSON[order](reconn, "orders")
+	defer sub.Close()
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("channel was not subscribed")
+	}
+
+	plain, _ := compression.Wrap(compression.Deflate, []byte(`{"id":7}`))
+	e := envelope.New([]byte(`{"id":8}`), codec.JSON)
+	e.Compression = compression.Gzip.Name()
+	enveloped, _ := e.Marshal()
+	s.Publish("orders", string(plain))
+	s.Publish("orders", string(enveloped))
+
+	for _, id := range []int{7, 8} {
+		select {
+		case typed := <-sub.Values():
+			if typed.Err != nil || typed.Value.ID != id {
+				t.Errorf("Values() = %+v, want id %d", typed, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no value")
+		}
+	}
+}
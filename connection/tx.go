@@ -0,0 +1,200 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// ErrTxAborted is returned by Multi when EXEC replied with a nil array because a WATCHed key
+// changed. Watch retries and only returns it once every attempt was aborted
+var ErrTxAborted = errors.New("transaction aborted, a watched key changed")
+
+const (
+	// watchAttempts bounds how often Watch runs a transaction that keeps being aborted
+	watchAttempts = 10
+	// watchBackoff is the longest wait before the first retry of Watch, doubling with every
+	// retry up to maxWatchBackoff
+	watchBackoff    = 5 * time.Millisecond
+	maxWatchBackoff = 200 * time.Millisecond
+)
+
+// TxError is returned when the server discarded a transaction with EXECABORT because some
+// commands could not be queued. Queued holds the queueing error of every command, nil for the
+// commands that were queued
+type TxError struct {
+	Err    error
+	Queued []error
+}
+
+func (e *TxError) Error() string {
+	for i, err := range e.Queued {
+		if err != nil {
+			return fmt.Sprintf("%v: command %d: %v", e.Err, i, err)
+		}
+	}
+	return e.Err.Error()
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// Tx collects the commands of a transaction. It is only valid inside the function given to
+// Multi or Watch
+type Tx struct {
+	ctx    context.Context
+	client *Client
+	conn   net.Conn
+	queued bytes.Buffer
+	n      int
+	err    error
+}
+
+// Queue adds a command to run with EXEC, its reply is in the results of the transaction.
+// Arguments are any values resp.MarshalArgs accepts, one that can't be marshalled fails the
+// transaction before anything is sent
+func (tx *Tx) Queue(args ...interface{}) {
+	if tx.err != nil {
+		return
+	}
+
+	cmd, err := command.FormatCommandArgs(args...)
+	if err != nil {
+		tx.err = err
+		return
+	}
+	tx.queued.Write(cmd)
+	tx.n++
+}
+
+// Do runs a command right away on the transaction's connection, before MULTI is sent. Inside
+// Watch it reads the watched keys. An error reply is returned as the error as well
+func (tx *Tx) Do(args ...interface{}) (resp.RESPValue, error) {
+	cmd, err := command.FormatCommandArgs(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := tx.client.exchange(tx.ctx, tx.conn, cmd, 1)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], replies[0].Err()
+}
+
+// Multi runs fn to queue commands and executes them atomically with MULTI/EXEC in a single
+// round trip, returning the reply of every queued command. Error replies of commands that ran
+// are returned as values, as with Pipeline. The Client is held until EXEC's reply, fn must not
+// use the Client itself, only tx. An error returned by fn cancels the transaction
+func (c *Client) Multi(ctx context.Context, fn func(tx *Tx) error) ([]resp.RESPValue, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.transaction(ctx, nil, fn)
+}
+
+// Watch runs a transaction like Multi with keys WATCHed before fn runs, so fn can read them
+// with tx.Do and queue writes depending on their values. When one of the keys changes before
+// EXEC the transaction is aborted and fn runs again on fresh values after a short random wait,
+// until EXEC goes through, fn fails or ctx ends. ErrTxAborted is returned after 10 attempts
+func (c *Client) Watch(ctx context.Context, keys []string, fn func(tx *Tx) error) ([]resp.RESPValue, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		results, err := c.transaction(ctx, keys, fn)
+		if err != ErrTxAborted || attempt == watchAttempts {
+			return results, err
+		}
+
+		// the jitter keeps clients contending for the same keys from colliding again
+		backoff := min(watchBackoff<<(attempt-1), maxWatchBackoff)
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff)) + 1)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// transaction makes one attempt at a transaction, the caller holds c.mutex
+func (c *Client) transaction(ctx context.Context, keys []string, fn func(tx *Tx) error) ([]resp.RESPValue, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx := &Tx{ctx: ctx, client: c, conn: conn}
+
+	if len(keys) > 0 {
+		if _, err := tx.Do("WATCH", keys); err != nil {
+			return nil, err
+		}
+	}
+	if err := fn(tx); err != nil {
+		return nil, tx.cancel(keys, err)
+	}
+	if tx.err != nil {
+		return nil, tx.cancel(keys, tx.err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(command.FormatCommand("MULTI"))
+	buf.Write(tx.queued.Bytes())
+	buf.Write(command.FormatCommand("EXEC"))
+	replies, err := c.exchange(ctx, conn, buf.Bytes(), tx.n+2)
+	if err != nil {
+		return nil, err
+	}
+	return c.execReplies(ctx, conn, replies)
+}
+
+// cancel UNWATCHes the keys of a transaction that won't be sent, so they don't fail a later one
+func (tx *Tx) cancel(keys []string, err error) error {
+	if len(keys) > 0 {
+		if _, unwatchErr := tx.Do("UNWATCH"); unwatchErr != nil {
+			return errors.Join(err, unwatchErr)
+		}
+	}
+	return err
+}
+
+// execReplies checks the replies to MULTI, the QUEUED acknowledgements and EXEC, and returns
+// the results of the queued commands
+func (c *Client) execReplies(ctx context.Context, conn net.Conn, replies []resp.RESPValue) ([]resp.RESPValue, error) {
+	if err := replies[0].Err(); err != nil {
+		return nil, err
+	}
+
+	acks := replies[1 : len(replies)-1]
+	queued := make([]error, len(acks))
+	for i, ack := range acks {
+		if queued[i] = ack.Err(); queued[i] != nil {
+			continue
+		}
+		if status, _ := ack.AsString(); !strings.EqualFold(status, "QUEUED") {
+			return nil, c.fail(ctx, conn, fmt.Errorf("unexpected reply to a queued command: %v", ack))
+		}
+	}
+
+	exec := replies[len(replies)-1]
+	if err := exec.Err(); err != nil {
+		return nil, &TxError{Err: err, Queued: queued}
+	}
+	if exec.IsNil() {
+		return nil, ErrTxAborted
+	}
+	results, err := exec.AsArray()
+	if err != nil {
+		return nil, c.fail(ctx, conn, fmt.Errorf("unexpected reply to EXEC: %v", exec))
+	}
+	return results, nil
+}
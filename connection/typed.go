@@ -0,0 +1,95 @@
+package connection
+
+import (
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/glob"
+)
+
+// Decode unmarshals the payload of msg into a T with the message's codec, JSON by default.
+// A streamed Body is read and closed
+func Decode[T any](msg BusMessage) (T, error) {
+	var value T
+	err := msg.Unmarshal(&value)
+	return value, err
+}
+
+// DecodeWith unmarshals the payload of msg into a T with c. A streamed Body is read and closed
+func DecodeWith[T any](msg BusMessage, c codec.Codec) (T, error) {
+	var value T
+	err := msg.unmarshalWith(c, &value)
+	return value, err
+}
+
+// Typed is a decoded message. Err is set, and Value is the zero value, when the payload
+// could not be decoded, Message is always the message it came from
+type Typed[T any] struct {
+	Value   T
+	Message BusMessage
+	Err     error
+}
+
+// TypedSubscription holds a subscription to a channel or pattern whose messages are decoded
+// into T
+type TypedSubscription[T any] struct {
+	sub     *Subscription
+	channel string
+	codec   codec.Codec
+	values  chan Typed[T]
+}
+
+// SubscribeJSON subscribes to a channel, or a pattern when channelOrPattern contains glob
+// syntax, and decodes every message as JSON into T
+func SubscribeJSON[T any](r *Reconnecting, channelOrPattern string) *TypedSubscription[T] {
+	return SubscribeCodec[T](r, channelOrPattern, codec.JSON)
+}
+
+// SubscribeCodec is SubscribeJSON for any codec, nil uses the codec chosen for each
+// message's channel with SetCodec
+func SubscribeCodec[T any](r *Reconnecting, channelOrPattern string, c codec.Codec) *TypedSubscription[T] {
+	sub := r.Subscribe
+	if glob.IsPattern(channelOrPattern) {
+		sub = r.PSubscribe
+	}
+
+	s := &TypedSubscription[T]{
+		sub:     sub(channelOrPattern),
+		channel: channelOrPattern,
+		codec:   c,
+		values:  make(chan Typed[T], subscriptionQueueSize),
+	}
+	go s.decode()
+	return s
+}
+
+// Values returns the decoded messages, decode errors included. It is closed by Close
+func (s *TypedSubscription[T]) Values() <-chan Typed[T] {
+	return s.values
+}
+
+// Channel returns the channel or pattern subscribed to
+func (s *TypedSubscription[T]) Channel() string {
+	return s.channel
+}
+
+// Close releases the subscription and closes Values
+func (s *TypedSubscription[T]) Close() {
+	s.sub.Close()
+}
+
+func (s *TypedSubscription[T]) decode() {
+	defer close(s.values)
+
+	for msg := range s.sub.Messages() {
+		if s.codec != nil {
+			msg.Codec = s.codec
+		}
+		// the Body is read into msg.Data, so the Typed carries the payload
+		var value T
+		err := msg.Unmarshal(&value)
+		select {
+		case s.values <- Typed[T]{Value: value, Message: msg, Err: err}:
+		case <-s.sub.done:
+			return
+		}
+	}
+}
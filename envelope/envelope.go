@@ -0,0 +1,146 @@
+// Package envelope wraps bus payloads with metadata. An envelope is a JSON object whose first
+// key is "$envelope", anything else on the bus is a plain payload and passes through unchanged
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/compression"
+)
+
+// Version is the envelope format written by Marshal
+const Version = 1
+
+var prefix = []byte(`{"$envelope":`)
+
+// Envelope is a payload with its metadata
+type Envelope struct {
+	ID          string
+	PublishedAt time.Time
+	// Headers hold anything else: event names, producer, trace context, schema version
+	Headers map[string]string
+	// Codec is the name of the codec Body is encoded with
+	Codec string
+	// Compression names the compressor Marshal compresses Body with, empty for none.
+	// Open decompresses, Body is always uncompressed
+	Compression string
+	Body        []byte
+}
+
+// wire is the JSON form. Uncompressed JSON bodies are embedded as is, any other body is
+// base64 in Data
+type wire struct {
+	Version     int               `json:"$envelope"`
+	ID          string            `json:"id,omitempty"`
+	PublishedAt *time.Time        `json:"published_at,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Codec       string            `json:"codec,omitempty"`
+	Compression string            `json:"compression,omitempty"`
+	Body        json.RawMessage   `json:"body,omitempty"`
+	Data        []byte            `json:"data,omitempty"`
+}
+
+// New returns an envelope for a body encoded with c, with a random ID and the current time
+func New(body []byte, c codec.Codec) *Envelope {
+	return &Envelope{
+		ID:          NewID(),
+		PublishedAt: time.Now().UTC(),
+		Headers:     make(map[string]string),
+		Codec:       c.Name(),
+		Body:        body,
+	}
+}
+
+// NewID returns 16 random bytes in hex
+func NewID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(fmt.Sprintf("envelope: reading random id: %v", err))
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// Marshal encodes the envelope
+func (e *Envelope) Marshal() ([]byte, error) {
+	w := wire{
+		Version: Version,
+		ID:      e.ID,
+		Headers: e.Headers,
+		Codec:   e.Codec,
+	}
+	if !e.PublishedAt.IsZero() {
+		w.PublishedAt = &e.PublishedAt
+	}
+
+	switch {
+	case e.Compression != "":
+		c, ok := compression.Get(e.Compression)
+		if !ok {
+			return nil, fmt.Errorf("envelope: unknown compressor %q", e.Compression)
+		}
+		compressed, err := c.Compress(e.Body)
+		if err != nil {
+			return nil, err
+		}
+		w.Compression = e.Compression
+		w.Data = compressed
+	case (e.Codec == "" || e.Codec == codec.JSON.Name()) && json.Valid(e.Body):
+		w.Body = e.Body
+	default:
+		w.Data = e.Body
+	}
+	return json.Marshal(w)
+}
+
+// Is reports whether data looks like an envelope
+func Is(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), prefix)
+}
+
+// Open decodes an envelope. ok is false, without an error, for plain payloads
+func Open(data []byte) (e *Envelope, ok bool, err error) {
+	if !Is(data) {
+		return nil, false, nil
+	}
+
+	var w wire
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, true, fmt.Errorf("envelope: %w", err)
+	}
+	if w.Version < 1 || w.Version > Version {
+		return nil, true, fmt.Errorf("envelope: unsupported version %d", w.Version)
+	}
+
+	e = &Envelope{
+		ID:          w.ID,
+		Headers:     w.Headers,
+		Codec:       w.Codec,
+		Compression: w.Compression,
+		Body:        w.Data,
+	}
+	if w.PublishedAt != nil {
+		e.PublishedAt = *w.PublishedAt
+	}
+	if w.Body != nil {
+		e.Body = w.Body
+	}
+	if e.Compression != "" {
+		c, ok := compression.Get(e.Compression)
+		if !ok {
+			return nil, true, fmt.Errorf("envelope: unknown compressor %q", e.Compression)
+		}
+		if e.Body, err = c.Decompress(e.Body); err != nil {
+			return nil, true, fmt.Errorf("envelope: %w", err)
+		}
+	}
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+	return e, true, nil
+}
@@ -0,0 +1,113 @@
+package envelope_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/compression"
+	"github.com/Moonlight-Companies/goresp/envelope"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		c    codec.Codec
+		wire string
+	}{
+		{"json body is embedded", []byte(`{"id":1}`), codec.JSON, `"body":{"id":1}`},
+		{"binary body is base64", []byte{0x81, 0xa1, 0x61, 0x01}, codec.MsgPack, `"data":"gaFhAQ=="`},
+		{"invalid json is base64", []byte(`not json`), codec.JSON, `"data":"bm90IGpzb24="`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := envelope.New(tt.body, tt.c)
+			in.Headers["event"] = "created"
+
+			data, err := in.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !strings.HasPrefix(string(data), `{"$envelope":1,`) || !strings.Contains(string(data), tt.wire) {
+				t.Errorf("Marshal() = %s, want %s", data, tt.wire)
+			}
+
+			out, ok, err := envelope.Open(data)
+			if !ok || err != nil {
+				t.Fatalf("Open() = %v, %v", ok, err)
+			}
+			if !out.PublishedAt.Equal(in.PublishedAt) {
+				t.Errorf("PublishedAt = %v, want %v", out.PublishedAt, in.PublishedAt)
+			}
+			out.PublishedAt = in.PublishedAt
+			if !reflect.DeepEqual(out, in) {
+				t.Errorf("Open() = %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestOpenPlainPayloads(t *testing.T) {
+	for _, payload := range []string{`{"id":1}`, `[1,2]`, `text`, ``, `{"envelope":1}`} {
+		e, ok, err := envelope.Open([]byte(payload))
+		if e != nil || ok || err != nil {
+			t.Errorf("Open(%q) = %v, %v, %v, want a plain payload", payload, e, ok, err)
+		}
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	for _, payload := range []string{`{"$envelope":1,"body":`, `{"$envelope":2}`, `{"$envelope":0}`} {
+		if _, ok, err := envelope.Open([]byte(payload)); !ok || err == nil {
+			t.Errorf("Open(%q) = %v, %v, want an error", payload, ok, err)
+		}
+	}
+}
+
+func TestOpenMinimalEnvelope(t *testing.T) {
+	e, ok, err := envelope.Open([]byte(` {"$envelope":1,"body":"hi"}`))
+	if !ok || err != nil {
+		t.Fatalf("Open() = %v, %v", ok, err)
+	}
+	if string(e.Body) != `"hi"` || e.ID != "" || !e.PublishedAt.Equal(time.Time{}) || e.Headers == nil {
+		t.Errorf("Open() = %+v", e)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := envelope.NewID(), envelope.NewID()
+	if len(a) != 32 || a == b {
+		t.Errorf("NewID() = %q, %q", a, b)
+	}
+}
+
+func TestEnvelopeCompression(t *testing.T) {
+	body := []byte(`{"items":"` + strings.Repeat("lamp ", 200) + `"}`)
+	in := envelope.New(body, codec.JSON)
+	in.Compression = compression.Gzip.Name()
+
+	data, err := in.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if len(data) >= len(body) || !strings.Contains(string(data), `"compression":"gzip","data":`) {
+		t.Errorf("Marshal() = %s, want a compressed body", data)
+	}
+
+	out, _, err := envelope.Open(data)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if string(out.Body) != string(body) || out.Compression != "gzip" {
+		t.Errorf("Open() = %+v, want the decompressed body", out)
+	}
+
+	in.Compression = "zstd"
+	if _, err := in.Marshal(); err == nil {
+		t.Errorf("Marshal() with an unknown compressor did not fail")
+	}
+}
@@ -0,0 +1,129 @@
+// Package glob implements the glob style patterns Redis uses for PSUBSCRIBE, KEYS and SCAN
+package glob
+
+// maxNesting mirrors the protection Redis has against abusive patterns
+const maxNesting = 1000
+
+// Match reports whether s matches pattern with the exact semantics of Redis stringmatchlen:
+// * matches any run of bytes, ? any single byte, [abc] a set, [a-z] a range (either order),
+// [^abc] a negated set and \ escapes the next byte, inside a set as well.
+// An unterminated set is closed by the end of the pattern
+func Match(pattern, s string) bool {
+	skipLongerMatches := false
+	return match(pattern, s, &skipLongerMatches, 0)
+}
+
+// IsPattern reports whether s contains an unescaped *, ? or [, the characters that make
+// PSUBSCRIBE match anything other than the literal string
+func IsPattern(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// at returns pattern[i], or 0 past the end where the C implementation reads the terminator
+func at(pattern string, i int) byte {
+	if i < len(pattern) {
+		return pattern[i]
+	}
+	return 0
+}
+
+func match(pattern, s string, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+
+	p, i := 0, 0
+	for p < len(pattern) && i < len(s) {
+		switch pattern[p] {
+		case '*':
+			for p < len(pattern) && at(pattern, p+1) == '*' {
+				p++
+			}
+			if len(pattern)-p == 1 {
+				return true
+			}
+			for i < len(s) {
+				if match(pattern[p+1:], s[i:], skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				i++
+			}
+			// the rest of the pattern matches nowhere in the rest of the string, so no
+			// earlier * can match either by consuming more
+			*skipLongerMatches = true
+			return false
+		case '?':
+			i++
+		case '[':
+			p++
+			not := at(pattern, p) == '^'
+			if not {
+				p++
+			}
+			matched := false
+			for {
+				if at(pattern, p) == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == s[i] {
+						matched = true
+					}
+				} else if at(pattern, p) == ']' {
+					break
+				} else if len(pattern)-p <= 0 {
+					p--
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					if start > end {
+						start, end = end, start
+					}
+					p += 2
+					if s[i] >= start && s[i] <= end {
+						matched = true
+					}
+				} else if pattern[p] == s[i] {
+					matched = true
+				}
+				p++
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			i++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			fallthrough
+		default:
+			if pattern[p] != s[i] {
+				return false
+			}
+			i++
+		}
+
+		p++
+		if i == len(s) {
+			for at(pattern, p) == '*' {
+				p++
+			}
+			break
+		}
+	}
+
+	return p == len(pattern) && i == len(s)
+}
@@ -0,0 +1,91 @@
+package glob_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Moonlight-Companies/goresp/glob"
+)
+
+// expected results follow Redis stringmatchlen, including its edge cases
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "anything", true},
+		{"*", "", false}, // Redis never matches an empty string, not even with *
+		{"", "", true},
+		{"", "a", false},
+		{"a*", "a", true},
+		{"a**", "a", true},
+		{"*a", "", false},
+		{"news.*", "news.sports", true},
+		{"news.*", "news", false},
+		{"*.sports", "news.sports", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"?", "", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[b-a]llo", "hallo", true}, // reversed ranges are swapped
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"h\\?llo", "h?llo", true},
+		{"h\\[a]llo", "h[a]llo", true},
+		{"[\\]]", "]", true},
+		{"[\\^a]", "^", true},
+		{"[\\-]", "-", true},
+		{"[]", "a", false},
+		{"[abc", "b", true}, // the end of the pattern closes the set
+		{"[abc", "d", false},
+		{"[a-", "-", true},
+		{"[^", "a", true}, // an empty negated set matches any byte
+		{"\\", "\\", true},
+		{"a\\", "a\\", true},
+		{"\\a", "a", true},
+		{"*[0-9]", "chan7", true},
+		{"*[0-9]", "chan", false},
+		{"user:*:profile", "user:42:profile", true},
+		{"user:*:profile", "user:42:settings", false},
+		{"a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 60), false},
+		{strings.Repeat("*a", 1100), strings.Repeat("a", 1100), false}, // nesting limit
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.s, func(t *testing.T) {
+			if got := glob.Match(tt.pattern, tt.s); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPattern(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"orders", false},
+		{"orders.*", true},
+		{"order?", true},
+		{"order[12]", true},
+		{"orders\\*", false},
+		{"a\\\\*", true},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := glob.IsPattern(tt.s); got != tt.want {
+			t.Errorf("IsPattern(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+)
+
+const (
+	defaultQueueSize  = 1000
+	defaultBatchCount = 100
+	defaultBatchBytes = 64 * 1024
+
+	// connectPollInterval is how often a batch waiting for the connection checks on it
+	connectPollInterval = 10 * time.Millisecond
+	defaultCloseTimeout = 5 * time.Second
+)
+
+// Option configures a Publisher
+type Option func(*Publisher)
+
+// WithQueueSize sets how many messages can wait to be published, 1000 by default
+func WithQueueSize(n int) Option {
+	return func(p *Publisher) {
+		if n > 0 {
+			p.queueSize = n
+		}
+	}
+}
+
+// WithBatchCount flushes a batch once it holds n messages, 100 by default
+func WithBatchCount(n int) Option {
+	return func(p *Publisher) {
+		if n > 0 {
+			p.batchCount = n
+		}
+	}
+}
+
+// WithBatchBytes flushes a batch once its payloads add up to n bytes, 64 KiB by default
+func WithBatchBytes(n int) Option {
+	return func(p *Publisher) {
+		if n > 0 {
+			p.batchBytes = n
+		}
+	}
+}
+
+// WithLinger waits up to d after the first message of a batch for more to arrive. By default
+// a batch is flushed as soon as the queue is empty
+func WithLinger(d time.Duration) Option {
+	return func(p *Publisher) {
+		p.linger = d
+	}
+}
+
+// WithCloseTimeout bounds how long Close tries to publish what is left, 5 seconds by default
+func WithCloseTimeout(d time.Duration) Option {
+	return func(p *Publisher) {
+		p.closeTimeout = d
+	}
+}
+
+// WithTransactions wraps every batch in MULTI/EXEC so it is published atomically
+func WithTransactions() Option {
+	return func(p *Publisher) {
+		p.transactions = true
+	}
+}
+
+// batch is the queued commands written together with a single Send
+type batch struct {
+	buf   bytes.Buffer
+	count int
+	bytes int
+}
+
+// add appends cmd to the batch, a message the sink can't format is counted as dropped
+func (p *Publisher) add(b *batch, cmd publishCommand) {
+	if b.count == 0 && p.transactions {
+		command.FormatCommandWriter(&b.buf, "MULTI")
+	}
+	if err := p.sink.format(&b.buf, cmd); err != nil {
+		if b.count == 0 {
+			b.buf.Reset()
+		}
+		p.dropped.Add(1)
+		p.logger.Warn("Dropping a message for %s: %v", cmd.Channel, err)
+		return
+	}
+	b.count++
+	b.bytes += len(cmd.Channel) + len(cmd.Message)
+}
+
+func (p *Publisher) full(b *batch) bool {
+	return b.count >= p.batchCount || b.bytes >= p.batchBytes
+}
+
+// flush sends the batch to the sink, the batch is kept when ctx ends first
+func (p *Publisher) flush(ctx context.Context, b *batch) error {
+	if b.count == 0 {
+		return nil
+	}
+
+	// the batch is reused, the sink may keep a reference to what it is sent
+	data := append([]byte(nil), b.buf.Bytes()...)
+	commands := b.count
+	if p.transactions {
+		data = append(data, command.FormatCommand("EXEC")...)
+		commands += 2
+	}
+
+	if err := p.sink.send(ctx, data, commands); err != nil {
+		return err
+	}
+
+	b.buf.Reset()
+	b.count = 0
+	b.bytes = 0
+	return nil
+}
+
+func (p *Publisher) run() {
+	defer close(p.stopped)
+
+	var (
+		b      batch
+		timer  *time.Timer
+		linger <-chan time.Time
+	)
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, linger = nil, nil
+		}
+		// only fails when closing, drain sends what is left
+		p.flush(p.ctx, &b)
+	}
+
+	for {
+		select {
+		case cmd := <-p.queue:
+			p.add(&b, cmd)
+			switch {
+			case p.full(&b):
+				flush()
+			case p.linger <= 0:
+				if len(p.queue) == 0 {
+					flush()
+				}
+			case timer == nil:
+				timer = time.NewTimer(p.linger)
+				linger = timer.C
+			}
+		case <-linger:
+			timer, linger = nil, nil
+			flush()
+		case <-p.intakeClosed:
+			if timer != nil {
+				timer.Stop()
+			}
+			p.drain(&b)
+			return
+		}
+	}
+}
+
+// drain sends the batch and whatever is queued, giving up after the close timeout
+func (p *Publisher) drain(b *batch) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.closeTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case cmd := <-p.queue:
+			p.add(b, cmd)
+			if !p.full(b) {
+				continue
+			}
+		default:
+		}
+
+		pending := b.count
+		if err := p.flush(ctx, b); err != nil {
+			lost := pending + len(p.queue)
+			p.dropped.Add(uint64(lost))
+			p.logger.Warn("Dropping %d messages on close: %v", lost, err)
+			return
+		}
+		if len(p.queue) == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package publish
+
+import (
+	"context"
+)
+
+// OverflowPolicy decides what publishing does when the queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowError returns ErrorQueueFull, the default
+	OverflowError OverflowPolicy = iota
+	// OverflowBlock waits for room in the queue
+	OverflowBlock
+	// OverflowDropOldest discards the oldest queued message to make room
+	OverflowDropOldest
+)
+
+// WithOverflow sets the policy for a full queue. Messages queue up while the connection is
+// down, so OverflowBlock and OverflowDropOldest keep bursts from failing during a reconnect
+func WithOverflow(policy OverflowPolicy) Option {
+	return func(p *Publisher) {
+		p.overflow = policy
+	}
+}
+
+// enqueue queues cmd according to the overflow policy. Messages are queued with p.intake held
+// for reading, once Close took it the queue only shrinks and drain accounts for all of it
+func (p *Publisher) enqueue(cmd publishCommand) error {
+	switch p.overflow {
+	case OverflowBlock:
+		return p.enqueueContext(context.Background(), cmd)
+	case OverflowDropOldest:
+		return p.enqueueDropOldest(cmd)
+	}
+
+	p.intake.RLock()
+	defer p.intake.RUnlock()
+
+	if p.closed || p.ctx.Err() != nil {
+		return ErrClosed
+	}
+	select {
+	case p.queue <- cmd:
+		return nil
+	default:
+		return ErrorQueueFull
+	}
+}
+
+func (p *Publisher) enqueueContext(ctx context.Context, cmd publishCommand) error {
+	p.intake.RLock()
+	defer p.intake.RUnlock()
+
+	if p.closed || p.ctx.Err() != nil {
+		return ErrClosed
+	}
+	select {
+	case p.queue <- cmd:
+		return nil
+	case <-p.ctx.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Publisher) enqueueDropOldest(cmd publishCommand) error {
+	p.intake.RLock()
+	defer p.intake.RUnlock()
+
+	if p.closed || p.ctx.Err() != nil {
+		return ErrClosed
+	}
+	for {
+		select {
+		case p.queue <- cmd:
+			return nil
+		default:
+		}
+
+		select {
+		case <-p.queue:
+			p.dropped.Add(1)
+		default:
+		}
+	}
+}
@@ -1,51 +1,65 @@
 package publish
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"sync"
 
-	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/compression"
 	"github.com/Moonlight-Companies/goresp/connection"
 )
 
 var ErrorQueueFull = errors.New("queue full")
 
-func Publish(channel string, message map[string]interface{}) error {
-	json, err := json.Marshal(message)
-	if err != nil {
-		return err
-	}
+// ErrClosed is returned when publishing on a closed Publisher
+var ErrClosed = errors.New("publisher closed")
+
+var (
+	defaultOnce      sync.Once
+	defaultPublisher *Publisher
+)
 
-	select {
-	case publish_message_queue <- publishCommand{Channel: channel, Message: json}:
-		return nil
-	default:
-		return ErrorQueueFull
-	}
+// Default returns the Publisher behind the package functions, connected to bus:6379
+func Default() *Publisher {
+	defaultOnce.Do(func() {
+		defaultPublisher = NewPublisher(connection.NewReconnecting("bus:6379"))
+	})
+	return defaultPublisher
 }
 
-func PublishWithEvent(channel string, event string, message map[string]interface{}) error {
-	clone := make(map[string]interface{}, len(message)+1)
-	for k, v := range message {
-		clone[k] = v
-	}
-	clone["Event"] = event
-	return Publish(channel, clone)
+// SetCodec chooses the codec used for a channel, or for channels matching a pattern.
+// Channels without one are published as JSON
+func SetCodec(channelOrPattern string, c codec.Codec) {
+	Default().SetCodec(channelOrPattern, c)
 }
 
-type publishCommand struct {
-	Channel string
-	Message []byte
+// SetCompression compresses payloads of at least threshold bytes with c, nil turns it off.
+// Subscribers decompress with whatever compressor the payload names
+func SetCompression(c compression.Compressor, threshold int) {
+	Default().SetCompression(c, threshold)
 }
 
-var conn *connection.Reconnecting = connection.NewReconnecting("bus:6379")
-var publish_message_queue = make(chan publishCommand, 1000)
+func Publish(channel string, message map[string]interface{}) error {
+	return Default().Publish(channel, message)
+}
 
-func init() {
-	go func() {
-		for msg := range publish_message_queue {
-			payload := command.FormatCommand("publish", msg.Channel, string(msg.Message))
-			conn.Send(payload)
-		}
-	}()
+// PublishValue marshals message with the channel's codec and queues it for publishing
+func PublishValue(channel string, message interface{}) error {
+	return Default().PublishValue(channel, message)
+}
+
+// PublishContext queues message for publishing, waiting for room in the queue until ctx is done
+func PublishContext(ctx context.Context, channel string, message interface{}) error {
+	return Default().PublishContext(ctx, channel, message)
+}
+
+// PublishEnvelope marshals message with the channel's codec and publishes it in an envelope
+// carrying headers, a new ID and the current time
+func PublishEnvelope(channel string, headers map[string]string, message interface{}) error {
+	return Default().PublishEnvelope(channel, headers, message)
+}
+
+func PublishWithEvent(channel string, event string, message map[string]interface{}) error {
+	return Default().PublishWithEvent(channel, event, message)
 }
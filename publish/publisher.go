@@ -0,0 +1,193 @@
+package publish
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/codec"
+	"github.com/Moonlight-Companies/goresp/compression"
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/envelope"
+	"github.com/Moonlight-Companies/goresp/logging"
+)
+
+type publishCommand struct {
+	Channel string
+	Message []byte
+}
+
+// Publisher marshals messages and publishes them over a Reconnecting in batches. The
+// Reconnecting must not be subscribed to anything, RESP2 forbids PUBLISH on a subscribed
+// connection
+type Publisher struct {
+	sink                 sink
+	codecs               *codec.Registry
+	mutex                sync.RWMutex
+	compressor           compression.Compressor
+	compressionThreshold int
+	intake               sync.RWMutex // held for reading while a message is queued
+	closed               bool
+	intakeClosed         chan struct{}
+	queue                chan publishCommand
+	queueSize            int
+	batchCount           int
+	batchBytes           int
+	linger               time.Duration
+	transactions         bool
+	maxLen               int
+	closeTimeout         time.Duration
+	overflow             OverflowPolicy
+	dropped              atomic.Uint64
+	logger               *logging.Logger
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	stopped              chan struct{}
+}
+
+// NewPublisher starts a Publisher writing to conn
+func NewPublisher(conn *connection.Reconnecting, options ...Option) *Publisher {
+	p := newPublisher(options)
+	p.sink = &pubsubSink{conn: conn}
+
+	go p.run()
+	return p
+}
+
+// newPublisher applies the options, the caller sets the sink and starts run
+func newPublisher(options []Option) *Publisher {
+	p := &Publisher{
+		codecs:       codec.NewRegistry(codec.JSON),
+		queueSize:    defaultQueueSize,
+		batchCount:   defaultBatchCount,
+		batchBytes:   defaultBatchBytes,
+		closeTimeout: defaultCloseTimeout,
+		logger:       logging.NewLogger(logging.LogLevelInfo),
+		intakeClosed: make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for _, option := range options {
+		option(p)
+	}
+	p.queue = make(chan publishCommand, p.queueSize)
+	return p
+}
+
+// Close publishes what is queued and stops the Publisher, conn is left open. Messages that
+// cannot be handed to conn within a few seconds are dropped
+func (p *Publisher) Close() {
+	// interrupts a flush waiting for the connection and publishers waiting for room
+	p.cancel()
+
+	p.intake.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.intakeClosed)
+	}
+	p.intake.Unlock()
+
+	<-p.stopped
+}
+
+// Dropped returns how many messages were discarded by OverflowDropOldest, on Close or because
+// they could not be formatted
+func (p *Publisher) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// SetCodec chooses the codec used for a channel, or for channels matching a pattern.
+// Channels without one are published as JSON
+func (p *Publisher) SetCodec(channelOrPattern string, c codec.Codec) {
+	p.codecs.Set(channelOrPattern, c)
+}
+
+// SetCompression compresses payloads of at least threshold bytes with c, nil turns it off.
+// Subscribers decompress with whatever compressor the payload names
+func (p *Publisher) SetCompression(c compression.Compressor, threshold int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.compressor = c
+	p.compressionThreshold = threshold
+}
+
+// compressorFor returns the compressor for a payload of size bytes, nil when it stays as is
+func (p *Publisher) compressorFor(size int) compression.Compressor {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.compressor == nil || size < p.compressionThreshold {
+		return nil
+	}
+	return p.compressor
+}
+
+func (p *Publisher) Publish(channel string, message map[string]interface{}) error {
+	return p.PublishValue(channel, message)
+}
+
+// PublishValue marshals message with the channel's codec and queues it for publishing,
+// a full queue is handled by the overflow policy
+func (p *Publisher) PublishValue(channel string, message interface{}) error {
+	payload, err := p.encode(channel, message)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(publishCommand{Channel: channel, Message: payload})
+}
+
+// PublishContext is PublishValue waiting for room in the queue until ctx is done, whatever
+// the overflow policy
+func (p *Publisher) PublishContext(ctx context.Context, channel string, message interface{}) error {
+	payload, err := p.encode(channel, message)
+	if err != nil {
+		return err
+	}
+	return p.enqueueContext(ctx, publishCommand{Channel: channel, Message: payload})
+}
+
+// encode marshals message with the channel's codec, compressing large payloads
+func (p *Publisher) encode(channel string, message interface{}) ([]byte, error) {
+	payload, err := p.codecs.For(channel).Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	if c := p.compressorFor(len(payload)); c != nil {
+		return compression.Wrap(c, payload)
+	}
+	return payload, nil
+}
+
+// PublishEnvelope marshals message with the channel's codec and publishes it in an envelope
+// carrying headers, a new ID and the current time
+func (p *Publisher) PublishEnvelope(channel string, headers map[string]string, message interface{}) error {
+	c := p.codecs.For(channel)
+	body, err := c.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	e := envelope.New(body, c)
+	for k, v := range headers {
+		e.Headers[k] = v
+	}
+	if c := p.compressorFor(len(body)); c != nil {
+		e.Compression = c.Name()
+	}
+	payload, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	return p.enqueue(publishCommand{Channel: channel, Message: payload})
+}
+
+func (p *Publisher) PublishWithEvent(channel string, event string, message map[string]interface{}) error {
+	clone := make(map[string]interface{}, len(message)+1)
+	for k, v := range message {
+		clone[k] = v
+	}
+	clone["Event"] = event
+	return p.Publish(channel, clone)
+}
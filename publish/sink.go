@@ -0,0 +1,46 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/connection"
+)
+
+// sink is where a Publisher writes its batches
+type sink interface {
+	// format appends the command publishing cmd to buf, nothing is appended on error
+	format(buf *bytes.Buffer, cmd publishCommand) error
+	// send writes n encoded commands, waiting for the connection until ctx ends
+	send(ctx context.Context, data []byte, n int) error
+}
+
+// pubsubSink publishes with PUBLISH over a Reconnecting, replies are not read
+type pubsubSink struct {
+	conn *connection.Reconnecting
+}
+
+func (s *pubsubSink) format(buf *bytes.Buffer, cmd publishCommand) error {
+	return command.FormatCommandWriter(buf, "PUBLISH", cmd.Channel, string(cmd.Message))
+}
+
+// send waits for the connection and writes the batch, again when the connection drops before
+// the batch was written
+func (s *pubsubSink) send(ctx context.Context, data []byte, n int) error {
+	for {
+		for !s.conn.Connected() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(connectPollInterval):
+			}
+		}
+
+		err := s.conn.SendWait(ctx, data)
+		if err != connection.ErrNotConnected {
+			return err
+		}
+	}
+}
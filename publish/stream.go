@@ -0,0 +1,144 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/logging"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// streamRetryDelay paces the retries of a batch whose round trip failed
+const streamRetryDelay = 100 * time.Millisecond
+
+// WithMaxLen trims streams to about n entries on every XADD, with MAXLEN ~ n. Only stream
+// publishers use it, streams grow unbounded by default
+func WithMaxLen(n int) Option {
+	return func(p *Publisher) {
+		if n > 0 {
+			p.maxLen = n
+		}
+	}
+}
+
+// StreamPublisher appends messages to streams with XADD instead of publishing them, so they
+// are kept until a consumer group acknowledges them. The queued methods it shares with
+// Publisher work the same way, with the channel naming the stream and the encoded payload
+// stored in the connection.StreamDataField field. Batches are retried after a failed round
+// trip, an entry may then be added twice
+type StreamPublisher struct {
+	*Publisher
+	client *connection.Client
+}
+
+// NewStreamPublisher starts a StreamPublisher writing to client
+func NewStreamPublisher(client *connection.Client, options ...Option) *StreamPublisher {
+	p := newPublisher(options)
+	p.sink = &streamSink{client: client, maxLen: p.maxLen, logger: p.logger}
+
+	go p.run()
+	return &StreamPublisher{Publisher: p, client: client}
+}
+
+// Add marshals message with the stream's codec and appends it right away, returning the
+// entry ID
+func (p *StreamPublisher) Add(ctx context.Context, stream string, message interface{}) (string, error) {
+	payload, err := p.encode(stream, message)
+	if err != nil {
+		return "", err
+	}
+	return p.add(ctx, stream, connection.StreamDataField, payload)
+}
+
+// AddFields appends an entry whose fields are the keys of a map or the fields of a struct,
+// named by their `resp` tags, and returns its ID. Values are sent as text without a codec
+func (p *StreamPublisher) AddFields(ctx context.Context, stream string, fields interface{}) (string, error) {
+	return p.add(ctx, stream, fields)
+}
+
+func (p *StreamPublisher) add(ctx context.Context, stream string, fields ...interface{}) (string, error) {
+	reply, err := p.client.Do(ctx, xaddArgs(stream, p.maxLen, fields...)...)
+	if err != nil {
+		return "", err
+	}
+	return reply.AsString()
+}
+
+// xaddArgs builds XADD stream [MAXLEN ~ maxLen] * fields...
+func xaddArgs(stream string, maxLen int, fields ...interface{}) []interface{} {
+	args := []interface{}{"XADD", stream}
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	args = append(args, "*")
+	return append(args, fields...)
+}
+
+// streamSink adds entries with XADD over a Client
+type streamSink struct {
+	client *connection.Client
+	maxLen int
+	logger *logging.Logger
+}
+
+func (s *streamSink) format(buf *bytes.Buffer, cmd publishCommand) error {
+	data, err := command.FormatCommandArgs(xaddArgs(cmd.Channel, s.maxLen, connection.StreamDataField, cmd.Message)...)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+func (s *streamSink) send(ctx context.Context, data []byte, n int) error {
+	for {
+		replies, err := s.client.Pipeline(ctx, data, n)
+		if err == nil {
+			if rejected := countErrors(replies); rejected > 0 {
+				s.logger.Warn("Server rejected %d of the batch's stream entries: %v", rejected, firstError(replies))
+			}
+			return nil
+		}
+		if ctx.Err() != nil || errors.Is(err, connection.ErrClientClosed) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(streamRetryDelay):
+		}
+	}
+}
+
+// countErrors counts the error replies, inside EXEC's array as well
+func countErrors(replies []resp.RESPValue) int {
+	count := 0
+	for _, reply := range replies {
+		if reply.Err() != nil {
+			count++
+		}
+		if items, err := reply.AsArray(); err == nil {
+			count += countErrors(items)
+		}
+	}
+	return count
+}
+
+func firstError(replies []resp.RESPValue) error {
+	for _, reply := range replies {
+		if err := reply.Err(); err != nil {
+			return err
+		}
+		if items, err := reply.AsArray(); err == nil {
+			if err := firstError(items); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package publish_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/publish"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func TestPublishQueueFull(t *testing.T) {
+	// nothing listens on port 1, every message stays queued
+	conn := connection.NewReconnecting("127.0.0.1:1")
+	defer conn.Close()
+	p := publish.NewPublisher(conn, publish.WithQueueSize(2), publish.WithBatchCount(1), publish.WithCloseTimeout(10*time.Millisecond))
+
+	accepted := 0
+	for ; accepted < 10; accepted++ {
+		err := p.PublishValue("events", accepted)
+		if err == publish.ErrorQueueFull {
+			break
+		}
+		if err != nil {
+			t.Fatalf("PublishValue() error = %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if accepted != 3 {
+		t.Errorf("%d messages accepted, want 2 queued and 1 waiting for the connection", accepted)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.PublishContext(ctx, "events", "late"); err != context.DeadlineExceeded {
+		t.Errorf("PublishContext() = %v, want DeadlineExceeded", err)
+	}
+
+	p.Close()
+	if got := p.Dropped(); got != uint64(accepted) {
+		t.Errorf("Dropped() = %d after Close, want %d", got, accepted)
+	}
+	if err := p.PublishContext(context.Background(), "events", 1); err != publish.ErrClosed {
+		t.Errorf("PublishContext() after Close = %v, want ErrClosed", err)
+	}
+}
+
+// burstDuringReconnect publishes 0..19 while the publisher's connection is down and returns
+// what a subscriber receives once it is back
+func burstDuringReconnect(t *testing.T, options ...publish.Option) ([]int, *publish.Publisher) {
+	t.Helper()
+
+	s := redistest.NewServer(t)
+	subscriber := connection.NewReconnecting(s.Addr())
+	defer subscriber.Close()
+	sub := connection.SubscribeJSON[int](subscriber, "events")
+	defer sub.Close()
+	if !s.WaitForSubscribers("events", 1, 5*time.Second) {
+		t.Fatalf("subscriber did not subscribe")
+	}
+
+	proxy := redistest.NewProxy(t, s.Addr())
+	conn := connection.NewReconnecting(proxy.Addr())
+	defer conn.Close()
+	if !s.WaitFor(5*time.Second, conn.Connected) {
+		t.Fatalf("publisher did not connect")
+	}
+	p := publish.NewPublisher(conn, append(options, publish.WithBatchCount(1))...)
+	defer p.Close()
+
+	proxy.Reset()
+	if !s.WaitFor(5*time.Second, func() bool { return !conn.Connected() }) {
+		t.Fatalf("publisher did not notice the reset")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := p.PublishValue("events", i); err != nil {
+				t.Errorf("PublishValue() error = %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var received []int
+	for {
+		select {
+		case typed := <-sub.Values():
+			received = append(received, typed.Value)
+			if typed.Value == 19 {
+				<-done
+				return received, p
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received %v, the burst did not arrive", received)
+		}
+	}
+}
+
+func TestPublishBlockDuringReconnect(t *testing.T) {
+	received, p := burstDuringReconnect(t, publish.WithQueueSize(5), publish.WithOverflow(publish.OverflowBlock))
+
+	if len(received) != 20 {
+		t.Fatalf("received %v, want all 20 messages", received)
+	}
+	for i, value := range received {
+		if value != i {
+			t.Fatalf("received %v out of order", received)
+		}
+	}
+	if p.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", p.Dropped())
+	}
+}
+
+func TestPublishDropOldestDuringReconnect(t *testing.T) {
+	received, p := burstDuringReconnect(t, publish.WithQueueSize(5), publish.WithOverflow(publish.OverflowDropOldest))
+
+	// the first message waits for the connection, the queue keeps the newest five
+	want := []int{0, 15, 16, 17, 18, 19}
+	if len(received) != len(want) {
+		t.Fatalf("received %v, want %v", received, want)
+	}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Fatalf("received %v, want %v", received, want)
+		}
+	}
+	if p.Dropped() != 14 {
+		t.Errorf("Dropped() = %d, want 14", p.Dropped())
+	}
+}
+
+func TestPublishCloseAccountsForEveryMessage(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := newPublisher(t, s, publish.WithQueueSize(50), publish.WithCloseTimeout(2*time.Second))
+
+	var accepted atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := p.PublishValue("events", 1)
+				if err == publish.ErrClosed {
+					return
+				}
+				if err == nil {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	p.Close()
+	wg.Wait()
+
+	// every accepted message was published or counted as dropped
+	want := int(accepted.Load()) - int(p.Dropped())
+	if !s.WaitForCommand("PUBLISH", want, 5*time.Second) {
+		t.Fatalf("PUBLISH received %d times, want %d", s.CommandCount("PUBLISH"), want)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := s.CommandCount("PUBLISH"); got != want {
+		t.Errorf("PUBLISH received %d times, want %d", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+package publish_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/publish"
+	"github.com/Moonlight-Companies/goresp/redistest"
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+// newPublisher returns a Publisher whose connection is established, with the commands sent
+// while connecting cleared
+func newPublisher(tb testing.TB, s *redistest.Server, options ...publish.Option) *publish.Publisher {
+	tb.Helper()
+
+	conn := connection.NewReconnecting(s.Addr())
+	tb.Cleanup(conn.Close)
+	if !s.WaitForCommand("PING", 1, 5*time.Second) {
+		tb.Fatalf("publisher did not connect")
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.ClearCommands()
+
+	p := publish.NewPublisher(conn, options...)
+	tb.Cleanup(p.Close)
+	return p
+}
+
+func publishN(t *testing.T, p *publish.Publisher, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := p.PublishValue("events", i); err != nil {
+			t.Fatalf("PublishValue() error = %v", err)
+		}
+	}
+}
+
+func TestPublisherFlushesByCount(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := newPublisher(t, s, publish.WithBatchCount(10), publish.WithLinger(time.Hour), publish.WithTransactions())
+
+	publishN(t, p, 25)
+	if !s.WaitForCommand("EXEC", 2, 5*time.Second) {
+		t.Fatalf("full batches were not flushed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := s.CommandCount("PUBLISH"); got != 20 {
+		t.Errorf("PUBLISH received %d times before Close, want 20", got)
+	}
+
+	p.Close()
+	if !s.WaitForCommand("PUBLISH", 25, 5*time.Second) {
+		t.Fatalf("Close did not flush the last batch")
+	}
+	if got := s.CommandCount("MULTI"); got != 3 {
+		t.Errorf("MULTI received %d times, want 3", got)
+	}
+	if err := p.PublishValue("events", 1); err != publish.ErrClosed {
+		t.Errorf("PublishValue() after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestPublisherFlushesAfterLinger(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := newPublisher(t, s, publish.WithLinger(50*time.Millisecond), publish.WithTransactions())
+
+	start := time.Now()
+	publishN(t, p, 3)
+	if !s.WaitForCommand("EXEC", 1, 5*time.Second) {
+		t.Fatalf("batch was not flushed after the linger time")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("batch flushed after %v, before the linger time", elapsed)
+	}
+	if got := s.CommandCount("PUBLISH"); got != 3 {
+		t.Errorf("PUBLISH received %d times, want 3 in one batch", got)
+	}
+}
+
+func TestPublisherFlushesByBytes(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := newPublisher(t, s, publish.WithBatchBytes(100), publish.WithLinger(time.Hour), publish.WithTransactions())
+
+	// 6 bytes of channel and 36 of payload, the third message fills a batch
+	payload := strings.Repeat("x", 34)
+	for i := 0; i < 7; i++ {
+		if err := p.PublishValue("events", payload); err != nil {
+			t.Fatalf("PublishValue() error = %v", err)
+		}
+	}
+	if !s.WaitForCommand("PUBLISH", 6, 5*time.Second) {
+		t.Fatalf("batches were not flushed by size")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := s.CommandCount("MULTI"); got != 2 {
+		t.Errorf("MULTI received %d times, want 2", got)
+	}
+}
+
+func TestPublisherDeliversInOrder(t *testing.T) {
+	s := redistest.NewServer(t)
+	subscriber := connection.NewReconnecting(s.Addr())
+	defer subscriber.Close()
+	sub := connection.SubscribeJSON[int](subscriber, "events")
+	defer sub.Close()
+	if !s.WaitForSubscribers("events", 1, 5*time.Second) {
+		t.Fatalf("subscriber did not subscribe")
+	}
+
+	p := newPublisher(t, s, publish.WithBatchCount(7))
+	publishN(t, p, 50)
+
+	for want := 0; want < 50; want++ {
+		select {
+		case typed := <-sub.Values():
+			if typed.Err != nil || typed.Value != want {
+				t.Fatalf("received %+v, want %d", typed, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d was not delivered", want)
+		}
+	}
+}
+
+func BenchmarkPublisher(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		options []publish.Option
+	}{
+		{"unbatched", []publish.Option{publish.WithBatchCount(1)}},
+		{"batched", nil},
+		{"linger", []publish.Option{publish.WithLinger(time.Millisecond), publish.WithBatchCount(500)}},
+		{"transactions", []publish.Option{publish.WithTransactions()}},
+	}
+
+	payload := map[string]interface{}{"event": "created", "id": 12345, "item": "lamp"}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			s := redistest.NewServer(b)
+			var received atomic.Int64
+			s.Handle("PUBLISH", func(c *server.Conn, cmd server.Command) {
+				received.Add(1)
+				c.WriteInteger(0)
+			})
+			p := newPublisher(b, s, bm.options...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := p.PublishContext(context.Background(), "events", payload); err != nil {
+					b.Fatalf("PublishContext() error = %v", err)
+				}
+			}
+			// wait until everything arrived or nothing more does and report the losses
+			last, idle := int64(-1), time.Now()
+			s.WaitFor(30*time.Second, func() bool {
+				n := received.Load()
+				if n != last {
+					last, idle = n, time.Now()
+				}
+				return n >= int64(b.N) || time.Since(idle) > 200*time.Millisecond
+			})
+			b.StopTimer()
+			b.ReportMetric(float64(received.Load())/b.Elapsed().Seconds(), "msgs/s")
+			b.ReportMetric(float64(int64(b.N)-received.Load())/float64(b.N), "lost/op")
+			s.ClearCommands()
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package publish_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/publish"
+	"github.com/Moonlight-Companies/goresp/redistest"
+)
+
+func newStreamPublisher(t *testing.T, s *redistest.Server, options ...publish.Option) (*publish.StreamPublisher, *connection.Client) {
+	t.Helper()
+
+	client := connection.NewClient(s.Addr())
+	t.Cleanup(client.Close)
+	p := publish.NewStreamPublisher(client, options...)
+	t.Cleanup(p.Close)
+	return p, client
+}
+
+func TestStreamPublisherAdd(t *testing.T) {
+	s := redistest.NewServer(t)
+	p, client := newStreamPublisher(t, s, publish.WithMaxLen(3))
+
+	ctx := context.Background()
+	var last string
+	for i := 0; i < 5; i++ {
+		id, err := p.Add(ctx, "orders", map[string]int{"id": i})
+		if err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		if id == "" || id == last {
+			t.Fatalf("Add() returned ID %q after %q", id, last)
+		}
+		last = id
+	}
+	if got := s.StreamLen("orders"); got != 3 {
+		t.Errorf("stream holds %d entries, want 3 after MAXLEN trimming", got)
+	}
+
+	reply, err := client.Do(ctx, "XRANGE", "orders", last, last)
+	if err != nil {
+		t.Fatalf("XRANGE error = %v", err)
+	}
+	entries, _ := reply.AsArray()
+	if len(entries) != 1 {
+		t.Fatalf("XRANGE returned %v", reply)
+	}
+	fields, _ := entries[0].AsArray()
+	entry, _ := fields[1].AsMap()
+	if entry[connection.StreamDataField] != `{"id":4}` {
+		t.Errorf("entry fields = %v, want the JSON payload in %q", entry, connection.StreamDataField)
+	}
+}
+
+func TestStreamPublisherAddFields(t *testing.T) {
+	s := redistest.NewServer(t)
+	p, client := newStreamPublisher(t, s)
+
+	type order struct {
+		ID    int    `resp:"id"`
+		Item  string `resp:"item"`
+		Notes string `resp:"notes,omitempty"`
+	}
+	id, err := p.AddFields(context.Background(), "orders", order{ID: 7, Item: "lamp"})
+	if err != nil {
+		t.Fatalf("AddFields() error = %v", err)
+	}
+
+	reply, err := client.Do(context.Background(), "XRANGE", "orders", "-", "+")
+	if err != nil {
+		t.Fatalf("XRANGE error = %v", err)
+	}
+	entries, _ := reply.AsArray()
+	entry, _ := entries[0].AsArray()
+	fields, _ := entry[1].AsStringSlice()
+	if entry[0].String() != id || len(fields) != 4 || fields[0] != "id" || fields[1] != "7" || fields[2] != "item" || fields[3] != "lamp" {
+		t.Errorf("XRANGE = %v, want entry %s with id 7 and item lamp", reply, id)
+	}
+}
+
+func TestStreamPublisherBatches(t *testing.T) {
+	s := redistest.NewServer(t)
+	p, _ := newStreamPublisher(t, s, publish.WithBatchCount(10), publish.WithLinger(time.Hour), publish.WithTransactions())
+
+	publishN(t, p.Publisher, 25)
+	if !s.WaitForCommand("EXEC", 2, 5*time.Second) {
+		t.Fatalf("full batches were not flushed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := s.StreamLen("events"); got != 20 {
+		t.Errorf("stream holds %d entries before Close, want 20", got)
+	}
+
+	p.Close()
+	if got := s.StreamLen("events"); got != 25 {
+		t.Errorf("stream holds %d entries after Close, want 25", got)
+	}
+}
+
+// nilCodec marshals everything to a nil payload, which can't be an XADD argument
+type nilCodec struct{}
+
+func (nilCodec) Name() string                        { return "nil" }
+func (nilCodec) Marshal(interface{}) ([]byte, error) { return nil, nil }
+func (nilCodec) Unmarshal([]byte, interface{}) error { return nil }
+
+func TestStreamPublisherDropsUnformattableMessages(t *testing.T) {
+	s := redistest.NewServer(t)
+	p, _ := newStreamPublisher(t, s, publish.WithTransactions())
+	p.SetCodec("broken", nilCodec{})
+
+	if err := p.PublishValue("broken", "x"); err != nil {
+		t.Fatalf("PublishValue() error = %v", err)
+	}
+	if err := p.PublishValue("events", "y"); err != nil {
+		t.Fatalf("PublishValue() error = %v", err)
+	}
+	p.Close()
+
+	if got := p.Dropped(); got != 1 {
+		t.Errorf("Dropped() = %d, want 1", got)
+	}
+	if got := s.StreamLen("events"); got != 1 {
+		t.Errorf("stream holds %d entries, want 1", got)
+	}
+	if got := s.CommandCount("MULTI"); got != s.CommandCount("EXEC") {
+		t.Errorf("MULTI sent %d times and EXEC %d times", got, s.CommandCount("EXEC"))
+	}
+}
+
+func TestStreamPublisherToConsumer(t *testing.T) {
+	s := redistest.NewServer(t)
+	received := make(chan int, 50)
+	consumer := connection.NewStreamConsumer(s.Addr(), "billing", "worker-1", connection.WithBlock(50*time.Millisecond), connection.WithGroupStart("0"))
+	defer consumer.Close()
+	consumer.Handle("events", func(msg connection.StreamMessage) error {
+		value, err := connection.Decode[int](msg.BusMessage)
+		if err != nil {
+			return err
+		}
+		received <- value
+		return nil
+	})
+
+	p, _ := newStreamPublisher(t, s, publish.WithBatchCount(7))
+	publishN(t, p.Publisher, 50)
+
+	for want := 0; want < 50; want++ {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("received %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("entry %d was not delivered", want)
+		}
+	}
+}
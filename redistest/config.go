@@ -0,0 +1,72 @@
+package redistest
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Moonlight-Companies/goresp/glob"
+	"github.com/Moonlight-Companies/goresp/resp"
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+// Config returns a parameter set with CONFIG SET, "" when it was never set
+func (s *Server) Config(name string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.config[strings.ToLower(name)]
+}
+
+// handleConfig stores CONFIG SET parameters and returns them with CONFIG GET, nothing else
+// is configurable. Unknown parameters read as ""
+func (s *Server) handleConfig(c *server.Conn, cmd server.Command) {
+	args := argStrings(cmd.Args)
+	switch strings.ToUpper(cmd.Arg(0)) {
+	case "GET":
+		if len(args) < 2 {
+			c.WriteWrongArgs(cmd)
+			return
+		}
+
+		s.mutex.Lock()
+		values := make(map[string]string)
+		for _, pattern := range args[1:] {
+			pattern = strings.ToLower(pattern)
+			if !glob.IsPattern(pattern) {
+				values[pattern] = s.config[pattern]
+				continue
+			}
+			for name, value := range s.config {
+				if glob.Match(pattern, name) {
+					values[name] = value
+				}
+			}
+		}
+		s.mutex.Unlock()
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		items := make([]resp.RESPValue, 0, 2*len(names))
+		for _, name := range names {
+			items = append(items, bulk(name), bulk(values[name]))
+		}
+		c.WriteValue(&resp.RESPArray{Items: items})
+	case "SET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			c.WriteWrongArgs(cmd)
+			return
+		}
+
+		s.mutex.Lock()
+		for i := 1; i < len(args); i += 2 {
+			s.config[strings.ToLower(args[i])] = args[i+1]
+		}
+		s.mutex.Unlock()
+		c.WriteOK()
+	default:
+		c.WriteError("ERR unknown subcommand '" + cmd.Arg(0) + "'. Try CONFIG HELP.")
+	}
+}
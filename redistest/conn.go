@@ -0,0 +1,67 @@
+package redistest
+
+import (
+	"net"
+	"sync"
+)
+
+// faultListener wraps accepted connections so the broker can stall or drop them
+type faultListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &faultConn{Conn: conn, server: l.server}
+	l.server.track(c)
+	return c, nil
+}
+
+// faultConn holds back reads and writes while the broker is stalled, like a SIGSTOP on the
+// process at the other end of the socket. Writes are kept and delivered on Resume
+type faultConn struct {
+	net.Conn
+	server  *Server
+	mutex   sync.Mutex
+	pending []byte
+}
+
+func (c *faultConn) Read(p []byte) (int, error) {
+	c.server.waitResumed()
+	n, err := c.Conn.Read(p)
+	// data that arrived during a stall is only handed over once resumed
+	c.server.waitResumed()
+	return n, err
+}
+
+func (c *faultConn) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.server.isStalled() || len(c.pending) > 0 {
+		c.pending = append(c.pending, p...)
+		return len(p), nil
+	}
+	return c.Conn.Write(p)
+}
+
+// flushPending writes the output held back during a stall
+func (c *faultConn) flushPending() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.pending) > 0 {
+		c.Conn.Write(c.pending)
+		c.pending = nil
+	}
+}
+
+func (c *faultConn) Close() error {
+	c.server.untrack(c)
+	return c.Conn.Close()
+}
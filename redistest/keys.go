@@ -0,0 +1,244 @@
+package redistest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+// invalidateChannel receives the invalidation messages of connections tracking keys with
+// CLIENT TRACKING ON REDIRECT
+const invalidateChannel = "__redis__:invalidate"
+
+// client is the CLIENT state of a connection
+type client struct {
+	id       int64
+	tracking bool
+	redirect int64
+}
+
+// Get returns the value of a string key and whether it exists
+func (s *Server) Get(key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+// Set stores a string key, invalidating it for the connections tracking it and failing the
+// transactions WATCHing it
+func (s *Server) Set(key, value string) {
+	s.mutex.Lock()
+	s.keys[key] = value
+	s.mutex.Unlock()
+
+	s.touch(key)
+}
+
+// Del deletes a key, invalidating it for the connections tracking it and failing the
+// transactions WATCHing it
+func (s *Server) Del(key string) {
+	s.mutex.Lock()
+	delete(s.keys, key)
+	s.mutex.Unlock()
+
+	s.touch(key)
+}
+
+// clientFor returns the CLIENT state of c, assigning an ID on first use. The caller holds s.mutex
+func (s *Server) clientFor(c *server.Conn) *client {
+	if s.clients[c] == nil {
+		s.clientSeq++
+		s.clients[c] = &client{id: s.clientSeq}
+	}
+	return s.clients[c]
+}
+
+// invalidate sends key to the redirect connection of every connection tracking it. As in
+// Redis a key is tracked until its first invalidation
+func (s *Server) invalidate(key string) {
+	var targets []*server.Conn
+
+	s.mutex.Lock()
+	for c := range s.trackers[key] {
+		state := s.clients[c]
+		if state == nil || !state.tracking {
+			continue
+		}
+		for target, targetState := range s.clients {
+			if targetState.id == state.redirect {
+				targets = append(targets, target)
+			}
+		}
+	}
+	delete(s.trackers, key)
+	s.mutex.Unlock()
+
+	message := &resp.RESPArray{Items: []resp.RESPValue{
+		bulk("message"), bulk(invalidateChannel), &resp.RESPArray{Items: []resp.RESPValue{bulk(key)}},
+	}}
+	for _, target := range targets {
+		for _, channel := range target.Channels() {
+			if channel == invalidateChannel {
+				target.Push(message)
+			}
+		}
+	}
+}
+
+func (s *Server) handleClient(c *server.Conn, cmd server.Command) {
+	switch strings.ToUpper(cmd.Arg(0)) {
+	case "ID":
+		s.mutex.Lock()
+		id := s.clientFor(c).id
+		s.mutex.Unlock()
+		c.WriteInteger(id)
+	case "TRACKING":
+		s.handleTracking(c, cmd)
+	case "LIST":
+		s.handleClientList(c, cmd)
+	default:
+		c.WriteError("ERR unknown subcommand '" + cmd.Arg(0) + "'. Try CLIENT HELP.")
+	}
+}
+
+// handleClientList supports CLIENT LIST [ID id ...] with the id, addr, sub and psub fields.
+// Connections are listed once they have a CLIENT ID, the one sending the command included
+func (s *Server) handleClientList(c *server.Conn, cmd server.Command) {
+	args := argStrings(cmd.Args[1:])
+	var ids map[int64]bool
+	if len(args) > 0 {
+		if strings.ToUpper(args[0]) != "ID" || len(args) < 2 {
+			c.WriteError("ERR syntax error")
+			return
+		}
+		ids = make(map[int64]bool, len(args)-1)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				c.WriteError("ERR Invalid client ID")
+				return
+			}
+			ids[id] = true
+		}
+	}
+
+	s.mutex.Lock()
+	s.clientFor(c)
+	type listed struct {
+		id   int64
+		conn *server.Conn
+	}
+	var conns []listed
+	for conn, state := range s.clients {
+		if ids == nil || ids[state.id] {
+			conns = append(conns, listed{state.id, conn})
+		}
+	}
+	s.mutex.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+	var b strings.Builder
+	for _, l := range conns {
+		fmt.Fprintf(&b, "id=%d addr=%s sub=%d psub=%d\n",
+			l.id, l.conn.RemoteAddr(), len(l.conn.Channels()), len(l.conn.Patterns()))
+	}
+	c.WriteBulkString(b.String())
+}
+
+// handleTracking supports CLIENT TRACKING ON|OFF [REDIRECT id], other options are ignored
+func (s *Server) handleTracking(c *server.Conn, cmd server.Command) {
+	args := argStrings(cmd.Args[1:])
+	if len(args) == 0 {
+		c.WriteWrongArgs(cmd)
+		return
+	}
+
+	var redirect int64
+	for i := 1; i < len(args); i++ {
+		if strings.ToUpper(args[i]) == "REDIRECT" && i+1 < len(args) {
+			id, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				c.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			redirect = id
+			i++
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.clientFor(c)
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		state.tracking, state.redirect = true, redirect
+	case "OFF":
+		state.tracking, state.redirect = false, 0
+	default:
+		c.WriteError("ERR syntax error")
+		return
+	}
+	c.WriteOK()
+}
+
+func (s *Server) handleGet(c *server.Conn, cmd server.Command) {
+	key := cmd.Arg(0)
+
+	s.mutex.Lock()
+	value, ok := s.keys[key]
+	if state := s.clients[c]; state != nil && state.tracking {
+		addSubscriber(s.trackers, key, c)
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		c.WriteNull()
+		return
+	}
+	c.WriteBulkString(value)
+}
+
+func (s *Server) handleSet(c *server.Conn, cmd server.Command) {
+	s.Set(cmd.Arg(0), cmd.Arg(1))
+	c.WriteOK()
+}
+
+func (s *Server) handleDel(c *server.Conn, cmd server.Command) {
+	deleted := 0
+	for _, key := range argStrings(cmd.Args) {
+		if _, ok := s.Get(key); ok {
+			deleted++
+		}
+		s.Del(key)
+	}
+	c.WriteInteger(int64(deleted))
+}
+
+func (s *Server) handleIncr(c *server.Conn, cmd server.Command) {
+	key := cmd.Arg(0)
+
+	s.mutex.Lock()
+	n, err := strconv.ParseInt(s.keys[key], 10, 64)
+	if _, ok := s.keys[key]; !ok {
+		n, err = 0, nil
+	}
+	if err == nil {
+		n++
+		s.keys[key] = strconv.FormatInt(n, 10)
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		c.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+	s.touch(key)
+	c.WriteInteger(n)
+}
@@ -0,0 +1,311 @@
+package redistest
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Proxy forwards TCP connections to a target address and injects network faults into the
+// live connections on demand: pauses, throttling, fragmented writes, corrupted bytes,
+// half closes and resets
+type Proxy struct {
+	listener  net.Listener
+	target    string
+	mutex     sync.Mutex
+	links     map[*link]struct{}
+	fragment  int
+	throttle  int
+	corrupt   int
+	closed    bool
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// link is one proxied connection
+type link struct {
+	client   net.Conn
+	upstream net.Conn
+	paused   bool
+	resumed  chan struct{}
+	halfOpen bool
+}
+
+// StartProxy listens on 127.0.0.1 with a random port and forwards to target
+func StartProxy(target string) (*Proxy, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		listener: l,
+		target:   target,
+		links:    make(map[*link]struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.accept()
+
+	return p, nil
+}
+
+// NewProxy starts a proxy to target that is closed when the test ends
+func NewProxy(tb testing.TB, target string) *Proxy {
+	tb.Helper()
+
+	p, err := StartProxy(target)
+	if err != nil {
+		tb.Fatalf("redistest: %v", err)
+	}
+	tb.Cleanup(p.Close)
+	return p
+}
+
+// Addr returns the host:port clients should dial
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *Proxy) Close() {
+	p.closeOnce.Do(func() {
+		p.mutex.Lock()
+		p.closed = true
+		p.mutex.Unlock()
+
+		p.listener.Close()
+		for _, l := range p.liveLinks() {
+			p.closeLink(l)
+		}
+		p.wg.Wait()
+	})
+}
+
+// LinkCount returns the number of proxied connections currently open
+func (p *Proxy) LinkCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.links)
+}
+
+// Pause stops forwarding in both directions on the open connections without closing them,
+// the SIGSTOP scenario. Connections made afterwards are not paused
+func (p *Proxy) Pause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for l := range p.links {
+		if !l.paused {
+			l.paused = true
+			l.resumed = make(chan struct{})
+		}
+	}
+}
+
+// Resume undoes Pause
+func (p *Proxy) Resume() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for l := range p.links {
+		p.resumeLocked(l)
+	}
+}
+
+// Throttle limits every direction of every connection to bytesPerSecond, 0 removes the limit
+func (p *Proxy) Throttle(bytesPerSecond int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.throttle = bytesPerSecond
+}
+
+// Fragment splits forwarded data into writes of at most n bytes, 0 forwards reads as is
+func (p *Proxy) Fragment(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.fragment = n
+}
+
+// CorruptNext inverts the next n bytes sent from the target to the client
+func (p *Proxy) CorruptNext(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.corrupt += n
+}
+
+// HalfClose closes the direction towards the client on every open connection, the client
+// reads EOF while its writes are still forwarded
+func (p *Proxy) HalfClose() {
+	for _, l := range p.liveLinks() {
+		p.mutex.Lock()
+		l.halfOpen = true
+		p.mutex.Unlock()
+
+		if tcp, ok := l.client.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}
+}
+
+// Reset aborts every open connection with a TCP RST instead of an orderly close
+func (p *Proxy) Reset() {
+	for _, l := range p.liveLinks() {
+		if tcp, ok := l.client.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		p.closeLink(l)
+	}
+}
+
+func (p *Proxy) accept() {
+	defer p.wg.Done()
+
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		upstream, err := net.DialTimeout("tcp", p.target, 5*time.Second)
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		l := &link{client: client, upstream: upstream}
+
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			client.Close()
+			upstream.Close()
+			return
+		}
+		p.links[l] = struct{}{}
+		p.wg.Add(2)
+		p.mutex.Unlock()
+
+		go p.forward(l, l.upstream, l.client, false)
+		go p.forward(l, l.client, l.upstream, true)
+	}
+}
+
+// forward copies src to dst until either side fails, then tears the link down
+func (p *Proxy) forward(l *link, dst, src net.Conn, toClient bool) {
+	defer p.wg.Done()
+	defer p.closeLink(l)
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buffer)
+		if n > 0 {
+			if !p.waitResumed(l) {
+				return
+			}
+			if toClient && p.isHalfOpen(l) {
+				continue
+			}
+			if werr := p.write(dst, buffer[:n], toClient); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) write(dst net.Conn, data []byte, toClient bool) error {
+	p.mutex.Lock()
+	fragment, throttle := p.fragment, p.throttle
+	if toClient && p.corrupt > 0 {
+		data = append([]byte(nil), data...)
+		for i := 0; i < len(data) && p.corrupt > 0; i++ {
+			data[i] ^= 0xff
+			p.corrupt--
+		}
+	}
+	p.mutex.Unlock()
+
+	chunk := len(data)
+	if fragment > 0 && fragment < chunk {
+		chunk = fragment
+	}
+
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if throttle > 0 {
+			time.Sleep(time.Duration(n) * time.Second / time.Duration(throttle))
+		}
+		if _, err := dst.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+
+		if throttle == 0 && fragment > 0 && len(data) > 0 {
+			// give each fragment a chance to arrive as its own read
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// waitResumed blocks while the link is paused, false once it has been closed
+func (p *Proxy) waitResumed(l *link) bool {
+	p.mutex.Lock()
+	resumed, paused := l.resumed, l.paused
+	p.mutex.Unlock()
+
+	if paused {
+		<-resumed
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	_, open := p.links[l]
+	return open
+}
+
+func (p *Proxy) isHalfOpen(l *link) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return l.halfOpen
+}
+
+func (p *Proxy) resumeLocked(l *link) {
+	if l.paused {
+		l.paused = false
+		close(l.resumed)
+	}
+}
+
+func (p *Proxy) closeLink(l *link) {
+	p.mutex.Lock()
+	delete(p.links, l)
+	p.resumeLocked(l)
+	p.mutex.Unlock()
+
+	l.client.Close()
+	l.upstream.Close()
+}
+
+func (p *Proxy) liveLinks() []*link {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	links := make([]*link, 0, len(p.links))
+	for l := range p.links {
+		links = append(links, l)
+	}
+	return links
+}
@@ -0,0 +1,238 @@
+package redistest
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Moonlight-Companies/goresp/glob"
+	"github.com/Moonlight-Companies/goresp/resp"
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+func bulk(s string) *resp.RESPBulkString {
+	return &resp.RESPBulkString{Value: []byte(s)}
+}
+
+func ack(kind string, name *resp.RESPBulkString, count int) resp.RESPValue {
+	return &resp.RESPArray{Items: []resp.RESPValue{bulk(kind), name, &resp.RESPInteger{Value: int64(count)}}}
+}
+
+func (s *Server) handleSubscribe(c *server.Conn, cmd server.Command) {
+	for _, arg := range cmd.Args {
+		channel := string(arg)
+		s.mutex.Lock()
+		addSubscriber(s.channels, channel, c)
+		s.mutex.Unlock()
+		c.WriteValue(ack("subscribe", bulk(channel), c.Subscribe(channel)))
+	}
+}
+
+func (s *Server) handlePSubscribe(c *server.Conn, cmd server.Command) {
+	for _, arg := range cmd.Args {
+		pattern := string(arg)
+		s.mutex.Lock()
+		addSubscriber(s.patterns, pattern, c)
+		s.mutex.Unlock()
+		c.WriteValue(ack("psubscribe", bulk(pattern), c.PSubscribe(pattern)))
+	}
+}
+
+func (s *Server) handleUnsubscribe(c *server.Conn, cmd server.Command) {
+	channels := argStrings(cmd.Args)
+	if len(channels) == 0 {
+		channels = c.Channels()
+	}
+
+	if len(channels) == 0 {
+		c.WriteValue(ack("unsubscribe", &resp.RESPBulkString{}, c.SubscriptionCount()))
+		return
+	}
+
+	for _, channel := range channels {
+		s.mutex.Lock()
+		removeSubscriber(s.channels, channel, c)
+		s.mutex.Unlock()
+		c.WriteValue(ack("unsubscribe", bulk(channel), c.Unsubscribe(channel)))
+	}
+}
+
+func (s *Server) handlePUnsubscribe(c *server.Conn, cmd server.Command) {
+	patterns := argStrings(cmd.Args)
+	if len(patterns) == 0 {
+		patterns = c.Patterns()
+	}
+
+	if len(patterns) == 0 {
+		c.WriteValue(ack("punsubscribe", &resp.RESPBulkString{}, c.SubscriptionCount()))
+		return
+	}
+
+	for _, pattern := range patterns {
+		s.mutex.Lock()
+		removeSubscriber(s.patterns, pattern, c)
+		s.mutex.Unlock()
+		c.WriteValue(ack("punsubscribe", bulk(pattern), c.PUnsubscribe(pattern)))
+	}
+}
+
+func (s *Server) handlePublish(c *server.Conn, cmd server.Command) {
+	c.WriteInteger(int64(s.Publish(cmd.Arg(0), cmd.Arg(1))))
+}
+
+func (s *Server) handlePubsub(c *server.Conn, cmd server.Command) {
+	switch strings.ToUpper(cmd.Arg(0)) {
+	case "CHANNELS":
+		channels := s.activeChannels()
+		items := []resp.RESPValue{}
+		for _, channel := range channels {
+			if len(cmd.Args) < 2 || glob.Match(cmd.Arg(1), channel) {
+				items = append(items, bulk(channel))
+			}
+		}
+		c.WriteValue(&resp.RESPArray{Items: items})
+	case "NUMSUB":
+		items := []resp.RESPValue{}
+		for _, channel := range argStrings(cmd.Args[1:]) {
+			items = append(items, bulk(channel), &resp.RESPInteger{Value: int64(s.NumSub(channel))})
+		}
+		c.WriteValue(&resp.RESPArray{Items: items})
+	case "NUMPAT":
+		c.WriteInteger(int64(s.NumPat()))
+	default:
+		c.WriteError("ERR unknown subcommand '" + cmd.Arg(0) + "'. Try PUBSUB HELP.")
+	}
+}
+
+// Publish delivers message to every subscriber of channel and every matching pattern,
+// returning the number of deliveries like the PUBLISH reply
+func (s *Server) Publish(channel, message string) int {
+	type delivery struct {
+		conn  *server.Conn
+		value resp.RESPValue
+	}
+
+	var deliveries []delivery
+
+	s.mutex.Lock()
+	for c := range s.channels[channel] {
+		deliveries = append(deliveries, delivery{c, &resp.RESPArray{Items: []resp.RESPValue{
+			bulk("message"), bulk(channel), bulk(message),
+		}}})
+	}
+	for pattern, conns := range s.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for c := range conns {
+			deliveries = append(deliveries, delivery{c, &resp.RESPArray{Items: []resp.RESPValue{
+				bulk("pmessage"), bulk(pattern), bulk(channel), bulk(message),
+			}}})
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, d := range deliveries {
+		d.conn.Push(d.value)
+	}
+	return len(deliveries)
+}
+
+// DropSubscribers unsubscribes every connection from channel without acknowledging it, like a
+// subscription the server lost
+func (s *Server) DropSubscribers(channel string) {
+	s.mutex.Lock()
+	conns := s.channels[channel]
+	delete(s.channels, channel)
+	s.mutex.Unlock()
+
+	for c := range conns {
+		c.Unsubscribe(channel)
+	}
+}
+
+// CopySubscribers subscribes every connection subscribed to from to channel too without
+// acknowledging it, like a subscription whose ack the connection missed
+func (s *Server) CopySubscribers(from, channel string) {
+	var conns []*server.Conn
+
+	s.mutex.Lock()
+	for c := range s.channels[from] {
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		addSubscriber(s.channels, channel, c)
+	}
+	s.mutex.Unlock()
+
+	for _, c := range conns {
+		c.Subscribe(channel)
+	}
+}
+
+// NumSub returns the number of connections subscribed to channel
+func (s *Server) NumSub(channel string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.channels[channel])
+}
+
+// NumPat returns the number of distinct subscribed patterns
+func (s *Server) NumPat() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.patterns)
+}
+
+func (s *Server) activeChannels() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// release drops the subscriptions and the CLIENT state of a closed connection
+func (s *Server) release(c *server.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.clients, c)
+	for key := range s.trackers {
+		removeSubscriber(s.trackers, key, c)
+	}
+	s.unwatch(c)
+	for _, channel := range c.Channels() {
+		removeSubscriber(s.channels, channel, c)
+	}
+	for _, pattern := range c.Patterns() {
+		removeSubscriber(s.patterns, pattern, c)
+	}
+}
+
+func addSubscriber(registry map[string]map[*server.Conn]struct{}, name string, c *server.Conn) {
+	if registry[name] == nil {
+		registry[name] = make(map[*server.Conn]struct{})
+	}
+	registry[name][c] = struct{}{}
+}
+
+func removeSubscriber(registry map[string]map[*server.Conn]struct{}, name string, c *server.Conn) {
+	delete(registry[name], c)
+	if len(registry[name]) == 0 {
+		delete(registry, name)
+	}
+}
+
+func argStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
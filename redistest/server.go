@@ -0,0 +1,274 @@
+// Package redistest provides an in-memory Redis for tests: pub/sub, streams and string keys
+// with client tracking and WATCH. It speaks RESP on a random local port and can drop, stall
+// or corrupt its connections on demand
+package redistest
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+type Server struct {
+	server    *server.Server
+	listener  net.Listener
+	mutex     sync.Mutex
+	conns     map[*faultConn]struct{}
+	channels  map[string]map[*server.Conn]struct{}
+	patterns  map[string]map[*server.Conn]struct{}
+	commands  []server.Command
+	streams   map[string]*stream
+	config    map[string]string
+	keys      map[string]string
+	clients   map[*server.Conn]*client
+	clientSeq int64
+	trackers  map[string]map[*server.Conn]struct{}
+	watchers  map[string]map[*server.Conn]struct{}
+	appended  chan struct{}
+	stalled   bool
+	resumed   chan struct{}
+	closed    bool
+	closeOnce sync.Once
+}
+
+// Start runs a broker on 127.0.0.1 with a random port
+func Start() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		server:   server.NewServer(),
+		conns:    make(map[*faultConn]struct{}),
+		channels: make(map[string]map[*server.Conn]struct{}),
+		patterns: make(map[string]map[*server.Conn]struct{}),
+		streams:  make(map[string]*stream),
+		config:   make(map[string]string),
+		keys:     make(map[string]string),
+		clients:  make(map[*server.Conn]*client),
+		trackers: make(map[string]map[*server.Conn]struct{}),
+		watchers: make(map[string]map[*server.Conn]struct{}),
+		appended: make(chan struct{}),
+		resumed:  make(chan struct{}),
+	}
+	close(s.resumed)
+	s.listener = &faultListener{Listener: l, server: s}
+
+	s.server.OnCommand(s.record)
+	s.server.OnCommand(s.endWatch)
+	s.server.OnClose(s.release)
+	s.server.HandleArity("SUBSCRIBE", -2, s.handleSubscribe)
+	s.server.HandleArity("PSUBSCRIBE", -2, s.handlePSubscribe)
+	s.server.Handle("UNSUBSCRIBE", s.handleUnsubscribe)
+	s.server.Handle("PUNSUBSCRIBE", s.handlePUnsubscribe)
+	s.server.HandleArity("PUBLISH", 3, s.handlePublish)
+	s.server.Handle("PUBSUB", s.handlePubsub)
+	s.server.Handle("CONFIG", s.handleConfig)
+	s.server.Handle("CLIENT", s.handleClient)
+	s.server.HandleArity("GET", 2, s.handleGet)
+	s.server.HandleArity("SET", 3, s.handleSet)
+	s.server.HandleArity("DEL", -2, s.handleDel)
+	s.server.HandleArity("INCR", 2, s.handleIncr)
+	s.server.HandleArity("WATCH", -2, s.handleWatch)
+	s.server.HandleArity("XADD", -5, s.handleXAdd)
+	s.server.HandleArity("XLEN", 2, s.handleXLen)
+	s.server.Handle("XRANGE", s.handleXRange)
+	s.server.Handle("XGROUP", s.handleXGroup)
+	s.server.Handle("XREADGROUP", s.handleXReadGroup)
+	s.server.HandleArity("XACK", -4, s.handleXAck)
+	s.server.HandleArity("XAUTOCLAIM", -6, s.handleXAutoClaim)
+
+	go s.server.Serve(s.listener)
+
+	return s, nil
+}
+
+// NewServer starts a broker that is closed when the test ends
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+
+	s, err := Start()
+	if err != nil {
+		tb.Fatalf("redistest: %v", err)
+	}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the host:port the broker listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Handle adds or replaces a command handler on the underlying server
+func (s *Server) Handle(name string, fn server.HandlerFunc) {
+	s.server.Handle(name, fn)
+}
+
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		s.mutex.Lock()
+		s.closed = true
+		s.mutex.Unlock()
+		s.notifyStreams()
+		s.Resume()
+		s.server.Close()
+	})
+}
+
+// DropConnections closes every client connection, as if the server restarted
+func (s *Server) DropConnections() {
+	for _, c := range s.faultConns() {
+		c.Close()
+	}
+}
+
+// Stall stops the broker from reading requests or sending replies on its connections without
+// closing them, the SIGSTOP scenario. Output produced meanwhile is delivered by Resume
+func (s *Server) Stall() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.stalled {
+		s.stalled = true
+		s.resumed = make(chan struct{})
+	}
+}
+
+// Resume undoes Stall
+func (s *Server) Resume() {
+	s.mutex.Lock()
+	if s.stalled {
+		s.stalled = false
+		close(s.resumed)
+	}
+	s.mutex.Unlock()
+
+	for _, c := range s.faultConns() {
+		c.flushPending()
+	}
+}
+
+// InjectGarbage writes raw bytes to every client connection
+func (s *Server) InjectGarbage(b []byte) {
+	for _, c := range s.faultConns() {
+		c.Write(b)
+	}
+}
+
+// ConnCount returns the number of open client connections
+func (s *Server) ConnCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.conns)
+}
+
+// Commands returns every command received so far, in order
+func (s *Server) Commands() []server.Command {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]server.Command(nil), s.commands...)
+}
+
+// CommandCount returns how many commands named name have been received
+func (s *Server) CommandCount(name string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, cmd := range s.commands {
+		if cmd.Name == name {
+			count++
+		}
+	}
+	return count
+}
+
+// ClearCommands forgets the recorded commands
+func (s *Server) ClearCommands() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.commands = nil
+}
+
+// WaitFor polls cond until it returns true or timeout passes, reporting the last result
+func (s *Server) WaitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if cond() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitForCommand waits until at least n commands named name have been received
+func (s *Server) WaitForCommand(name string, n int, timeout time.Duration) bool {
+	return s.WaitFor(timeout, func() bool {
+		return s.CommandCount(name) >= n
+	})
+}
+
+// WaitForSubscribers waits until channel has at least n subscribed connections
+func (s *Server) WaitForSubscribers(channel string, n int, timeout time.Duration) bool {
+	return s.WaitFor(timeout, func() bool {
+		return s.NumSub(channel) >= n
+	})
+}
+
+func (s *Server) record(c *server.Conn, cmd server.Command) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.commands = append(s.commands, cmd)
+}
+
+func (s *Server) track(c *faultConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conns[c] = struct{}{}
+}
+
+func (s *Server) untrack(c *faultConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.conns, c)
+}
+
+func (s *Server) faultConns() []*faultConn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conns := make([]*faultConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *Server) isStalled() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stalled
+}
+
+func (s *Server) waitResumed() {
+	s.mutex.Lock()
+	resumed := s.resumed
+	s.mutex.Unlock()
+
+	<-resumed
+}
@@ -0,0 +1,531 @@
+package redistest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+// streamID is an entry ID, milliseconds and a sequence number
+type streamID struct {
+	ms  uint64
+	seq uint64
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// parseStreamID parses "ms-seq" or "ms", a missing sequence is seq
+func parseStreamID(s string, seq uint64) (streamID, error) {
+	msText, seqText, found := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msText, 10, 64)
+	if err != nil {
+		return streamID{}, fmt.Errorf("ERR Invalid stream ID specified as stream command argument")
+	}
+	if found {
+		if seq, err = strconv.ParseUint(seqText, 10, 64); err != nil {
+			return streamID{}, fmt.Errorf("ERR Invalid stream ID specified as stream command argument")
+		}
+	}
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+// pendingEntry is an entry delivered to a consumer of a group and not acknowledged yet
+type pendingEntry struct {
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int
+}
+
+type streamGroup struct {
+	lastDelivered streamID
+	pending       map[streamID]*pendingEntry
+}
+
+type stream struct {
+	entries []streamEntry
+	lastID  streamID
+	groups  map[string]*streamGroup
+}
+
+func (st *stream) find(id streamID) (streamEntry, bool) {
+	i := sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].id.less(id) })
+	if i < len(st.entries) && st.entries[i].id == id {
+		return st.entries[i], true
+	}
+	return streamEntry{}, false
+}
+
+// after returns up to count entries with an ID above id, count < 1 means all of them
+func (st *stream) after(id streamID, count int) []streamEntry {
+	i := sort.Search(len(st.entries), func(i int) bool { return id.less(st.entries[i].id) })
+	entries := st.entries[i:]
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return entries
+}
+
+// pendingIDs returns the pending IDs of a group in order, only those of consumer unless it is empty
+func (g *streamGroup) pendingIDs(consumer string) []streamID {
+	ids := make([]streamID, 0, len(g.pending))
+	for id, p := range g.pending {
+		if consumer == "" || p.consumer == consumer {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+func entryValue(id streamID, fields []string) resp.RESPValue {
+	if fields == nil {
+		// an entry trimmed while pending
+		return &resp.RESPArray{Items: []resp.RESPValue{bulk(id.String()), &resp.RESPArray{}}}
+	}
+	items := make([]resp.RESPValue, len(fields))
+	for i, field := range fields {
+		items[i] = bulk(field)
+	}
+	return &resp.RESPArray{Items: []resp.RESPValue{bulk(id.String()), &resp.RESPArray{Items: items}}}
+}
+
+// XAdd appends an entry to a stream, creating it if needed, and returns the entry ID
+func (s *Server) XAdd(name string, fields ...string) string {
+	s.mutex.Lock()
+	id := s.addEntry(name, streamID{}, true, fields)
+	s.mutex.Unlock()
+
+	s.notifyStreams()
+	return id.String()
+}
+
+// StreamLen returns the number of entries in a stream
+func (s *Server) StreamLen(name string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if st := s.streams[name]; st != nil {
+		return len(st.entries)
+	}
+	return 0
+}
+
+// Pending returns the number of entries delivered to a consumer group and not acknowledged
+func (s *Server) Pending(name, group string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if st := s.streams[name]; st != nil && st.groups[group] != nil {
+		return len(st.groups[group].pending)
+	}
+	return 0
+}
+
+// addEntry appends an entry, generating its ID when auto is set. The caller holds s.mutex
+func (s *Server) addEntry(name string, id streamID, auto bool, fields []string) streamID {
+	st := s.streams[name]
+	if st == nil {
+		st = &stream{groups: make(map[string]*streamGroup)}
+		s.streams[name] = st
+	}
+
+	if auto {
+		id = streamID{ms: uint64(time.Now().UnixMilli())}
+		if !st.lastID.less(id) {
+			id = streamID{ms: st.lastID.ms, seq: st.lastID.seq + 1}
+		}
+	}
+	st.entries = append(st.entries, streamEntry{id: id, fields: append([]string(nil), fields...)})
+	st.lastID = id
+	return id
+}
+
+// notifyStreams wakes the blocked XREADGROUP commands, s.appended is closed and replaced
+func (s *Server) notifyStreams() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	close(s.appended)
+	s.appended = make(chan struct{})
+}
+
+func (s *Server) handleXAdd(c *server.Conn, cmd server.Command) {
+	args := argStrings(cmd.Args)
+	if len(args) < 4 {
+		c.WriteWrongArgs(cmd)
+		return
+	}
+	name, args := args[0], args[1:]
+
+	maxLen := -1
+options:
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "NOMKSTREAM":
+			args = args[1:]
+			s.mutex.Lock()
+			missing := s.streams[name] == nil
+			s.mutex.Unlock()
+			if missing {
+				c.WriteNull()
+				return
+			}
+		case "MAXLEN":
+			args = args[1:]
+			if len(args) > 0 && (args[0] == "~" || args[0] == "=") {
+				args = args[1:]
+			}
+			n, err := strconv.Atoi(firstArg(args))
+			if err != nil || n < 0 {
+				c.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			maxLen, args = n, args[1:]
+		default:
+			break options
+		}
+	}
+
+	if len(args) < 3 || len(args)%2 != 1 {
+		c.WriteWrongArgs(cmd)
+		return
+	}
+
+	s.mutex.Lock()
+	auto := args[0] == "*"
+	var id streamID
+	if !auto {
+		var err error
+		if id, err = parseStreamID(args[0], 0); err != nil {
+			s.mutex.Unlock()
+			c.WriteError(err.Error())
+			return
+		}
+		if st := s.streams[name]; (st != nil && !st.lastID.less(id)) || id == (streamID{}) {
+			s.mutex.Unlock()
+			c.WriteError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+			return
+		}
+	}
+	id = s.addEntry(name, id, auto, args[1:])
+	if st := s.streams[name]; maxLen >= 0 && len(st.entries) > maxLen {
+		st.entries = append([]streamEntry(nil), st.entries[len(st.entries)-maxLen:]...)
+	}
+	s.mutex.Unlock()
+
+	s.notifyStreams()
+	c.WriteBulkString(id.String())
+}
+
+func (s *Server) handleXLen(c *server.Conn, cmd server.Command) {
+	c.WriteInteger(int64(s.StreamLen(cmd.Arg(0))))
+}
+
+func (s *Server) handleXRange(c *server.Conn, cmd server.Command) {
+	if len(cmd.Args) != 3 && len(cmd.Args) != 5 {
+		c.WriteWrongArgs(cmd)
+		return
+	}
+
+	start, end := streamID{}, streamID{ms: ^uint64(0), seq: ^uint64(0)}
+	var err error
+	if cmd.Arg(1) != "-" {
+		if start, err = parseStreamID(cmd.Arg(1), 0); err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+	}
+	if cmd.Arg(2) != "+" {
+		if end, err = parseStreamID(cmd.Arg(2), ^uint64(0)); err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+	}
+	count := -1
+	if len(cmd.Args) == 5 {
+		if count, err = strconv.Atoi(cmd.Arg(4)); err != nil || strings.ToUpper(cmd.Arg(3)) != "COUNT" {
+			c.WriteError("ERR syntax error")
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	items := []resp.RESPValue{}
+	if st := s.streams[cmd.Arg(0)]; st != nil {
+		for _, entry := range st.entries {
+			if entry.id.less(start) || end.less(entry.id) || (count >= 0 && len(items) >= count) {
+				continue
+			}
+			items = append(items, entryValue(entry.id, entry.fields))
+		}
+	}
+	s.mutex.Unlock()
+
+	c.WriteValue(&resp.RESPArray{Items: items})
+}
+
+func (s *Server) handleXGroup(c *server.Conn, cmd server.Command) {
+	if strings.ToUpper(cmd.Arg(0)) != "CREATE" {
+		c.WriteError("ERR unknown subcommand '" + cmd.Arg(0) + "'. Try XGROUP HELP.")
+		return
+	}
+	if len(cmd.Args) != 4 && len(cmd.Args) != 5 {
+		c.WriteWrongArgs(cmd)
+		return
+	}
+	name, group, start := cmd.Arg(1), cmd.Arg(2), cmd.Arg(3)
+	mkstream := strings.ToUpper(cmd.Arg(4)) == "MKSTREAM"
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	st := s.streams[name]
+	if st == nil {
+		if !mkstream {
+			c.WriteError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			return
+		}
+		st = &stream{groups: make(map[string]*streamGroup)}
+		s.streams[name] = st
+	}
+	if st.groups[group] != nil {
+		c.WriteError("BUSYGROUP Consumer Group name already exists")
+		return
+	}
+
+	lastDelivered := st.lastID
+	if start != "$" {
+		var err error
+		if lastDelivered, err = parseStreamID(start, 0); err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+	}
+	st.groups[group] = &streamGroup{lastDelivered: lastDelivered, pending: make(map[streamID]*pendingEntry)}
+	c.WriteOK()
+}
+
+func (s *Server) handleXReadGroup(c *server.Conn, cmd server.Command) {
+	args := argStrings(cmd.Args)
+	if len(args) < 6 || strings.ToUpper(args[0]) != "GROUP" {
+		c.WriteError("ERR syntax error")
+		return
+	}
+	group, consumer, args := args[1], args[2], args[3:]
+
+	count, block := 0, time.Duration(-1)
+	noAck := false
+	for len(args) > 0 && strings.ToUpper(args[0]) != "STREAMS" {
+		switch strings.ToUpper(args[0]) {
+		case "COUNT", "BLOCK":
+			n, err := strconv.Atoi(firstArg(args[1:]))
+			if err != nil || n < 0 {
+				c.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			if strings.ToUpper(args[0]) == "COUNT" {
+				count = n
+			} else {
+				block = time.Duration(n) * time.Millisecond
+			}
+			args = args[2:]
+		case "NOACK":
+			noAck = true
+			args = args[1:]
+		default:
+			c.WriteError("ERR syntax error")
+			return
+		}
+	}
+	if len(args) < 3 || len(args)%2 != 1 {
+		c.WriteError("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+		return
+	}
+	names, ids := args[1:len(args)/2+1], args[len(args)/2+1:]
+
+	var deadline <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		s.mutex.Lock()
+		reply, err := s.readGroup(group, consumer, names, ids, count, noAck)
+		appended, closed := s.appended, s.closed
+		s.mutex.Unlock()
+
+		switch {
+		case err != nil:
+			c.WriteError(err.Error())
+			return
+		case reply != nil:
+			c.WriteValue(reply)
+			return
+		case block < 0 || closed:
+			c.WriteValue(&resp.RESPArray{})
+			return
+		}
+
+		select {
+		case <-appended:
+		case <-deadline:
+			c.WriteValue(&resp.RESPArray{})
+			return
+		}
+	}
+}
+
+// readGroup runs XREADGROUP once, a nil reply means no new entries. The caller holds s.mutex
+func (s *Server) readGroup(group, consumer string, names, ids []string, count int, noAck bool) (resp.RESPValue, error) {
+	items := []resp.RESPValue{}
+	for i, name := range names {
+		st := s.streams[name]
+		if st == nil || st.groups[group] == nil {
+			return nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", name, group)
+		}
+		g := st.groups[group]
+
+		entries := []resp.RESPValue{}
+		if ids[i] == ">" {
+			for _, entry := range st.after(g.lastDelivered, count) {
+				g.lastDelivered = entry.id
+				if !noAck {
+					g.pending[entry.id] = &pendingEntry{consumer: consumer, deliveredAt: time.Now(), deliveries: 1}
+				}
+				entries = append(entries, entryValue(entry.id, entry.fields))
+			}
+			if len(entries) == 0 {
+				continue
+			}
+		} else {
+			// history: the consumer's own pending entries after the ID
+			after, err := parseStreamID(ids[i], 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range g.pendingIDs(consumer) {
+				if !after.less(id) || (count > 0 && len(entries) >= count) {
+					continue
+				}
+				entry, _ := st.find(id)
+				entries = append(entries, entryValue(id, entry.fields))
+			}
+		}
+		items = append(items, &resp.RESPArray{Items: []resp.RESPValue{bulk(name), &resp.RESPArray{Items: entries}}})
+	}
+
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return &resp.RESPArray{Items: items}, nil
+}
+
+func (s *Server) handleXAck(c *server.Conn, cmd server.Command) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	acked := 0
+	st := s.streams[cmd.Arg(0)]
+	if st == nil || st.groups[cmd.Arg(1)] == nil {
+		c.WriteInteger(0)
+		return
+	}
+	g := st.groups[cmd.Arg(1)]
+	for _, arg := range argStrings(cmd.Args[2:]) {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		if g.pending[id] != nil {
+			delete(g.pending, id)
+			acked++
+		}
+	}
+	c.WriteInteger(int64(acked))
+}
+
+func (s *Server) handleXAutoClaim(c *server.Conn, cmd server.Command) {
+	name, group, consumer := cmd.Arg(0), cmd.Arg(1), cmd.Arg(2)
+
+	minIdle, err := strconv.Atoi(cmd.Arg(3))
+	if err != nil {
+		c.WriteError("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+		return
+	}
+	start, err := parseStreamID(cmd.Arg(4), 0)
+	if err != nil {
+		c.WriteError(err.Error())
+		return
+	}
+	count := 100
+	if len(cmd.Args) >= 7 && strings.ToUpper(cmd.Arg(5)) == "COUNT" {
+		if count, err = strconv.Atoi(cmd.Arg(6)); err != nil || count < 1 {
+			c.WriteError("ERR COUNT must be > 0")
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	st := s.streams[name]
+	if st == nil || st.groups[group] == nil {
+		c.WriteError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", name, group))
+		return
+	}
+	g := st.groups[group]
+
+	claimed, deleted := []resp.RESPValue{}, []resp.RESPValue{}
+	next := streamID{}
+	for _, id := range g.pendingIDs("") {
+		if id.less(start) {
+			continue
+		}
+		if len(claimed)+len(deleted) >= count {
+			next = id
+			break
+		}
+
+		p := g.pending[id]
+		if time.Since(p.deliveredAt) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+		entry, ok := st.find(id)
+		if !ok {
+			delete(g.pending, id)
+			deleted = append(deleted, bulk(id.String()))
+			continue
+		}
+		p.consumer, p.deliveredAt = consumer, time.Now()
+		p.deliveries++
+		claimed = append(claimed, entryValue(id, entry.fields))
+	}
+
+	c.WriteArray(bulk(next.String()), &resp.RESPArray{Items: claimed}, &resp.RESPArray{Items: deleted})
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,151 @@
+package redistest_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+func dialProxy(t *testing.T, p *redistest.Proxy) *client {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", p.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, reader: resp.NewReader(conn)}
+}
+
+func TestProxyFragmentAndThrottle(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := redistest.NewProxy(t, s.Addr())
+	p.Fragment(1)
+
+	c := dialProxy(t, p)
+	c.send("SUBSCRIBE", "news")
+	c.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+
+	p.Fragment(0)
+	p.Throttle(1000)
+	start := time.Now()
+	s.Publish("news", "0123456789012345678901234567890123456789")
+	c.expect("*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$40\r\n0123456789012345678901234567890123456789\r\n")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("throttled message arrived after %v, want at least 50ms", elapsed)
+	}
+}
+
+func TestProxyCorrupt(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := redistest.NewProxy(t, s.Addr())
+	c := dialProxy(t, p)
+
+	p.CorruptNext(1)
+	c.send("PING")
+	if _, err := c.read(5 * time.Second); err == nil {
+		t.Errorf("ReadValue() of corrupted reply error = nil, want protocol error")
+	}
+}
+
+func TestProxyPause(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := redistest.NewProxy(t, s.Addr())
+	c := dialProxy(t, p)
+	c.send("PING")
+	c.expect("+PONG\r\n")
+
+	p.Pause()
+	c.send("PING")
+	if _, err := c.read(200 * time.Millisecond); err == nil {
+		t.Fatalf("ReadValue() while paused returned data")
+	}
+
+	c.reader = resp.NewReader(c.conn)
+	p.Resume()
+	c.expect("+PONG\r\n")
+}
+
+func TestProxyHalfCloseAndReset(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := redistest.NewProxy(t, s.Addr())
+
+	half := dialProxy(t, p)
+	half.send("PING")
+	half.expect("+PONG\r\n")
+	p.HalfClose()
+	if _, err := half.read(5 * time.Second); err != io.EOF {
+		t.Errorf("ReadValue() after HalfClose error = %v, want io.EOF", err)
+	}
+	half.send("PING")
+	if !s.WaitForCommand("PING", 2, 5*time.Second) {
+		t.Errorf("PING sent after HalfClose was not forwarded")
+	}
+
+	reset := dialProxy(t, p)
+	reset.send("PING")
+	reset.expect("+PONG\r\n")
+	p.Reset()
+	if _, err := reset.read(5 * time.Second); err == nil || err == io.EOF {
+		t.Errorf("ReadValue() after Reset error = %v, want connection reset", err)
+	}
+}
+
+func TestReconnectingDetectsStall(t *testing.T) {
+	s := redistest.NewServer(t)
+	p := redistest.NewProxy(t, s.Addr())
+
+	const interval = 100 * time.Millisecond
+	reconn := connection.NewReconnecting(p.Addr())
+	defer reconn.Close()
+	reconn.SetHealthCheckInterval(interval)
+	disconnected := make(chan time.Time, 1)
+	reconn.OnDisconnect(func() {
+		select {
+		case disconnected <- time.Now():
+		default:
+		}
+	})
+	reconn.Subscribe("orders")
+
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("Reconnecting never subscribed to orders")
+	}
+
+	// leave half a frame in the decoder, then stall the connection
+	s.InjectGarbage([]byte("*3\r\n$7\r\nmess"))
+	time.Sleep(50 * time.Millisecond)
+	paused := time.Now()
+	p.Pause()
+
+	// the connection is given up after 4 silent intervals, checked once per interval
+	select {
+	case at := <-disconnected:
+		if elapsed := at.Sub(paused); elapsed < 2*interval || elapsed > 4*interval+2*time.Second {
+			t.Errorf("stalled connection dropped after %v, want the health check timeout of %v", elapsed, 4*interval)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stalled connection was not dropped")
+	}
+
+	if !s.WaitForCommand("SUBSCRIBE", 2, 5*time.Second) {
+		t.Fatalf("Reconnecting did not resubscribe after the stall")
+	}
+	if got := p.LinkCount(); got != 2 {
+		t.Errorf("LinkCount() = %d after the reconnect, want the paused link and a new one", got)
+	}
+
+	// the paused link only notices the client left once it forwards again
+	p.Resume()
+	if !s.WaitFor(5*time.Second, func() bool { return p.LinkCount() == 1 && s.ConnCount() == 1 }) {
+		t.Errorf("LinkCount() = %d, ConnCount() = %d, want only the new connection", p.LinkCount(), s.ConnCount())
+	}
+
+	s.Publish("orders", `{"id":3}`)
+	expectMessage(t, reconn, "orders", `{"id":3}`)
+}
@@ -0,0 +1,208 @@
+package redistest_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/connection"
+	"github.com/Moonlight-Companies/goresp/redistest"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *resp.Reader
+}
+
+func dial(t *testing.T, s *redistest.Server) *client {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, reader: resp.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	if _, err := c.conn.Write(command.FormatCommand(args...)); err != nil {
+		c.t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func (c *client) read(timeout time.Duration) (resp.RESPValue, error) {
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	return c.reader.ReadValue()
+}
+
+func (c *client) expect(want string) {
+	c.t.Helper()
+	value, err := c.read(5 * time.Second)
+	if err != nil {
+		c.t.Fatalf("ReadValue() error = %v, want %q", err, want)
+	}
+	if got, _ := value.AppendRESP(nil); string(got) != want {
+		c.t.Fatalf("reply = %q, want %q", got, want)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	s := redistest.NewServer(t)
+	sub := dial(t, s)
+	pub := dial(t, s)
+
+	sub.send("SUBSCRIBE", "news", "sports")
+	sub.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	sub.expect("*3\r\n$9\r\nsubscribe\r\n$6\r\nsports\r\n:2\r\n")
+	sub.send("PSUBSCRIBE", "n?ws*")
+	sub.expect("*3\r\n$10\r\npsubscribe\r\n$5\r\nn?ws*\r\n:3\r\n")
+
+	pub.send("PUBLISH", "news", "hello")
+	pub.expect(":2\r\n")
+	sub.expect("*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	sub.expect("*4\r\n$8\r\npmessage\r\n$5\r\nn?ws*\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+
+	pub.send("PUBSUB", "CHANNELS")
+	pub.expect("*2\r\n$4\r\nnews\r\n$6\r\nsports\r\n")
+	pub.send("PUBSUB", "CHANNELS", "s*")
+	pub.expect("*1\r\n$6\r\nsports\r\n")
+	pub.send("PUBSUB", "NUMSUB", "news", "none")
+	pub.expect("*4\r\n$4\r\nnews\r\n:1\r\n$4\r\nnone\r\n:0\r\n")
+	pub.send("PUBSUB", "NUMPAT")
+	pub.expect(":1\r\n")
+
+	sub.send("UNSUBSCRIBE")
+	sub.expect("*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:2\r\n")
+	sub.expect("*3\r\n$11\r\nunsubscribe\r\n$6\r\nsports\r\n:1\r\n")
+	sub.send("PUNSUBSCRIBE", "n?ws*")
+	sub.expect("*3\r\n$12\r\npunsubscribe\r\n$5\r\nn?ws*\r\n:0\r\n")
+	sub.send("UNSUBSCRIBE")
+	sub.expect("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+
+	if got := s.Publish("news", "nobody"); got != 0 {
+		t.Errorf("Publish() = %d, want 0", got)
+	}
+	if !s.WaitForCommand("PUBSUB", 4, time.Second) {
+		t.Errorf("CommandCount(PUBSUB) = %d, want 4", s.CommandCount("PUBSUB"))
+	}
+}
+
+func TestStall(t *testing.T) {
+	s := redistest.NewServer(t)
+	c := dial(t, s)
+
+	c.send("SUBSCRIBE", "news")
+	c.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+
+	s.Stall()
+	s.Publish("news", "held")
+	c.send("PING")
+	if _, err := c.read(200 * time.Millisecond); err == nil {
+		t.Fatalf("ReadValue() during stall returned data")
+	}
+
+	c.reader = resp.NewReader(c.conn)
+	s.Resume()
+	c.expect("*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$4\r\nheld\r\n")
+	c.expect("*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+}
+
+func TestInjectGarbageAndDrop(t *testing.T) {
+	s := redistest.NewServer(t)
+	c := dial(t, s)
+	c.send("PING")
+	c.expect("+PONG\r\n")
+
+	s.InjectGarbage([]byte("%garbage\r\n"))
+	if _, err := c.read(5 * time.Second); err == nil {
+		t.Errorf("ReadValue() after garbage error = nil, want protocol error")
+	}
+
+	s.DropConnections()
+	if !s.WaitFor(5*time.Second, func() bool { return s.ConnCount() == 0 }) {
+		t.Errorf("ConnCount() = %d after DropConnections, want 0", s.ConnCount())
+	}
+}
+
+func TestReconnectingResubscribes(t *testing.T) {
+	s := redistest.NewServer(t)
+
+	reconn := connection.NewReconnecting(s.Addr())
+	defer reconn.Close()
+	reconn.Subscribe("orders")
+	reconn.PSubscribe("audit.*")
+
+	if !s.WaitForSubscribers("orders", 1, 5*time.Second) {
+		t.Fatalf("Reconnecting never subscribed to orders")
+	}
+	s.Publish("orders", `{"id":1}`)
+	expectMessage(t, reconn, "orders", `{"id":1}`)
+
+	s.DropConnections()
+	if !s.WaitForCommand("SUBSCRIBE", 2, 10*time.Second) {
+		t.Fatalf("Reconnecting did not resubscribe after the connection dropped")
+	}
+	s.WaitForSubscribers("orders", 1, 5*time.Second)
+	s.WaitFor(5*time.Second, func() bool { return s.NumPat() == 1 })
+
+	s.Publish("audit.login", `{"id":2}`)
+	expectMessage(t, reconn, "audit.login", `{"id":2}`)
+}
+
+func expectMessage(t *testing.T, reconn *connection.Reconnecting, channel, data string) {
+	t.Helper()
+
+	select {
+	case msg := <-reconn.Messages:
+		if msg.Channel != channel || string(msg.Data) != data {
+			t.Errorf("message = %s %s, want %s %s", msg.Channel, msg.Data, channel, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message received on %s", channel)
+	}
+}
+
+func TestClientList(t *testing.T) {
+	s := redistest.NewServer(t)
+	sub := dial(t, s)
+	admin := dial(t, s)
+
+	sub.send("CLIENT", "ID")
+	sub.expect(":1\r\n")
+	sub.send("SUBSCRIBE", "news", "sports")
+	sub.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	sub.expect("*3\r\n$9\r\nsubscribe\r\n$6\r\nsports\r\n:2\r\n")
+
+	admin.send("CLIENT", "LIST", "ID", "1")
+	value, err := admin.read(5 * time.Second)
+	if err != nil {
+		t.Fatalf("ReadValue() error = %v", err)
+	}
+	text, _ := value.AsString()
+	if !strings.HasPrefix(text, "id=1 ") || !strings.HasSuffix(text, " sub=2 psub=0\n") {
+		t.Errorf("CLIENT LIST ID 1 = %q, want sub=2 psub=0", text)
+	}
+
+	s.DropSubscribers("news")
+	admin.send("CLIENT", "LIST", "ID", "1")
+	value, _ = admin.read(5 * time.Second)
+	if text, _ := value.AsString(); !strings.HasSuffix(text, " sub=1 psub=0\n") {
+		t.Errorf("CLIENT LIST ID 1 after DropSubscribers = %q, want sub=1", text)
+	}
+
+	s.CopySubscribers("sports", "weather")
+	if s.NumSub("weather") != 1 {
+		t.Errorf("NumSub(weather) = %d after CopySubscribers, want 1", s.NumSub("weather"))
+	}
+	admin.send("CLIENT", "LIST", "ID", "1")
+	value, _ = admin.read(5 * time.Second)
+	if text, _ := value.AsString(); !strings.HasSuffix(text, " sub=2 psub=0\n") {
+		t.Errorf("CLIENT LIST ID 1 after CopySubscribers = %q, want sub=2", text)
+	}
+}
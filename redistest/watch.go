@@ -0,0 +1,57 @@
+package redistest
+
+import (
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+// touch marks a string key as changed: connections tracking it are sent an invalidation and
+// connections WATCHing it have their next EXEC fail
+func (s *Server) touch(key string) {
+	s.mutex.Lock()
+	for c := range s.watchers[key] {
+		c.FailWatch()
+	}
+	s.mutex.Unlock()
+
+	s.invalidate(key)
+}
+
+// unwatch forgets the keys c WATCHes, the caller holds s.mutex
+func (s *Server) unwatch(c *server.Conn) {
+	for key := range s.watchers {
+		removeSubscriber(s.watchers, key, c)
+	}
+}
+
+// endWatch drops the WATCHed keys of a connection once EXEC, DISCARD or UNWATCH ends them.
+// It runs before the command, the failure it may have caused is kept by the connection
+func (s *Server) endWatch(c *server.Conn, cmd server.Command) {
+	switch cmd.Name {
+	case "EXEC", "DISCARD":
+	case "UNWATCH":
+		if c.InTransaction() {
+			return
+		}
+	default:
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unwatch(c)
+}
+
+func (s *Server) handleWatch(c *server.Conn, cmd server.Command) {
+	if c.InTransaction() {
+		c.WriteError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+
+	s.mutex.Lock()
+	for _, key := range argStrings(cmd.Args) {
+		addSubscriber(s.watchers, key, c)
+	}
+	s.mutex.Unlock()
+	c.WriteOK()
+}
@@ -0,0 +1,82 @@
+package resp
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrNil is returned by the As accessors for a nil bulk string or nil array
+var ErrNil = errors.New("resp: nil reply")
+
+// ConversionError is returned by the As accessors when a reply can't be converted to the
+// requested Go type
+type ConversionError struct {
+	Value string
+	Want  string
+	Err   error
+}
+
+func (e *ConversionError) Error() string {
+	msg := "resp: cannot convert " + e.Value + " reply to " + e.Want
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+func parseInt64(value RESPValue, text string) (int64, error) {
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, &ConversionError{Value: value.Type(), Want: "int64", Err: err}
+	}
+	return n, nil
+}
+
+func parseFloat(value RESPValue, text string) (float64, error) {
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, &ConversionError{Value: value.Type(), Want: "float64", Err: err}
+	}
+	return f, nil
+}
+
+func mismatch(value RESPValue, want string) error {
+	return &ConversionError{Value: value.Type(), Want: want}
+}
+
+// arrayStrings converts every item of an array reply with AsString
+func arrayStrings(items []RESPValue) ([]string, error) {
+	result := make([]string, len(items))
+	for i, item := range items {
+		s, err := item.AsString()
+		if err != nil {
+			return nil, err
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// arrayMap converts a flat array of alternating keys and values, as returned by HGETALL
+func arrayMap(a *RESPArray) (map[string]string, error) {
+	if len(a.Items)%2 != 0 {
+		return nil, &ConversionError{Value: a.Type(), Want: "map[string]string", Err: errors.New("odd number of items")}
+	}
+	result := make(map[string]string, len(a.Items)/2)
+	for i := 0; i < len(a.Items); i += 2 {
+		key, err := a.Items[i].AsString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := a.Items[i+1].AsString()
+		if err != nil && err != ErrNil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
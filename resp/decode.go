@@ -2,28 +2,104 @@ package resp
 
 import (
 	"bytes"
+	"io"
+	"strconv"
+	"sync"
 )
 
 type Decode struct {
-	buffer bytes.Buffer
+	buffer          bytes.Buffer
+	inline          bool
+	streamThreshold int
+	stream          *decodeStream
+	separator       bool
 }
 
 func NewDecode() *Decode {
 	return &Decode{}
 }
 
-// Provide adds data to the parser's buffer
+// Provide adds data to the parser's buffer. While a streamed bulk string returned by Parse is
+// incomplete its payload goes to the stream Body instead, and Provide blocks until the
+// previous part has been read or the Body is closed
 func (p *Decode) Provide(data []byte) {
+	if p.stream != nil {
+		n := p.stream.feed(data)
+		data = data[n:]
+		if p.stream.done() {
+			p.stream = nil
+			p.separator = true
+		}
+	}
 	p.buffer.Write(data)
 }
 
-// Reset clears the parser's buffer, usually after a reconnect
+// Reset clears the parser's buffer, usually after a reconnect. An incomplete stream Body
+// fails with io.ErrUnexpectedEOF
 func (p *Decode) Reset() {
 	p.buffer.Reset()
+	if p.stream != nil {
+		p.stream.abort(io.ErrUnexpectedEOF)
+		p.stream = nil
+	}
+	p.separator = false
+}
+
+// AcceptInline enables the inline command format used by telnet and health probes (PING\r\n).
+// As in Redis, anything not starting with '*' is then read as an inline command and
+// returned as a RESPArray of bulk strings, so it only makes sense for server side decoding
+func (p *Decode) AcceptInline(enabled bool) {
+	p.inline = enabled
+}
+
+// SetStreamThreshold makes Parse return bulk strings of at least n bytes that end their top
+// level value as a *RESPBulkStream, as Reader.SetStreamThreshold does. The payload is fed to
+// the Body by the following Provide calls, which wait for it to be read, so the Body has to be
+// read or closed on another goroutine. A threshold of 0 disables streaming
+func (p *Decode) SetStreamThreshold(n int) {
+	p.streamThreshold = n
 }
 
 // Parse attempts to parse a complete RESP value from the current buffer
 func (p *Decode) Parse() (RESPValue, error) {
+	if p.stream != nil {
+		return nil, nil
+	}
+
+	if p.separator {
+		if p.buffer.Len() < len(PROTOCOL_SEPARATOR) {
+			return nil, nil
+		}
+		if !bytes.HasPrefix(p.buffer.Bytes(), PROTOCOL_SEPARATOR) {
+			return nil, errUnrecoverableProtocol
+		}
+		p.buffer.Next(len(PROTOCOL_SEPARATOR))
+		p.separator = false
+	}
+
+	if p.inline {
+		value, ok, err := p.parseInline()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return value, nil
+		}
+		if p.buffer.Len() == 0 || p.buffer.Bytes()[0] != byte(ARRAY) {
+			return nil, nil
+		}
+	}
+
+	if p.streamThreshold > 0 {
+		arrays, length, ok, err := p.scanStream(p.streamThreshold)
+		if err == errIncompleteData {
+			return nil, nil
+		}
+		if ok {
+			return wrapStream(arrays, &RESPBulkStream{Length: length, Body: p.startStream(length)}), nil
+		}
+	}
+
 	value, bytesConsumed, err := DecodeValue(&p.buffer, 0)
 	if err != nil {
 		if err == errIncompleteData {
@@ -41,3 +117,179 @@ func (p *Decode) Parse() (RESPValue, error) {
 func (p *Decode) HasData() bool {
 	return p.buffer.Len() > 3
 }
+
+// scanStream checks whether the buffered value ends in a bulk string of at least threshold
+// bytes. If so the headers and the items before it are consumed, the payload of the given
+// length is next in the buffer and the enclosing arrays are returned without their last item.
+// ok is false when the value should be decoded normally, errIncompleteData when more data is
+// needed to tell
+func (p *Decode) scanStream(threshold int) (arrays [][]RESPValue, length int, ok bool, err error) {
+	buf := &p.buffer
+	pos := 0
+
+	for {
+		if pos >= buf.Len() {
+			return nil, 0, false, errIncompleteData
+		}
+
+		end := bytes.Index(buf.Bytes()[pos:], PROTOCOL_SEPARATOR)
+		if end == -1 {
+			return nil, 0, false, errIncompleteData
+		}
+
+		opcode := buf.Bytes()[pos]
+		n, err := strconv.Atoi(string(buf.Bytes()[pos+1 : pos+end]))
+		if err != nil {
+			// leave the protocol error for Parse to report
+			return nil, 0, false, nil
+		}
+		pos += end + len(PROTOCOL_SEPARATOR)
+
+		switch OPCODE(opcode) {
+		case BULK_STRING:
+			if n < threshold {
+				return nil, 0, false, nil
+			}
+			buf.Next(pos)
+			return arrays, n, true, nil
+		case ARRAY:
+			if n <= 0 {
+				return nil, 0, false, nil
+			}
+			items := make([]RESPValue, 0, n)
+			for i := 0; i < n-1; i++ {
+				value, consumed, err := decodeValue(buf, pos)
+				if err == errIncompleteData {
+					return nil, 0, false, err
+				}
+				if err != nil {
+					return nil, 0, false, nil
+				}
+				items = append(items, value)
+				pos += consumed
+			}
+			arrays = append(arrays, items)
+		default:
+			return nil, 0, false, nil
+		}
+	}
+}
+
+// wrapStream puts a streamed bulk string back as the last item of the arrays returned by
+// scanStream
+func wrapStream(arrays [][]RESPValue, value RESPValue) RESPValue {
+	for i := len(arrays) - 1; i >= 0; i-- {
+		value = &RESPArray{Items: append(arrays[i], value)}
+	}
+	return value
+}
+
+// startStream moves the buffered part of a payload into a new stream body, which keeps
+// receiving the rest from Provide until length bytes were fed
+func (p *Decode) startStream(length int) *decodeStream {
+	s := &decodeStream{remaining: length}
+	s.cond = sync.NewCond(&s.mutex)
+
+	n := length
+	if n > p.buffer.Len() {
+		n = p.buffer.Len()
+	}
+	s.pending = append([]byte(nil), p.buffer.Next(n)...)
+	s.remaining -= n
+
+	if s.remaining > 0 {
+		p.stream = s
+	} else {
+		p.separator = true
+	}
+	return s
+}
+
+// decodeStream is the Body of a bulk string streamed by Decode, Provide feeds it one part at
+// a time while the reader consumes it on its own goroutine
+type decodeStream struct {
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	pending   []byte
+	remaining int
+	closed    bool
+	err       error
+}
+
+func (s *decodeStream) Read(b []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.pending) == 0 && s.remaining > 0 && s.err == nil && !s.closed {
+		s.cond.Wait()
+	}
+
+	if len(s.pending) > 0 {
+		n := copy(b, s.pending)
+		s.pending = s.pending[n:]
+		if len(s.pending) == 0 {
+			s.cond.Broadcast()
+		}
+		return n, nil
+	}
+	if s.remaining == 0 {
+		return 0, io.EOF
+	}
+	if s.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return 0, s.err
+}
+
+// Close discards the rest of the payload, the decoder skips it without waiting for a reader.
+// Once the whole payload was provided Close has no effect and what is left can still be read
+func (s *decodeStream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.remaining > 0 {
+		s.closed = true
+		s.pending = nil
+		s.cond.Broadcast()
+	}
+	return nil
+}
+
+// feed hands the next part of the payload to the reader once the previous one was read and
+// returns how many bytes of data belong to the payload
+func (s *decodeStream) feed(data []byte) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := len(data)
+	if n > s.remaining {
+		n = s.remaining
+	}
+
+	for len(s.pending) > 0 && !s.closed {
+		s.cond.Wait()
+	}
+	if !s.closed {
+		s.pending = append(s.pending, data[:n]...)
+	}
+	s.remaining -= n
+	s.cond.Broadcast()
+	return n
+}
+
+// done reports whether the whole payload was fed
+func (s *decodeStream) done() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.remaining == 0
+}
+
+// abort fails a body whose payload will never be complete
+func (s *decodeStream) abort(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.err = err
+	s.cond.Broadcast()
+}
@@ -7,3 +7,5 @@ import (
 var errIncompleteData = errors.New("incomplete data")
 var errUnrecoverableProtocol = errors.New("unrecoverable protocol error")
 var errInvalidOpcode = errors.New("invalid opcode")
+var errInlineTooBig = errors.New("Protocol error: too big inline request")
+var errUnbalancedQuotes = errors.New("Protocol error: unbalanced quotes in request")
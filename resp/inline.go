@@ -0,0 +1,148 @@
+package resp
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// maxInlineSize matches PROTO_INLINE_MAX_SIZE, the longest inline command Redis accepts
+const maxInlineSize = 64 * 1024
+
+// parseInline decodes an inline command (PING\r\n) from the front of the buffer.
+// ok is false when the buffer starts with a multibulk request or more data is needed
+func (p *Decode) parseInline() (value RESPValue, ok bool, err error) {
+	for p.buffer.Len() > 0 {
+		if p.buffer.Bytes()[0] == byte(ARRAY) {
+			return nil, false, nil
+		}
+
+		end := bytes.IndexByte(p.buffer.Bytes(), '\n')
+		if end == -1 {
+			if p.buffer.Len() > maxInlineSize {
+				return nil, false, errInlineTooBig
+			}
+			return nil, false, nil
+		}
+
+		line := bytes.TrimSuffix(p.buffer.Bytes()[:end], []byte{'\r'})
+		args, err := SplitArgs(string(line))
+		p.buffer.Next(end + 1)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// redis-cli and telnet users send blank lines, they are skipped
+		if len(args) == 0 {
+			continue
+		}
+
+		command := &RESPArray{Items: make([]RESPValue, len(args))}
+		for i, arg := range args {
+			command.Items[i] = &RESPBulkString{Value: []byte(arg)}
+		}
+		return command, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// SplitArgs splits an inline command line into arguments with the quoting rules of Redis
+// sdssplitargs. "double quoted" arguments support \n \r \t \b \a and \xHH escapes,
+// 'single quoted' arguments only \'. A closing quote must be followed by a space
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var current []byte
+		inDouble, inSingle, done := false, false, false
+
+		for !done {
+			if inDouble {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					current = append(current, byte(n))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if c == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			} else if inSingle {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			} else {
+				if i == len(line) {
+					break
+				}
+				switch c := line[i]; {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					current = append(current, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, string(current))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,285 @@
+package resp
+
+import (
+	"encoding"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarshalError is returned by Marshal for Go values that have no RESP representation
+type MarshalError struct {
+	Type reflect.Type
+}
+
+func (e *MarshalError) Error() string {
+	return "resp: unsupported type " + e.Type.String()
+}
+
+// Marshal converts a Go value into a RESP value suitable for a reply.
+//
+// strings, []byte, floats and encoding.TextMarshaler become bulk strings, integers and bools
+// become integers, slices and arrays become arrays. Maps and structs become flat arrays of
+// alternating field names and values, the way HGETALL replies, with struct fields named by a
+// `resp:"name"` tag ("-" skips the field, ",omitempty" drops zero values).
+// A nil pointer, interface or []byte is a nil bulk string and a nil slice or map is a nil array
+func Marshal(v interface{}) (RESPValue, error) {
+	return marshalValue(reflect.ValueOf(v), false)
+}
+
+// MarshalArgs converts Go values into a command array of bulk strings, numbers and bools are
+// sent as their decimal text. Slices, maps and structs are flattened into the argument list
+// so a struct can be passed straight to HSET. A command can't carry a nil bulk string, a nil
+// pointer, interface or []byte argument is an error. RESP values are passed through as
+// bulk strings, a simple string or integer is converted and an array or error is rejected
+func MarshalArgs(args ...interface{}) (*RESPArray, error) {
+	command := &RESPArray{Items: make([]RESPValue, 0, len(args))}
+	for _, arg := range args {
+		value, err := marshalValue(reflect.ValueOf(arg), true)
+		if err != nil {
+			return nil, err
+		}
+		command.Items = flattenArgs(command.Items, value)
+	}
+	return command, nil
+}
+
+func flattenArgs(items []RESPValue, value RESPValue) []RESPValue {
+	array, ok := value.(*RESPArray)
+	if !ok {
+		return append(items, value)
+	}
+	for _, item := range array.Items {
+		items = flattenArgs(items, item)
+	}
+	return items
+}
+
+var (
+	respValueType     = reflect.TypeOf((*RESPValue)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+var errNilArg = errors.New("resp: nil command argument")
+
+// nilValue is what a nil pointer, interface or []byte marshals to
+func nilValue(args bool) (RESPValue, error) {
+	if args {
+		return nil, errNilArg
+	}
+	return &RESPBulkString{}, nil
+}
+
+// respValue passes a RESP value through for a reply. A command argument has to be a bulk
+// string, simple strings and integers are converted and anything else is an error
+func respValue(value RESPValue, args bool) (RESPValue, error) {
+	if !args {
+		return value, nil
+	}
+	switch v := value.(type) {
+	case *RESPBulkString:
+		if v.Value == nil {
+			return nil, errNilArg
+		}
+		return v, nil
+	case *RESPBulkStream:
+		return v, nil
+	case *RESPSimpleString:
+		return &RESPBulkString{Value: []byte(v.Value)}, nil
+	case *RESPInteger:
+		return &RESPBulkString{Value: strconv.AppendInt(nil, v.Value, 10)}, nil
+	}
+	return nil, &MarshalError{Type: reflect.TypeOf(value)}
+}
+
+func marshalValue(v reflect.Value, args bool) (RESPValue, error) {
+	if !v.IsValid() {
+		return nilValue(args)
+	}
+
+	if v.Type().Implements(respValueType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nilValue(args)
+		}
+		return respValue(v.Interface().(RESPValue), args)
+	}
+
+	// the RESP types implement RESPValue on their pointer, a value of one is used as is too
+	if v.Kind() != reflect.Ptr && reflect.PtrTo(v.Type()).Implements(respValueType) {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return respValue(ptr.Interface().(RESPValue), args)
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nilValue(args)
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return &RESPBulkString{Value: text}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nilValue(args)
+		}
+		return marshalValue(v.Elem(), args)
+	case reflect.String:
+		return &RESPBulkString{Value: []byte(v.String())}, nil
+	case reflect.Bool:
+		if args {
+			return &RESPBulkString{Value: []byte(strconv.FormatBool(v.Bool()))}, nil
+		}
+		if v.Bool() {
+			return &RESPInteger{Value: 1}, nil
+		}
+		return &RESPInteger{Value: 0}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if args {
+			return &RESPBulkString{Value: strconv.AppendInt(nil, v.Int(), 10)}, nil
+		}
+		return &RESPInteger{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if args {
+			return &RESPBulkString{Value: strconv.AppendUint(nil, v.Uint(), 10)}, nil
+		}
+		if v.Uint() > math.MaxInt64 {
+			return &RESPBulkString{Value: strconv.AppendUint(nil, v.Uint(), 10)}, nil
+		}
+		return &RESPInteger{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &RESPBulkString{Value: strconv.AppendFloat(nil, v.Float(), 'g', -1, v.Type().Bits())}, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.IsNil() {
+				return nilValue(args)
+			}
+			return &RESPBulkString{Value: append([]byte{}, v.Bytes()...)}, nil
+		}
+		if v.IsNil() {
+			return &RESPArray{}, nil
+		}
+		return marshalSlice(v, args)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			value := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(value), v)
+			return &RESPBulkString{Value: value}, nil
+		}
+		return marshalSlice(v, args)
+	case reflect.Map:
+		if v.IsNil() {
+			return &RESPArray{}, nil
+		}
+		return marshalMap(v, args)
+	case reflect.Struct:
+		return marshalStruct(v, args)
+	}
+
+	return nil, &MarshalError{Type: v.Type()}
+}
+
+func marshalSlice(v reflect.Value, args bool) (RESPValue, error) {
+	array := &RESPArray{Items: make([]RESPValue, v.Len())}
+	for i := range array.Items {
+		item, err := marshalValue(v.Index(i), args)
+		if err != nil {
+			return nil, err
+		}
+		array.Items[i] = item
+	}
+	return array, nil
+}
+
+func marshalMap(v reflect.Value, args bool) (RESPValue, error) {
+	type pair struct {
+		key   RESPValue
+		value RESPValue
+	}
+
+	pairs := make([]pair, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := marshalValue(iter.Key(), true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalValue(iter.Value(), args)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key: key, value: value})
+	}
+
+	// map order is random, sort so the same map always encodes the same way
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].key.String() < pairs[j].key.String()
+	})
+
+	array := &RESPArray{Items: make([]RESPValue, 0, 2*len(pairs))}
+	for _, p := range pairs {
+		array.Items = append(array.Items, p.key, p.value)
+	}
+	return array, nil
+}
+
+func marshalStruct(v reflect.Value, args bool) (RESPValue, error) {
+	fields := structFields(v.Type())
+	array := &RESPArray{Items: make([]RESPValue, 0, 2*len(fields))}
+	for _, f := range fields {
+		field := v.Field(f.index)
+		if f.omitEmpty && field.IsZero() {
+			continue
+		}
+		value, err := marshalValue(field, args)
+		if err != nil {
+			return nil, err
+		}
+		array.Items = append(array.Items, &RESPBulkString{Value: []byte(f.name)}, value)
+	}
+	return array, nil
+}
+
+type structField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// structFields lists the exported fields of t with their `resp` tag names
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		omitEmpty := false
+		if tag, ok := f.Tag.Lookup("resp"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				if option == "omitempty" {
+					omitEmpty = true
+				}
+			}
+		}
+
+		fields = append(fields, structField{name: name, index: i, omitEmpty: omitEmpty})
+	}
+	return fields
+}
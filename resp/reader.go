@@ -0,0 +1,181 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+)
+
+const defaultReadSize = 16384
+
+// Reader decodes RESP values from an io.Reader such as a net.Conn, file or pipe
+type Reader struct {
+	rd              io.Reader
+	decoder         Decode
+	chunk           []byte
+	err             error
+	streamThreshold int
+	stream          *bulkBody
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{
+		rd:    rd,
+		chunk: make([]byte, defaultReadSize),
+	}
+}
+
+// SetStreamThreshold makes ReadValue return bulk strings of at least n bytes as a
+// *RESPBulkStream whose Body reads straight from the connection. Only a bulk string that
+// ends its top level value can be streamed (the payload of a pubsub message or a GET reply),
+// others are buffered as usual. A threshold of 0 disables streaming
+func (r *Reader) SetStreamThreshold(n int) {
+	r.streamThreshold = n
+}
+
+// AcceptInline makes the underlying decoder accept inline commands, see Decode.AcceptInline
+func (r *Reader) AcceptInline(enabled bool) {
+	r.decoder.AcceptInline(enabled)
+}
+
+// ReadValue blocks until a complete RESP value has been read from the underlying reader.
+// io.EOF is returned once the stream ends cleanly between values, io.ErrUnexpectedEOF
+// when it ends in the middle of one.
+// Any unread part of a previously returned RESPBulkStream is discarded first
+func (r *Reader) ReadValue() (RESPValue, error) {
+	if err := r.finishStream(); err != nil {
+		return nil, err
+	}
+
+	for {
+		if r.streamThreshold > 0 {
+			value, err := r.parseStream()
+			if err != nil && err != errIncompleteData {
+				return nil, err
+			}
+			if value != nil {
+				return value, nil
+			}
+		}
+
+		value, err := r.decoder.Parse()
+		if err != nil {
+			return nil, err
+		}
+
+		if value != nil {
+			return value, nil
+		}
+
+		if err := r.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Buffered returns the number of bytes read from the underlying reader but not yet decoded
+func (r *Reader) Buffered() int {
+	return r.decoder.buffer.Len()
+}
+
+// fill reads the next chunk into the decoder, data that arrives with an error is kept and
+// the error is reported on the following call
+func (r *Reader) fill() error {
+	if r.err != nil {
+		if r.err == io.EOF && r.decoder.buffer.Len() > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return r.err
+	}
+
+	n, err := r.rd.Read(r.chunk)
+	if n > 0 {
+		r.decoder.Provide(r.chunk[:n])
+	}
+	if err != nil {
+		r.err = err
+	}
+	return nil
+}
+
+// parseStream returns a value ending in a RESPBulkStream if the buffered data starts with one,
+// nil when the value should be decoded normally
+func (r *Reader) parseStream() (RESPValue, error) {
+	arrays, length, ok, err := r.decoder.scanStream(r.streamThreshold)
+	if !ok {
+		return nil, err
+	}
+
+	r.stream = &bulkBody{reader: r, remaining: length}
+	return wrapStream(arrays, &RESPBulkStream{Length: length, Body: r.stream}), nil
+}
+
+// finishStream discards what is left of the current stream body and its trailing separator
+func (r *Reader) finishStream() error {
+	if r.stream == nil {
+		return nil
+	}
+
+	if _, err := io.Copy(io.Discard, r.stream); err != nil {
+		return err
+	}
+
+	for r.decoder.buffer.Len() < len(PROTOCOL_SEPARATOR) {
+		if r.err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err := r.fill(); err != nil {
+			return err
+		}
+	}
+
+	if !bytes.HasPrefix(r.decoder.buffer.Bytes(), PROTOCOL_SEPARATOR) {
+		return errUnrecoverableProtocol
+	}
+	r.decoder.buffer.Next(len(PROTOCOL_SEPARATOR))
+	r.stream = nil
+	return nil
+}
+
+// bulkBody reads a streamed bulk string, first from the decoder buffer and then directly from
+// the underlying reader, never past the end of the payload
+type bulkBody struct {
+	reader    *Reader
+	remaining int
+}
+
+func (b *bulkBody) Read(p []byte) (int, error) {
+	if b.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	r := b.reader
+	if r.decoder.buffer.Len() > 0 {
+		n, _ := r.decoder.buffer.Read(p)
+		b.remaining -= n
+		return n, nil
+	}
+
+	if r.err != nil {
+		if r.err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, r.err
+	}
+
+	n, err := r.rd.Read(p)
+	b.remaining -= n
+	if err != nil {
+		r.err = err
+		if n > 0 {
+			return n, nil
+		}
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
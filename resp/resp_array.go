@@ -3,6 +3,7 @@ package resp
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 )
 
@@ -36,21 +37,33 @@ func (s *RESPArray) Equal(other RESPValue) bool {
 	return true
 }
 
-func (a *RESPArray) Encode(buf *bytes.Buffer) error {
-	buf.WriteByte(byte(ARRAY))
+func (a *RESPArray) Encode(w io.Writer) error {
+	b, err := a.AppendRESP(nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// AppendRESP appends the wire encoding of the value to b and returns the extended slice. It
+// only fails when an item does, a RESPBulkStream whose body is short, and then returns b as it was
+func (a *RESPArray) AppendRESP(b []byte) ([]byte, error) {
+	orig := b
+	b = append(b, byte(ARRAY))
 	if a.Items == nil {
-		buf.WriteString("-1")
-		buf.Write(PROTOCOL_SEPARATOR)
-		return nil
+		b = append(b, "-1"...)
+		return append(b, PROTOCOL_SEPARATOR...), nil
 	}
-	buf.WriteString(strconv.Itoa(len(a.Items)))
-	buf.Write(PROTOCOL_SEPARATOR)
+	b = strconv.AppendInt(b, int64(len(a.Items)), 10)
+	b = append(b, PROTOCOL_SEPARATOR...)
 	for _, item := range a.Items {
-		if err := item.Encode(buf); err != nil {
-			return err
+		var err error
+		if b, err = item.AppendRESP(b); err != nil {
+			return orig, err
 		}
 	}
-	return nil
+	return b, nil
 }
 
 func (a *RESPArray) Decode(buf *bytes.Buffer, start int) (int, error) {
@@ -96,3 +109,48 @@ func (a *RESPArray) Decode(buf *bytes.Buffer, start int) (int, error) {
 
 	return consumed, nil
 }
+
+func (a *RESPArray) IsNil() bool {
+	return a.Items == nil
+}
+
+func (a *RESPArray) Err() error {
+	return nil
+}
+
+func (a *RESPArray) AsString() (string, error) {
+	return "", mismatch(a, "string")
+}
+
+func (a *RESPArray) AsBytes() ([]byte, error) {
+	return nil, mismatch(a, "[]byte")
+}
+
+func (a *RESPArray) AsInt64() (int64, error) {
+	return 0, mismatch(a, "int64")
+}
+
+func (a *RESPArray) AsFloat() (float64, error) {
+	return 0, mismatch(a, "float64")
+}
+
+func (a *RESPArray) AsArray() ([]RESPValue, error) {
+	if a.Items == nil {
+		return nil, ErrNil
+	}
+	return a.Items, nil
+}
+
+func (a *RESPArray) AsStringSlice() ([]string, error) {
+	if a.Items == nil {
+		return nil, ErrNil
+	}
+	return arrayStrings(a.Items)
+}
+
+func (a *RESPArray) AsMap() (map[string]string, error) {
+	if a.Items == nil {
+		return nil, ErrNil
+	}
+	return arrayMap(a)
+}
@@ -0,0 +1,151 @@
+package resp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RESPBulkStream is a bulk string whose payload is exposed as an io.Reader instead of being
+// held in memory. Reader produces it for bulk strings at or above its stream threshold, and
+// encoding one copies exactly Length bytes from Body so large payloads can be written from a
+// file or pipe
+type RESPBulkStream struct {
+	Length int
+	Body   io.Reader
+}
+
+func (s *RESPBulkStream) Type() string {
+	return "BulkStream"
+}
+
+func (s *RESPBulkStream) String() string {
+	return fmt.Sprintf("<stream %d bytes>", s.Length)
+}
+
+// Equal only reports true for the same stream, the payload can only be consumed once
+func (s *RESPBulkStream) Equal(other RESPValue) bool {
+	otherStream, ok := other.(*RESPBulkStream)
+	if !ok {
+		return false
+	}
+	return s == otherStream
+}
+
+func (s *RESPBulkStream) Encode(w io.Writer) error {
+	header := s.appendHeader(nil)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if err := s.copyBody(w); err != nil {
+		return err
+	}
+	_, err := w.Write(PROTOCOL_SEPARATOR)
+	return err
+}
+
+// AppendRESP reads the whole body into b, use Encode to keep memory flat. A body shorter
+// than Length fails with io.ErrUnexpectedEOF and returns b unchanged
+func (s *RESPBulkStream) AppendRESP(b []byte) ([]byte, error) {
+	body, err := s.AsBytes()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return b, err
+	}
+	b = s.appendHeader(b)
+	b = append(b, body...)
+	return append(b, PROTOCOL_SEPARATOR...), nil
+}
+
+// Decode reads a complete bulk string from buf and exposes a copy of it as the stream body
+func (s *RESPBulkStream) Decode(buf *bytes.Buffer, start int) (int, error) {
+	bs := RESPBulkString{}
+	n, err := bs.Decode(buf, start)
+	if err != nil {
+		return 0, err
+	}
+	if bs.Value == nil {
+		return 0, errUnrecoverableProtocol
+	}
+	s.Length = len(bs.Value)
+	s.Body = bytes.NewReader(bs.Value)
+	return n, nil
+}
+
+func (s *RESPBulkStream) appendHeader(b []byte) []byte {
+	b = append(b, byte(BULK_STRING))
+	b = strconv.AppendInt(b, int64(s.Length), 10)
+	return append(b, PROTOCOL_SEPARATOR...)
+}
+
+func (s *RESPBulkStream) copyBody(w io.Writer) error {
+	if s.Length == 0 {
+		return nil
+	}
+	if s.Body == nil {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := io.CopyN(w, s.Body, int64(s.Length))
+	if err == io.EOF && n < int64(s.Length) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (s *RESPBulkStream) IsNil() bool {
+	return false
+}
+
+func (s *RESPBulkStream) Err() error {
+	return nil
+}
+
+// AsString reads the remaining body into memory
+func (s *RESPBulkStream) AsString() (string, error) {
+	b, err := s.AsBytes()
+	return string(b), err
+}
+
+// AsBytes reads the remaining body into memory
+func (s *RESPBulkStream) AsBytes() ([]byte, error) {
+	b := make([]byte, s.Length)
+	if s.Length == 0 {
+		return b, nil
+	}
+	if s.Body == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n, err := io.ReadFull(s.Body, b)
+	return b[:n], err
+}
+
+func (s *RESPBulkStream) AsInt64() (int64, error) {
+	b, err := s.AsBytes()
+	if err != nil {
+		return 0, err
+	}
+	return parseInt64(s, string(b))
+}
+
+func (s *RESPBulkStream) AsFloat() (float64, error) {
+	b, err := s.AsBytes()
+	if err != nil {
+		return 0, err
+	}
+	return parseFloat(s, string(b))
+}
+
+func (s *RESPBulkStream) AsArray() ([]RESPValue, error) {
+	return nil, mismatch(s, "[]RESPValue")
+}
+
+func (s *RESPBulkStream) AsStringSlice() ([]string, error) {
+	return nil, mismatch(s, "[]string")
+}
+
+func (s *RESPBulkStream) AsMap() (map[string]string, error) {
+	return nil, mismatch(s, "map[string]string")
+}
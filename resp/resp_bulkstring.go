@@ -2,6 +2,7 @@ package resp
 
 import (
 	"bytes"
+	"io"
 	"strconv"
 )
 
@@ -40,18 +41,24 @@ func (s *RESPBulkString) Equal(other RESPValue) bool {
 	return bytes.Equal(s.Value, otherString.Value)
 }
 
-func (bs *RESPBulkString) Encode(buf *bytes.Buffer) error {
-	buf.WriteByte(byte(BULK_STRING))
+func (bs *RESPBulkString) Encode(w io.Writer) error {
+	b, _ := bs.AppendRESP(nil)
+	_, err := w.Write(b)
+	return err
+}
+
+// AppendRESP appends the wire encoding of the value to b and returns the extended slice,
+// it never fails
+func (bs *RESPBulkString) AppendRESP(b []byte) ([]byte, error) {
+	b = append(b, byte(BULK_STRING))
 	if bs.Value == nil {
-		buf.WriteString("-1")
-		buf.Write(PROTOCOL_SEPARATOR)
-	} else {
-		buf.WriteString(strconv.Itoa(len(bs.Value)))
-		buf.Write(PROTOCOL_SEPARATOR)
-		buf.Write(bs.Value)
-		buf.Write(PROTOCOL_SEPARATOR)
+		b = append(b, "-1"...)
+		return append(b, PROTOCOL_SEPARATOR...), nil
 	}
-	return nil
+	b = strconv.AppendInt(b, int64(len(bs.Value)), 10)
+	b = append(b, PROTOCOL_SEPARATOR...)
+	b = append(b, bs.Value...)
+	return append(b, PROTOCOL_SEPARATOR...), nil
 }
 
 func (bs *RESPBulkString) Decode(buf *bytes.Buffer, start int) (int, error) {
@@ -90,3 +97,51 @@ func (bs *RESPBulkString) Decode(buf *bytes.Buffer, start int) (int, error) {
 
 	return consumed + length + len(PROTOCOL_SEPARATOR), nil
 }
+
+func (bs *RESPBulkString) IsNil() bool {
+	return bs.Value == nil
+}
+
+func (bs *RESPBulkString) Err() error {
+	return nil
+}
+
+func (bs *RESPBulkString) AsString() (string, error) {
+	if bs.Value == nil {
+		return "", ErrNil
+	}
+	return string(bs.Value), nil
+}
+
+func (bs *RESPBulkString) AsBytes() ([]byte, error) {
+	if bs.Value == nil {
+		return nil, ErrNil
+	}
+	return bs.Value, nil
+}
+
+func (bs *RESPBulkString) AsInt64() (int64, error) {
+	if bs.Value == nil {
+		return 0, ErrNil
+	}
+	return parseInt64(bs, string(bs.Value))
+}
+
+func (bs *RESPBulkString) AsFloat() (float64, error) {
+	if bs.Value == nil {
+		return 0, ErrNil
+	}
+	return parseFloat(bs, string(bs.Value))
+}
+
+func (bs *RESPBulkString) AsArray() ([]RESPValue, error) {
+	return nil, mismatch(bs, "[]RESPValue")
+}
+
+func (bs *RESPBulkString) AsStringSlice() ([]string, error) {
+	return nil, mismatch(bs, "[]string")
+}
+
+func (bs *RESPBulkString) AsMap() (map[string]string, error) {
+	return nil, mismatch(bs, "map[string]string")
+}
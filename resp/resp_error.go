@@ -2,6 +2,8 @@ package resp
 
 import (
 	"bytes"
+	"io"
+	"strings"
 )
 
 type RESPError struct {
@@ -24,11 +26,18 @@ func (s *RESPError) Equal(other RESPValue) bool {
 	return s.Value == otherError.Value
 }
 
-func (e *RESPError) Encode(buf *bytes.Buffer) error {
-	buf.WriteByte(byte(ERROR))
-	buf.WriteString(e.Value)
-	buf.Write(PROTOCOL_SEPARATOR)
-	return nil
+func (e *RESPError) Encode(w io.Writer) error {
+	b, _ := e.AppendRESP(nil)
+	_, err := w.Write(b)
+	return err
+}
+
+// AppendRESP appends the wire encoding of the value to b and returns the extended slice,
+// it never fails
+func (e *RESPError) AppendRESP(b []byte) ([]byte, error) {
+	b = append(b, byte(ERROR))
+	b = append(b, e.Value...)
+	return append(b, PROTOCOL_SEPARATOR...), nil
 }
 
 func (e *RESPError) Decode(buf *bytes.Buffer, start int) (int, error) {
@@ -48,3 +57,52 @@ func (e *RESPError) Decode(buf *bytes.Buffer, start int) (int, error) {
 	e.Value = string(buf.Bytes()[start+1 : start+end])
 	return end + len(PROTOCOL_SEPARATOR), nil
 }
+
+// Error makes a RESPError usable as a Go error, the message is the full error line
+func (e *RESPError) Error() string {
+	return e.Value
+}
+
+// Prefix returns the error code, the first word of the message such as ERR or WRONGTYPE
+func (e *RESPError) Prefix() string {
+	if i := strings.IndexByte(e.Value, ' '); i != -1 {
+		return e.Value[:i]
+	}
+	return e.Value
+}
+
+func (e *RESPError) IsNil() bool {
+	return false
+}
+
+func (e *RESPError) Err() error {
+	return e
+}
+
+func (e *RESPError) AsString() (string, error) {
+	return "", e
+}
+
+func (e *RESPError) AsBytes() ([]byte, error) {
+	return nil, e
+}
+
+func (e *RESPError) AsInt64() (int64, error) {
+	return 0, e
+}
+
+func (e *RESPError) AsFloat() (float64, error) {
+	return 0, e
+}
+
+func (e *RESPError) AsArray() ([]RESPValue, error) {
+	return nil, e
+}
+
+func (e *RESPError) AsStringSlice() ([]string, error) {
+	return nil, e
+}
+
+func (e *RESPError) AsMap() (map[string]string, error) {
+	return nil, e
+}
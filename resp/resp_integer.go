@@ -3,6 +3,7 @@ package resp
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 )
 
@@ -26,11 +27,18 @@ func (s *RESPInteger) Equal(other RESPValue) bool {
 	return s.Value == otherInteger.Value
 }
 
-func (i *RESPInteger) Encode(buf *bytes.Buffer) error {
-	buf.WriteByte(byte(INTEGER))
-	buf.WriteString(strconv.FormatInt(i.Value, 10))
-	buf.Write(PROTOCOL_SEPARATOR)
-	return nil
+func (i *RESPInteger) Encode(w io.Writer) error {
+	b, _ := i.AppendRESP(nil)
+	_, err := w.Write(b)
+	return err
+}
+
+// AppendRESP appends the wire encoding of the value to b and returns the extended slice,
+// it never fails
+func (i *RESPInteger) AppendRESP(b []byte) ([]byte, error) {
+	b = append(b, byte(INTEGER))
+	b = strconv.AppendInt(b, i.Value, 10)
+	return append(b, PROTOCOL_SEPARATOR...), nil
 }
 
 func (i *RESPInteger) Decode(buf *bytes.Buffer, start int) (int, error) {
@@ -55,3 +63,39 @@ func (i *RESPInteger) Decode(buf *bytes.Buffer, start int) (int, error) {
 	i.Value = value
 	return end + len(PROTOCOL_SEPARATOR), nil
 }
+
+func (i *RESPInteger) IsNil() bool {
+	return false
+}
+
+func (i *RESPInteger) Err() error {
+	return nil
+}
+
+func (i *RESPInteger) AsString() (string, error) {
+	return strconv.FormatInt(i.Value, 10), nil
+}
+
+func (i *RESPInteger) AsBytes() ([]byte, error) {
+	return strconv.AppendInt(nil, i.Value, 10), nil
+}
+
+func (i *RESPInteger) AsInt64() (int64, error) {
+	return i.Value, nil
+}
+
+func (i *RESPInteger) AsFloat() (float64, error) {
+	return float64(i.Value), nil
+}
+
+func (i *RESPInteger) AsArray() ([]RESPValue, error) {
+	return nil, mismatch(i, "[]RESPValue")
+}
+
+func (i *RESPInteger) AsStringSlice() ([]string, error) {
+	return nil, mismatch(i, "[]string")
+}
+
+func (i *RESPInteger) AsMap() (map[string]string, error) {
+	return nil, mismatch(i, "map[string]string")
+}
@@ -2,6 +2,7 @@ package resp
 
 import (
 	"bytes"
+	"io"
 )
 
 type RESPSimpleString struct {
@@ -24,11 +25,18 @@ func (s *RESPSimpleString) Equal(other RESPValue) bool {
 	return s.Value == otherString.Value
 }
 
-func (ss *RESPSimpleString) Encode(buf *bytes.Buffer) error {
-	buf.WriteByte(byte(SIMPLE_STRING))
-	buf.WriteString(ss.Value)
-	buf.Write(PROTOCOL_SEPARATOR)
-	return nil
+func (ss *RESPSimpleString) Encode(w io.Writer) error {
+	b, _ := ss.AppendRESP(nil)
+	_, err := w.Write(b)
+	return err
+}
+
+// AppendRESP appends the wire encoding of the value to b and returns the extended slice,
+// it never fails
+func (ss *RESPSimpleString) AppendRESP(b []byte) ([]byte, error) {
+	b = append(b, byte(SIMPLE_STRING))
+	b = append(b, ss.Value...)
+	return append(b, PROTOCOL_SEPARATOR...), nil
 }
 
 func (ss *RESPSimpleString) Decode(buf *bytes.Buffer, start int) (int, error) {
@@ -48,3 +56,39 @@ func (ss *RESPSimpleString) Decode(buf *bytes.Buffer, start int) (int, error) {
 	ss.Value = string(buf.Bytes()[start+1 : start+end])
 	return end + len(PROTOCOL_SEPARATOR), nil
 }
+
+func (ss *RESPSimpleString) IsNil() bool {
+	return false
+}
+
+func (ss *RESPSimpleString) Err() error {
+	return nil
+}
+
+func (ss *RESPSimpleString) AsString() (string, error) {
+	return ss.Value, nil
+}
+
+func (ss *RESPSimpleString) AsBytes() ([]byte, error) {
+	return []byte(ss.Value), nil
+}
+
+func (ss *RESPSimpleString) AsInt64() (int64, error) {
+	return parseInt64(ss, ss.Value)
+}
+
+func (ss *RESPSimpleString) AsFloat() (float64, error) {
+	return parseFloat(ss, ss.Value)
+}
+
+func (ss *RESPSimpleString) AsArray() ([]RESPValue, error) {
+	return nil, mismatch(ss, "[]RESPValue")
+}
+
+func (ss *RESPSimpleString) AsStringSlice() ([]string, error) {
+	return nil, mismatch(ss, "[]string")
+}
+
+func (ss *RESPSimpleString) AsMap() (map[string]string, error) {
+	return nil, mismatch(ss, "map[string]string")
+}
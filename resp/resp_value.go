@@ -2,6 +2,7 @@ package resp
 
 import (
 	"bytes"
+	"io"
 )
 
 type RESPValue interface {
@@ -9,7 +10,23 @@ type RESPValue interface {
 	String() string
 	Equal(RESPValue) bool
 	Decode(*bytes.Buffer, int) (int, error)
-	Encode(buf *bytes.Buffer) error
+	Encode(w io.Writer) error
+	AppendRESP(b []byte) ([]byte, error)
+
+	// IsNil reports whether the value is a nil bulk string or nil array
+	IsNil() bool
+	// Err returns a RESPError as a Go error and nil for every other value
+	Err() error
+
+	// The As accessors convert a reply to a Go type. A RESPError is returned as the error,
+	// a nil reply as ErrNil and anything that doesn't convert as a *ConversionError
+	AsString() (string, error)
+	AsBytes() ([]byte, error)
+	AsInt64() (int64, error)
+	AsFloat() (float64, error)
+	AsArray() ([]RESPValue, error)
+	AsStringSlice() ([]string, error)
+	AsMap() (map[string]string, error)
 }
 
 func decodeValue(buf *bytes.Buffer, start int) (RESPValue, int, error) {
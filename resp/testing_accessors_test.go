@@ -0,0 +1,128 @@
+package resp_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+func TestAccessors(t *testing.T) {
+	t.Run("AsInt64", func(t *testing.T) {
+		for _, value := range []resp.RESPValue{
+			&resp.RESPInteger{Value: 42},
+			&resp.RESPBulkString{Value: []byte("42")},
+			&resp.RESPSimpleString{Value: "42"},
+		} {
+			if got, err := value.AsInt64(); err != nil || got != 42 {
+				t.Errorf("%s.AsInt64() = %d, %v; want 42", value.Type(), got, err)
+			}
+		}
+	})
+
+	t.Run("AsString", func(t *testing.T) {
+		for _, value := range []resp.RESPValue{
+			&resp.RESPSimpleString{Value: "OK"},
+			&resp.RESPBulkString{Value: []byte("OK")},
+		} {
+			if got, err := value.AsString(); err != nil || got != "OK" {
+				t.Errorf("%s.AsString() = %q, %v; want OK", value.Type(), got, err)
+			}
+		}
+		if got, _ := (&resp.RESPInteger{Value: 7}).AsString(); got != "7" {
+			t.Errorf("Integer.AsString() = %q, want 7", got)
+		}
+	})
+
+	t.Run("AsBytes", func(t *testing.T) {
+		got, err := (&resp.RESPBulkString{Value: []byte("data")}).AsBytes()
+		if err != nil || string(got) != "data" {
+			t.Errorf("BulkString.AsBytes() = %q, %v; want data", got, err)
+		}
+	})
+
+	t.Run("AsFloat", func(t *testing.T) {
+		if got, err := (&resp.RESPBulkString{Value: []byte("1.5")}).AsFloat(); err != nil || got != 1.5 {
+			t.Errorf("BulkString.AsFloat() = %v, %v; want 1.5", got, err)
+		}
+		if got, err := (&resp.RESPInteger{Value: 2}).AsFloat(); err != nil || got != 2 {
+			t.Errorf("Integer.AsFloat() = %v, %v; want 2", got, err)
+		}
+	})
+
+	t.Run("AsStringSlice", func(t *testing.T) {
+		value := &resp.RESPArray{Items: []resp.RESPValue{
+			&resp.RESPBulkString{Value: []byte("a")},
+			&resp.RESPSimpleString{Value: "b"},
+			&resp.RESPInteger{Value: 3},
+		}}
+		got, err := value.AsStringSlice()
+		if err != nil || !reflect.DeepEqual(got, []string{"a", "b", "3"}) {
+			t.Errorf("Array.AsStringSlice() = %v, %v", got, err)
+		}
+	})
+
+	t.Run("AsMap", func(t *testing.T) {
+		value := &resp.RESPArray{Items: []resp.RESPValue{
+			&resp.RESPBulkString{Value: []byte("field")},
+			&resp.RESPBulkString{Value: []byte("value")},
+		}}
+		got, err := value.AsMap()
+		if err != nil || !reflect.DeepEqual(got, map[string]string{"field": "value"}) {
+			t.Errorf("Array.AsMap() = %v, %v", got, err)
+		}
+
+		odd := &resp.RESPArray{Items: []resp.RESPValue{&resp.RESPBulkString{Value: []byte("field")}}}
+		if _, err := odd.AsMap(); err == nil {
+			t.Errorf("Array.AsMap() with odd items error = nil, want error")
+		}
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		nilBulk := &resp.RESPBulkString{}
+		nilArray := &resp.RESPArray{}
+		if !nilBulk.IsNil() || !nilArray.IsNil() {
+			t.Errorf("IsNil() = false for nil bulk string or nil array")
+		}
+		if (&resp.RESPBulkString{Value: []byte{}}).IsNil() {
+			t.Errorf("IsNil() = true for empty bulk string")
+		}
+		if _, err := nilBulk.AsString(); err != resp.ErrNil {
+			t.Errorf("nil BulkString.AsString() error = %v, want ErrNil", err)
+		}
+		if _, err := nilArray.AsStringSlice(); err != resp.ErrNil {
+			t.Errorf("nil Array.AsStringSlice() error = %v, want ErrNil", err)
+		}
+	})
+
+	t.Run("Err", func(t *testing.T) {
+		value := &resp.RESPError{Value: "WRONGTYPE Operation against a key holding the wrong kind of value"}
+		err := value.Err()
+		if err == nil || err.Error() != value.Value {
+			t.Fatalf("Error.Err() = %v, want %q", err, value.Value)
+		}
+		if value.Prefix() != "WRONGTYPE" {
+			t.Errorf("Error.Prefix() = %q, want WRONGTYPE", value.Prefix())
+		}
+		if _, got := value.AsInt64(); got != err {
+			t.Errorf("Error.AsInt64() error = %v, want %v", got, err)
+		}
+		if (&resp.RESPSimpleString{Value: "OK"}).Err() != nil {
+			t.Errorf("SimpleString.Err() != nil")
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		_, err := (&resp.RESPArray{Items: []resp.RESPValue{}}).AsInt64()
+		var conversion *resp.ConversionError
+		if !errors.As(err, &conversion) || conversion.Want != "int64" || conversion.Value != "Array" {
+			t.Errorf("Array.AsInt64() error = %v, want ConversionError", err)
+		}
+
+		_, err = (&resp.RESPBulkString{Value: []byte("abc")}).AsInt64()
+		if !errors.As(err, &conversion) || conversion.Err == nil {
+			t.Errorf("BulkString.AsInt64() error = %v, want ConversionError with cause", err)
+		}
+	})
+}
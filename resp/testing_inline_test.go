@@ -0,0 +1,106 @@
+package resp_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"PING", []string{"PING"}, false},
+		{"  SET  key   value ", []string{"SET", "key", "value"}, false},
+		{`SET key "hello world"`, []string{"SET", "key", "hello world"}, false},
+		{`SET key 'hello world'`, []string{"SET", "key", "hello world"}, false},
+		{`SET key "a\nb\tc\\d\"e"`, []string{"SET", "key", "a\nb\tc\\d\"e"}, false},
+		{`SET key "\x41\x4a\x7a"`, []string{"SET", "key", "AJz"}, false},
+		{`SET key "\x4"`, []string{"SET", "key", "x4"}, false},
+		{`SET key 'it\'s'`, []string{"SET", "key", "it's"}, false},
+		{`SET key 'a\nb'`, []string{"SET", "key", `a\nb`}, false},
+		{`SET key ""`, []string{"SET", "key", ""}, false},
+		{`SET key foo"bar"`, []string{"SET", "key", "foobar"}, false},
+		{`SET key "unterminated`, nil, true},
+		{`SET key 'unterminated`, nil, true},
+		{`SET key "closed"trailing`, nil, true},
+		{`SET key 'closed'trailing`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := resp.SplitArgs(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("SplitArgs() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeInline(t *testing.T) {
+	decoder := resp.NewDecode()
+	decoder.AcceptInline(true)
+	decoder.Provide([]byte("PING\r\n\r\nSET key \"a b\"\n*1\r\n$4\r\nPING\r\nECHO hel"))
+
+	expected := []string{
+		string(command.FormatCommand("PING")),
+		string(command.FormatCommand("SET", "key", "a b")),
+		string(command.FormatCommand("PING")),
+	}
+	for i, want := range expected {
+		value, err := decoder.Parse()
+		if err != nil || value == nil {
+			t.Fatalf("Parse() %d = %v, %v", i, value, err)
+		}
+		if got, _ := value.AppendRESP(nil); string(got) != want {
+			t.Errorf("Parse() %d = %q, want %q", i, got, want)
+		}
+	}
+
+	if value, err := decoder.Parse(); value != nil || err != nil {
+		t.Fatalf("Parse() on partial line = %v, %v; want nil, nil", value, err)
+	}
+	decoder.Provide([]byte("lo\r\n"))
+	value, err := decoder.Parse()
+	if err != nil || !value.Equal(&resp.RESPArray{Items: []resp.RESPValue{bulk("ECHO"), bulk("hello")}}) {
+		t.Errorf("Parse() = %v, %v; want [ECHO hello]", value, err)
+	}
+}
+
+func TestDecodeInlineErrors(t *testing.T) {
+	t.Run("Unbalanced quotes", func(t *testing.T) {
+		decoder := resp.NewDecode()
+		decoder.AcceptInline(true)
+		decoder.Provide([]byte("SET key \"oops\r\n"))
+		if _, err := decoder.Parse(); err == nil || !strings.Contains(err.Error(), "unbalanced quotes") {
+			t.Errorf("Parse() error = %v, want unbalanced quotes", err)
+		}
+	})
+
+	t.Run("Too big", func(t *testing.T) {
+		decoder := resp.NewDecode()
+		decoder.AcceptInline(true)
+		decoder.Provide([]byte(strings.Repeat("a", 64*1024+1)))
+		if _, err := decoder.Parse(); err == nil || !strings.Contains(err.Error(), "too big inline request") {
+			t.Errorf("Parse() error = %v, want too big inline request", err)
+		}
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		decoder := resp.NewDecode()
+		decoder.Provide([]byte("PING\r\n"))
+		if _, err := decoder.Parse(); err == nil {
+			t.Errorf("Parse() error = nil, want invalid opcode")
+		}
+	})
+}
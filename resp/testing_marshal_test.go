@@ -0,0 +1,262 @@
+package resp_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+type marshalUser struct {
+	Name    string `resp:"name"`
+	Age     int    `resp:"age"`
+	Admin   bool   `resp:"admin,omitempty"`
+	Secret  string `resp:"-"`
+	Balance float64
+}
+
+func bulk(s string) *resp.RESPBulkString {
+	return &resp.RESPBulkString{Value: []byte(s)}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected resp.RESPValue
+	}{
+		{"String", "hello", bulk("hello")},
+		{"Bytes", []byte("hi"), bulk("hi")},
+		{"Nil bytes", []byte(nil), &resp.RESPBulkString{}},
+		{"Nil", nil, &resp.RESPBulkString{}},
+		{"Nil pointer", (*int)(nil), &resp.RESPBulkString{}},
+		{"Int", 42, &resp.RESPInteger{Value: 42}},
+		{"Uint8", uint8(7), &resp.RESPInteger{Value: 7}},
+		{"Bool", true, &resp.RESPInteger{Value: 1}},
+		{"Float", 1.5, bulk("1.5")},
+		{"Slice", []interface{}{"a", 1}, &resp.RESPArray{Items: []resp.RESPValue{bulk("a"), &resp.RESPInteger{Value: 1}}}},
+		{"Nil slice", []string(nil), &resp.RESPArray{}},
+		{"Empty slice", []string{}, &resp.RESPArray{Items: []resp.RESPValue{}}},
+		{"Map", map[string]int{"b": 2, "a": 1}, &resp.RESPArray{Items: []resp.RESPValue{
+			bulk("a"), &resp.RESPInteger{Value: 1}, bulk("b"), &resp.RESPInteger{Value: 2},
+		}}},
+		{"Struct", marshalUser{Name: "ann", Age: 30, Secret: "x", Balance: 2.25}, &resp.RESPArray{Items: []resp.RESPValue{
+			bulk("name"), bulk("ann"), bulk("age"), &resp.RESPInteger{Value: 30}, bulk("Balance"), bulk("2.25"),
+		}}},
+		{"RESPValue", &resp.RESPSimpleString{Value: "OK"}, &resp.RESPSimpleString{Value: "OK"}},
+		{"RESPValue by value", resp.RESPBulkString{Value: []byte("raw")}, bulk("raw")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resp.Marshal(tt.input)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Marshal() = %#v, want %#v", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := resp.Marshal(func() {}); err == nil {
+		t.Errorf("Marshal(func) error = nil, want error")
+	}
+}
+
+func TestMarshalArgs(t *testing.T) {
+	got, err := resp.MarshalArgs("HSET", "user:1", marshalUser{Name: "ann", Age: 30, Admin: true}, 1.5)
+	if err != nil {
+		t.Fatalf("MarshalArgs() error = %v", err)
+	}
+	expected := &resp.RESPArray{Items: []resp.RESPValue{
+		bulk("HSET"), bulk("user:1"),
+		bulk("name"), bulk("ann"), bulk("age"), bulk("30"), bulk("admin"), bulk("true"), bulk("Balance"), bulk("0"),
+		bulk("1.5"),
+	}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("MarshalArgs() = %v, want %v", got, expected)
+	}
+
+	got, err = resp.MarshalArgs("SET", &resp.RESPSimpleString{Value: "k"}, &resp.RESPInteger{Value: 42}, bulk("v"))
+	if err != nil {
+		t.Fatalf("MarshalArgs() error = %v", err)
+	}
+	expected = &resp.RESPArray{Items: []resp.RESPValue{bulk("SET"), bulk("k"), bulk("42"), bulk("v")}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("MarshalArgs() = %v, want %v", got, expected)
+	}
+
+	for _, arg := range []interface{}{
+		nil, (*int)(nil), []byte(nil), (*resp.RESPBulkString)(nil), &resp.RESPBulkString{},
+		&resp.RESPArray{Items: []resp.RESPValue{bulk("a")}}, &resp.RESPError{Value: "ERR boom"},
+	} {
+		if _, err := resp.MarshalArgs("SET", "k", arg); err == nil {
+			t.Errorf("MarshalArgs(%#v) error = nil, want error", arg)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Run("Scalars", func(t *testing.T) {
+		var s string
+		var b []byte
+		var i int
+		var u uint16
+		var f float64
+		var ok bool
+
+		steps := []struct {
+			value resp.RESPValue
+			dst   interface{}
+		}{
+			{bulk("hello"), &s},
+			{&resp.RESPSimpleString{Value: "raw"}, &b},
+			{bulk("-12"), &i},
+			{&resp.RESPInteger{Value: 80}, &u},
+			{bulk("3.25"), &f},
+			{&resp.RESPInteger{Value: 1}, &ok},
+		}
+		for _, step := range steps {
+			if err := resp.Unmarshal(step.value, step.dst); err != nil {
+				t.Fatalf("Unmarshal(%v) error = %v", step.value, err)
+			}
+		}
+
+		if s != "hello" || string(b) != "raw" || i != -12 || u != 80 || f != 3.25 || !ok {
+			t.Errorf("Unmarshal() got %q %q %d %d %v %v", s, b, i, u, f, ok)
+		}
+	})
+
+	t.Run("Nil bulk string", func(t *testing.T) {
+		s := "previous"
+		p := &s
+		if err := resp.Unmarshal(&resp.RESPBulkString{}, &p); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if p != nil {
+			t.Errorf("Unmarshal() pointer = %v, want nil", p)
+		}
+	})
+
+	t.Run("Nil array", func(t *testing.T) {
+		items := []string{"previous"}
+		if err := resp.Unmarshal(&resp.RESPArray{}, &items); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if items != nil {
+			t.Errorf("Unmarshal() slice = %v, want nil", items)
+		}
+	})
+
+	t.Run("Slice", func(t *testing.T) {
+		var got []int
+		value := &resp.RESPArray{Items: []resp.RESPValue{&resp.RESPInteger{Value: 1}, bulk("2")}}
+		if err := resp.Unmarshal(value, &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, []int{1, 2}) {
+			t.Errorf("Unmarshal() = %v, want [1 2]", got)
+		}
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		var got map[string]int
+		value := &resp.RESPArray{Items: []resp.RESPValue{bulk("a"), bulk("1"), bulk("b"), bulk("2")}}
+		if err := resp.Unmarshal(value, &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, map[string]int{"a": 1, "b": 2}) {
+			t.Errorf("Unmarshal() = %v", got)
+		}
+	})
+
+	t.Run("RESPValue", func(t *testing.T) {
+		var value resp.RESPValue = bulk("x")
+		if err := resp.Unmarshal(nil, &value); err != nil || value != nil {
+			t.Errorf("Unmarshal(nil) = %v, %v, want nil", value, err)
+		}
+
+		var ptr *resp.RESPBulkString
+		var plain resp.RESPBulkString
+		if err := resp.Unmarshal(bulk("a"), &ptr); err != nil || ptr == nil || string(ptr.Value) != "a" {
+			t.Errorf("Unmarshal() into *RESPBulkString = %v, %v, want a", ptr, err)
+		}
+		if err := resp.Unmarshal(bulk("b"), &plain); err != nil || string(plain.Value) != "b" {
+			t.Errorf("Unmarshal() into RESPBulkString = %v, %v, want b", plain, err)
+		}
+		var typeErr *resp.UnmarshalTypeError
+		if err := resp.Unmarshal(&resp.RESPInteger{Value: 1}, &plain); !errors.As(err, &typeErr) {
+			t.Errorf("Unmarshal() integer into RESPBulkString error = %v, want UnmarshalTypeError", err)
+		}
+	})
+
+	t.Run("Bulk stream", func(t *testing.T) {
+		stream := func() *resp.RESPBulkStream {
+			return &resp.RESPBulkStream{Length: 5, Body: strings.NewReader("hello")}
+		}
+		var s string
+		if err := resp.Unmarshal(stream(), &s); err != nil || s != "hello" {
+			t.Errorf("Unmarshal() into string = %q, %v", s, err)
+		}
+		var b []byte
+		if err := resp.Unmarshal(stream(), &b); err != nil || string(b) != "hello" {
+			t.Errorf("Unmarshal() into []byte = %q, %v", b, err)
+		}
+		var i interface{}
+		if err := resp.Unmarshal(stream(), &i); err != nil || i != "hello" {
+			t.Errorf("Unmarshal() into interface{} = %#v, %v", i, err)
+		}
+		short := &resp.RESPBulkStream{Length: 5, Body: strings.NewReader("hel")}
+		if err := resp.Unmarshal(short, &s); err == nil {
+			t.Errorf("Unmarshal() of a short stream error = nil, want error")
+		}
+	})
+
+	t.Run("Struct round trip", func(t *testing.T) {
+		user := marshalUser{Name: "ann", Age: 30, Admin: true, Secret: "x", Balance: 2.25}
+		value, err := resp.Marshal(user)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		var got marshalUser
+		if err := resp.Unmarshal(value, &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		user.Secret = ""
+		if got != user {
+			t.Errorf("Unmarshal() = %+v, want %+v", got, user)
+		}
+	})
+
+	t.Run("Interface", func(t *testing.T) {
+		var got interface{}
+		value := &resp.RESPArray{Items: []resp.RESPValue{bulk("a"), &resp.RESPInteger{Value: 1}, &resp.RESPBulkString{}}}
+		if err := resp.Unmarshal(value, &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, []interface{}{"a", int64(1), nil}) {
+			t.Errorf("Unmarshal() = %#v", got)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		var i int
+		var typeErr *resp.UnmarshalTypeError
+		if err := resp.Unmarshal(bulk("abc"), &i); !errors.As(err, &typeErr) {
+			t.Errorf("Unmarshal() error = %v, want UnmarshalTypeError", err)
+		}
+		var s string
+		if err := resp.Unmarshal(&resp.RESPArray{Items: []resp.RESPValue{bulk("a")}}, &s); !errors.As(err, &typeErr) {
+			t.Errorf("Unmarshal() of an array into string error = %v, want UnmarshalTypeError", err)
+		}
+		if err := resp.Unmarshal(&resp.RESPError{Value: "ERR boom"}, &i); err == nil || err.Error() != "ERR boom" {
+			t.Errorf("Unmarshal() error = %v, want ERR boom", err)
+		}
+		if err := resp.Unmarshal(bulk("1"), i); err == nil {
+			t.Errorf("Unmarshal() into non-pointer error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package resp_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+func TestReaderReadValue(t *testing.T) {
+	var input []byte
+	var expected []resp.RESPValue
+	for _, tt := range TestCases {
+		if tt.WantsMoreData || tt.WantsErr {
+			continue
+		}
+		input = append(input, tt.Input...)
+		expected = append(expected, tt.Expected)
+	}
+
+	readers := map[string]func() io.Reader{
+		"Whole":   func() io.Reader { return bytes.NewReader(input) },
+		"OneByte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(input)) },
+		"DataErr": func() io.Reader { return iotest.DataErrReader(bytes.NewReader(input)) },
+	}
+
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			r := resp.NewReader(newReader())
+			for i, want := range expected {
+				got, err := r.ReadValue()
+				if err != nil {
+					t.Fatalf("ReadValue() %d error = %v", i, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("ReadValue() %d = %v, want %v", i, got, want)
+				}
+			}
+			if _, err := r.ReadValue(); err != io.EOF {
+				t.Errorf("ReadValue() at end error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderUnexpectedEOF(t *testing.T) {
+	r := resp.NewReader(bytes.NewReader([]byte("+OK\r\n$5\r\nhel")))
+	if _, err := r.ReadValue(); err != nil {
+		t.Fatalf("ReadValue() error = %v", err)
+	}
+	if _, err := r.ReadValue(); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadValue() error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReaderProtocolError(t *testing.T) {
+	r := resp.NewReader(bytes.NewReader([]byte("%bad\r\n")))
+	if _, err := r.ReadValue(); err == nil {
+		t.Errorf("ReadValue() error = nil, want error")
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := resp.NewWriter(out)
+
+	if err := w.WriteValue(&resp.RESPSimpleString{Value: "OK"}); err != nil {
+		t.Fatalf("WriteValue() error = %v", err)
+	}
+	if err := w.WriteValue(&resp.RESPInteger{Value: 42}); err != nil {
+		t.Fatalf("WriteValue() error = %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("underlying writer received %q before Flush", out.Bytes())
+	}
+	if got := w.Buffered(); got != len("+OK\r\n:42\r\n") {
+		t.Errorf("Buffered() = %d, want %d", got, len("+OK\r\n:42\r\n"))
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got, want := out.String(), "+OK\r\n:42\r\n"; got != want {
+		t.Errorf("Flush() wrote %q, want %q", got, want)
+	}
+}
+
+func TestReaderWriterOverConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	value := &resp.RESPArray{Items: []resp.RESPValue{
+		&resp.RESPBulkString{Value: []byte("message")},
+		&resp.RESPBulkString{Value: []byte("chan")},
+		&resp.RESPBulkString{Value: []byte("payload")},
+	}}
+
+	errs := make(chan error, 1)
+	go func() {
+		w := resp.NewWriter(client)
+		if err := w.WriteValue(value); err != nil {
+			errs <- err
+			return
+		}
+		errs <- w.Flush()
+	}()
+
+	got, err := resp.NewReader(server).ReadValue()
+	if err != nil {
+		t.Fatalf("ReadValue() error = %v", err)
+	}
+	if !got.Equal(value) {
+		t.Errorf("ReadValue() = %v, want %v", got, value)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("Writer error = %v", err)
+	}
+}
+
+func TestAppendRESP(t *testing.T) {
+	for _, tt := range TestCases {
+		if tt.WantsMoreData || tt.WantsErr {
+			continue
+		}
+
+		t.Run(tt.Name, func(t *testing.T) {
+			prefix := []byte("prefix")
+			got, err := tt.Expected.AppendRESP(prefix)
+			if err != nil {
+				t.Fatalf("AppendRESP() error = %v", err)
+			}
+			if want := append([]byte("prefix"), tt.Input...); !bytes.Equal(got, want) {
+				t.Errorf("AppendRESP() = %q, want %q", got, want)
+			}
+		})
+	}
+}
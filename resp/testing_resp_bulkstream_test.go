@@ -0,0 +1,249 @@
+package resp_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+func TestRESPBulkStream(t *testing.T) {
+	t.Run("Encode", func(t *testing.T) {
+		stream := &resp.RESPBulkStream{Length: 5, Body: strings.NewReader("hello")}
+		buf := &bytes.Buffer{}
+		if err := stream.Encode(buf); err != nil {
+			t.Fatalf("RESPBulkStream.Encode() error = %v", err)
+		}
+		if got, want := buf.String(), "$5\r\nhello\r\n"; got != want {
+			t.Errorf("RESPBulkStream.Encode() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Encode short body", func(t *testing.T) {
+		stream := &resp.RESPBulkStream{Length: 10, Body: strings.NewReader("hello")}
+		if err := stream.Encode(&bytes.Buffer{}); err != io.ErrUnexpectedEOF {
+			t.Errorf("RESPBulkStream.Encode() error = %v, want io.ErrUnexpectedEOF", err)
+		}
+	})
+
+	t.Run("AppendRESP", func(t *testing.T) {
+		stream := &resp.RESPBulkStream{Length: 5, Body: strings.NewReader("hello")}
+		got, err := stream.AppendRESP(nil)
+		if want := "$5\r\nhello\r\n"; err != nil || string(got) != want {
+			t.Errorf("RESPBulkStream.AppendRESP() = %q, %v, want %q", got, err, want)
+		}
+	})
+
+	t.Run("AppendRESP short body", func(t *testing.T) {
+		stream := &resp.RESPBulkStream{Length: 5, Body: strings.NewReader("hel")}
+		got, err := stream.AppendRESP([]byte("+OK\r\n"))
+		if err != io.ErrUnexpectedEOF || string(got) != "+OK\r\n" {
+			t.Errorf("RESPBulkStream.AppendRESP() = %q, %v, want the original slice and io.ErrUnexpectedEOF", got, err)
+		}
+
+		array := &resp.RESPArray{Items: []resp.RESPValue{&resp.RESPBulkStream{Length: 5, Body: strings.NewReader("")}}}
+		got, err = array.AppendRESP([]byte("+OK\r\n"))
+		if err != io.ErrUnexpectedEOF || string(got) != "+OK\r\n" {
+			t.Errorf("RESPArray.AppendRESP() = %q, %v, want the original slice and io.ErrUnexpectedEOF", got, err)
+		}
+	})
+}
+
+func TestReaderStreamThreshold(t *testing.T) {
+	payload := strings.Repeat("x", 100000)
+	input := "+OK\r\n" +
+		"*3\r\n$7\r\nmessage\r\n$4\r\nchan\r\n$100000\r\n" + payload + "\r\n" +
+		"$5\r\nsmall\r\n" +
+		"$100000\r\n" + payload + "\r\n" +
+		":1\r\n"
+
+	sources := map[string]func() io.Reader{
+		"Whole":   func() io.Reader { return strings.NewReader(input) },
+		"OneByte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(input)) },
+		"Half":    func() io.Reader { return iotest.HalfReader(strings.NewReader(input)) },
+	}
+
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			r := resp.NewReader(source())
+			r.SetStreamThreshold(1024)
+
+			value, err := r.ReadValue()
+			if err != nil || !value.Equal(&resp.RESPSimpleString{Value: "OK"}) {
+				t.Fatalf("ReadValue() = %v, %v; want OK", value, err)
+			}
+
+			value, err = r.ReadValue()
+			if err != nil {
+				t.Fatalf("ReadValue() error = %v", err)
+			}
+			array, ok := value.(*resp.RESPArray)
+			if !ok || len(array.Items) != 3 {
+				t.Fatalf("ReadValue() = %v, want 3 item array", value)
+			}
+			if !array.Items[1].Equal(&resp.RESPBulkString{Value: []byte("chan")}) {
+				t.Errorf("channel = %v, want chan", array.Items[1])
+			}
+			stream, ok := array.Items[2].(*resp.RESPBulkStream)
+			if !ok || stream.Length != len(payload) {
+				t.Fatalf("payload = %v, want RESPBulkStream of %d bytes", array.Items[2], len(payload))
+			}
+			body, err := io.ReadAll(stream.Body)
+			if err != nil || string(body) != payload {
+				t.Fatalf("stream body = %d bytes, %v; want %d bytes", len(body), err, len(payload))
+			}
+
+			value, err = r.ReadValue()
+			if err != nil || !reflect.DeepEqual(value, &resp.RESPBulkString{Value: []byte("small")}) {
+				t.Fatalf("ReadValue() = %v, %v; want small", value, err)
+			}
+
+			// left unread, must be discarded by the next ReadValue
+			value, err = r.ReadValue()
+			if _, ok := value.(*resp.RESPBulkStream); err != nil || !ok {
+				t.Fatalf("ReadValue() = %v, %v; want RESPBulkStream", value, err)
+			}
+
+			value, err = r.ReadValue()
+			if err != nil || !value.Equal(&resp.RESPInteger{Value: 1}) {
+				t.Fatalf("ReadValue() = %v, %v; want 1", value, err)
+			}
+
+			if _, err := r.ReadValue(); err != io.EOF {
+				t.Errorf("ReadValue() error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderStreamTruncated(t *testing.T) {
+	r := resp.NewReader(strings.NewReader("$2048\r\nabc"))
+	r.SetStreamThreshold(1024)
+
+	value, err := r.ReadValue()
+	if err != nil {
+		t.Fatalf("ReadValue() error = %v", err)
+	}
+	if _, err := io.ReadAll(value.(*resp.RESPBulkStream).Body); err != io.ErrUnexpectedEOF {
+		t.Errorf("stream body error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestWriterBulkStream(t *testing.T) {
+	payload := strings.Repeat("y", 50000)
+	out := &bytes.Buffer{}
+	w := resp.NewWriter(out)
+
+	command := &resp.RESPArray{Items: []resp.RESPValue{
+		&resp.RESPBulkString{Value: []byte("PUBLISH")},
+		&resp.RESPBulkString{Value: []byte("chan")},
+		&resp.RESPBulkStream{Length: len(payload), Body: strings.NewReader(payload)},
+	}}
+	if err := w.WriteValue(command); err != nil {
+		t.Fatalf("WriteValue() error = %v", err)
+	}
+	if err := w.WriteBulkStream(3, strings.NewReader("abc")); err != nil {
+		t.Fatalf("WriteBulkStream() error = %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	want := "*3\r\n$7\r\nPUBLISH\r\n$4\r\nchan\r\n$50000\r\n" + payload + "\r\n$3\r\nabc\r\n"
+	if out.String() != want {
+		t.Errorf("Writer output mismatch, got %d bytes want %d", out.Len(), len(want))
+	}
+}
+
+func TestDecodeStreamThreshold(t *testing.T) {
+	payload := strings.Repeat("y", 50000)
+	input := "*3\r\n$7\r\nmessage\r\n$4\r\nchan\r\n$50000\r\n" + payload + "\r\n" + ":7\r\n"
+
+	d := resp.NewDecode()
+	d.SetStreamThreshold(1024)
+
+	// Provide and Parse run on their own goroutine like a connection's, Provide waits for the
+	// body to be read here
+	values := make(chan resp.RESPValue, 2)
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; i < len(input); i += 4096 {
+			end := i + 4096
+			if end > len(input) {
+				end = len(input)
+			}
+			d.Provide([]byte(input[i:end]))
+			for {
+				value, err := d.Parse()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if value == nil {
+					break
+				}
+				values <- value
+			}
+		}
+	}()
+
+	var value resp.RESPValue
+	select {
+	case value = <-values:
+	case err := <-errs:
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	items, err := value.AsArray()
+	if err != nil || len(items) != 3 {
+		t.Fatalf("Parse() = %v, want a message array", value)
+	}
+	stream, ok := items[2].(*resp.RESPBulkStream)
+	if !ok || stream.Length != len(payload) {
+		t.Fatalf("Parse() payload = %v, want a 50000 byte stream", items[2])
+	}
+
+	body, err := io.ReadAll(stream.Body)
+	if err != nil || string(body) != payload {
+		t.Fatalf("ReadAll(Body) = %d bytes, %v, want the payload", len(body), err)
+	}
+
+	select {
+	case value = <-values:
+		if !value.Equal(&resp.RESPInteger{Value: 7}) {
+			t.Errorf("Parse() after the stream = %v, want 7", value)
+		}
+	case err := <-errs:
+		t.Fatalf("Parse() error = %v", err)
+	}
+}
+
+func TestDecodeStreamClose(t *testing.T) {
+	d := resp.NewDecode()
+	d.SetStreamThreshold(4)
+	d.Provide([]byte("$10\r\nab"))
+
+	value, err := d.Parse()
+	stream, ok := value.(*resp.RESPBulkStream)
+	if err != nil || !ok {
+		t.Fatalf("Parse() = %v, %v, want a stream", value, err)
+	}
+
+	// a closed body is skipped without a reader
+	stream.Body.(io.Closer).Close()
+	d.Provide([]byte("cdefghij\r\n+OK\r\n"))
+	if value, err := d.Parse(); err != nil || !value.Equal(&resp.RESPSimpleString{Value: "OK"}) {
+		t.Errorf("Parse() after Close = %v, %v, want OK", value, err)
+	}
+
+	d.Provide([]byte("$10\r\nab"))
+	value, _ = d.Parse()
+	d.Reset()
+	if _, err := io.ReadAll(value.(*resp.RESPBulkStream).Body); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadAll(Body) after Reset error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
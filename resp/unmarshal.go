@@ -0,0 +1,276 @@
+package resp
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalTypeError describes a RESP value that can't be stored in a Go type
+type UnmarshalTypeError struct {
+	Value string
+	Type  reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "resp: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+}
+
+var errUnmarshalTarget = errors.New("resp: Unmarshal target must be a non-nil pointer")
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Unmarshal stores a RESP value in the Go value pointed to by dst, the inverse of Marshal.
+//
+// Strings, []byte, numbers and bools are parsed from simple strings, bulk strings and integers.
+// Arrays fill slices and arrays, flat arrays of alternating names and values fill maps and
+// structs. A nil bulk string or nil array stores the zero value, so pointers, slices and maps
+// become nil. Decoded into an interface{}, strings become string, integers int64 and arrays
+// []interface{}. A RESPError is returned as an error
+func Unmarshal(value RESPValue, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errUnmarshalTarget
+	}
+	return unmarshalValue(value, v.Elem())
+}
+
+func isNilValue(value RESPValue) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case *RESPBulkString:
+		return v.Value == nil
+	case *RESPArray:
+		return v.Items == nil
+	}
+	return false
+}
+
+// unmarshalRESPValue stores the value itself in a RESPValue, a pointer to one of the RESP types
+// or one of the RESP types
+func unmarshalRESPValue(value RESPValue, v reflect.Value) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.Type().AssignableTo(v.Type()):
+		v.Set(rv)
+	case rv.Kind() == reflect.Ptr && rv.Type().Elem() == v.Type():
+		v.Set(rv.Elem())
+	default:
+		return &UnmarshalTypeError{Value: value.Type(), Type: v.Type()}
+	}
+	return nil
+}
+
+func unmarshalValue(value RESPValue, v reflect.Value) error {
+	if e, ok := value.(*RESPError); ok {
+		return e
+	}
+
+	if v.Type().Implements(respValueType) || reflect.PtrTo(v.Type()).Implements(respValueType) {
+		return unmarshalRESPValue(value, v)
+	}
+
+	if isNilValue(value) {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalValue(value, v.Elem())
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		text, err := scalarText(value, v.Type())
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(text)
+	}
+
+	if array, ok := value.(*RESPArray); ok {
+		return unmarshalArray(array, v)
+	}
+
+	text, err := scalarText(value, v.Type())
+	if err != nil {
+		return err
+	}
+	typeError := &UnmarshalTypeError{Value: value.Type(), Type: v.Type()}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return typeError
+		}
+		if i, ok := value.(*RESPInteger); ok {
+			v.Set(reflect.ValueOf(i.Value))
+		} else {
+			v.Set(reflect.ValueOf(string(text)))
+		}
+	case reflect.String:
+		v.SetString(string(text))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return typeError
+		}
+		v.SetBytes(append([]byte{}, text...))
+	case reflect.Bool:
+		if i, ok := value.(*RESPInteger); ok {
+			v.SetBool(i.Value != 0)
+			return nil
+		}
+		b, err := strconv.ParseBool(string(text))
+		if err != nil {
+			return typeError
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(text), 10, v.Type().Bits())
+		if err != nil {
+			return typeError
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(string(text), 10, v.Type().Bits())
+		if err != nil {
+			return typeError
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(text), v.Type().Bits())
+		if err != nil {
+			return typeError
+		}
+		v.SetFloat(f)
+	default:
+		return typeError
+	}
+
+	return nil
+}
+
+// scalarText is scalarBytes reading the body of a stream, any other value is a type error
+func scalarText(value RESPValue, t reflect.Type) ([]byte, error) {
+	if stream, ok := value.(*RESPBulkStream); ok {
+		return stream.AsBytes()
+	}
+	text, ok := scalarBytes(value)
+	if !ok {
+		return nil, &UnmarshalTypeError{Value: value.Type(), Type: t}
+	}
+	return text, nil
+}
+
+// scalarBytes returns the text of a simple string, bulk string or integer
+func scalarBytes(value RESPValue) ([]byte, bool) {
+	switch v := value.(type) {
+	case *RESPSimpleString:
+		return []byte(v.Value), true
+	case *RESPBulkString:
+		return v.Value, true
+	case *RESPInteger:
+		return strconv.AppendInt(nil, v.Value, 10), true
+	}
+	return nil, false
+}
+
+func unmarshalArray(array *RESPArray, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		items := make([]interface{}, len(array.Items))
+		for i, item := range array.Items {
+			if err := unmarshalValue(item, reflect.ValueOf(&items[i]).Elem()); err != nil {
+				return err
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(array.Items), len(array.Items))
+		for i, item := range array.Items {
+			if err := unmarshalValue(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		if v.Len() != len(array.Items) {
+			break
+		}
+		for i, item := range array.Items {
+			if err := unmarshalValue(item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if len(array.Items)%2 != 0 {
+			break
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(array.Items)/2)
+		for i := 0; i < len(array.Items); i += 2 {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := unmarshalValue(array.Items[i], key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := unmarshalValue(array.Items[i+1], value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		if len(array.Items)%2 != 0 {
+			break
+		}
+		return unmarshalStruct(array, v)
+	}
+
+	return &UnmarshalTypeError{Value: array.Type(), Type: v.Type()}
+}
+
+func unmarshalStruct(array *RESPArray, v reflect.Value) error {
+	fields := structFields(v.Type())
+	for i := 0; i < len(array.Items); i += 2 {
+		name, ok := scalarBytes(array.Items[i])
+		if !ok {
+			return &UnmarshalTypeError{Value: array.Items[i].Type(), Type: reflect.TypeOf("")}
+		}
+
+		index := -1
+		for _, f := range fields {
+			if f.name == string(name) {
+				index = f.index
+				break
+			}
+			if index == -1 && strings.EqualFold(f.name, string(name)) {
+				index = f.index
+			}
+		}
+		if index == -1 {
+			continue
+		}
+
+		if err := unmarshalValue(array.Items[i+1], v.Field(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
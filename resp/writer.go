@@ -0,0 +1,82 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// Writer buffers encoded RESP values in front of an io.Writer such as a net.Conn, file or pipe.
+// Nothing reaches the underlying writer until the buffer fills or Flush is called
+type Writer struct {
+	wr      *bufio.Writer
+	scratch []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		wr: bufio.NewWriterSize(w, defaultReadSize),
+	}
+}
+
+// WriteValue encodes v into the write buffer. RESPBulkStream bodies, including ones nested
+// in arrays, are copied through without being held in memory
+func (w *Writer) WriteValue(v RESPValue) error {
+	switch value := v.(type) {
+	case *RESPBulkStream:
+		return value.Encode(w.wr)
+	case *RESPArray:
+		if !containsStream(value) {
+			break
+		}
+		w.scratch = append(w.scratch[:0], byte(ARRAY))
+		w.scratch = strconv.AppendInt(w.scratch, int64(len(value.Items)), 10)
+		w.scratch = append(w.scratch, PROTOCOL_SEPARATOR...)
+		if _, err := w.wr.Write(w.scratch); err != nil {
+			return err
+		}
+		for _, item := range value.Items {
+			if err := w.WriteValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	scratch, err := v.AppendRESP(w.scratch[:0])
+	if err != nil {
+		return err
+	}
+	w.scratch = scratch
+	_, err = w.wr.Write(w.scratch)
+	return err
+}
+
+// WriteBulkStream writes a bulk string of length bytes copied from body
+func (w *Writer) WriteBulkStream(length int, body io.Reader) error {
+	return w.WriteValue(&RESPBulkStream{Length: length, Body: body})
+}
+
+// Flush writes any buffered values to the underlying writer
+func (w *Writer) Flush() error {
+	return w.wr.Flush()
+}
+
+// Buffered returns the number of bytes waiting to be flushed
+func (w *Writer) Buffered() int {
+	return w.wr.Buffered()
+}
+
+func containsStream(a *RESPArray) bool {
+	for _, item := range a.Items {
+		switch value := item.(type) {
+		case *RESPBulkStream:
+			return true
+		case *RESPArray:
+			if containsStream(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
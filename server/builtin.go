@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+func handlePing(c *Conn, cmd Command) {
+	if len(cmd.Args) > 1 {
+		c.WriteWrongArgs(cmd)
+		return
+	}
+
+	// a subscribed RESP2 connection answers PING with a pubsub shaped reply
+	if c.SubscriptionCount() > 0 {
+		c.WriteArray(&resp.RESPBulkString{Value: []byte("pong")}, &resp.RESPBulkString{Value: []byte(cmd.Arg(0))})
+		return
+	}
+
+	if len(cmd.Args) == 1 {
+		c.WriteBulk(cmd.Args[0])
+		return
+	}
+	c.WriteSimpleString("PONG")
+}
+
+func handleEcho(c *Conn, cmd Command) {
+	c.WriteBulk(cmd.Args[0])
+}
+
+func handleQuit(c *Conn, cmd Command) {
+	c.WriteOK()
+	c.Close()
+}
+
+func (s *Server) handleSelect(c *Conn, cmd Command) {
+	db, err := strconv.Atoi(cmd.Arg(0))
+	if err != nil {
+		c.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	s.mutex.Lock()
+	databases := s.databases
+	s.mutex.Unlock()
+
+	if db < 0 || db >= databases {
+		c.WriteError("ERR DB index is out of range")
+		return
+	}
+
+	c.SetDB(db)
+	c.WriteOK()
+}
+
+func (s *Server) handleAuth(c *Conn, cmd Command) {
+	var username, password string
+	switch len(cmd.Args) {
+	case 1:
+		username, password = "default", cmd.Arg(0)
+	case 2:
+		username, password = cmd.Arg(0), cmd.Arg(1)
+	default:
+		c.WriteWrongArgs(cmd)
+		return
+	}
+
+	s.mutex.Lock()
+	expected := s.password
+	s.mutex.Unlock()
+
+	if expected == "" {
+		c.WriteError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+
+	if username != "default" || password != expected {
+		c.SetAuthenticated(false)
+		c.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+
+	c.SetAuthenticated(true)
+	c.WriteOK()
+}
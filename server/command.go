@@ -0,0 +1,41 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// Command is a decoded request, Name is upper cased and Args holds the arguments after it
+type Command struct {
+	Name string
+	Args [][]byte
+	raw  string
+}
+
+// Arg returns argument i as a string, or "" when there is no such argument
+func (c Command) Arg(i int) string {
+	if i < 0 || i >= len(c.Args) {
+		return ""
+	}
+	return string(c.Args[i])
+}
+
+// parseCommand converts a request array of bulk strings into a Command
+func parseCommand(value resp.RESPValue) (Command, bool) {
+	items, err := value.AsArray()
+	if err != nil || len(items) == 0 {
+		return Command{}, false
+	}
+
+	args := make([][]byte, len(items))
+	for i, item := range items {
+		bulk, ok := item.(*resp.RESPBulkString)
+		if !ok || bulk.Value == nil {
+			return Command{}, false
+		}
+		args[i] = bulk.Value
+	}
+
+	return Command{Name: strings.ToUpper(string(args[0])), Args: args[1:], raw: string(args[0])}, true
+}
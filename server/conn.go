@@ -0,0 +1,289 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// Conn is the server side of a client connection. Write methods buffer the reply, the
+// buffer is flushed once every pipelined request that has arrived so far is handled.
+// Writes are safe from other goroutines, use Push to deliver out of band messages
+type Conn struct {
+	server        *Server
+	conn          net.Conn
+	reader        *resp.Reader
+	writer        *resp.Writer
+	mutex         sync.Mutex
+	writeErr      error
+	closing       bool
+	db            int
+	authenticated bool
+	name          string
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	values        map[string]interface{}
+	tx            *transaction
+	watchFailed   bool
+	captured      []resp.RESPValue
+}
+
+func newConn(s *Server, c net.Conn) *Conn {
+	reader := resp.NewReader(c)
+	reader.AcceptInline(true)
+
+	return &Conn{
+		server:   s,
+		conn:     c,
+		reader:   reader,
+		writer:   resp.NewWriter(c),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		values:   make(map[string]interface{}),
+	}
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the connection after the pending replies have been flushed
+func (c *Conn) Close() {
+	c.mutex.Lock()
+	c.closing = true
+	c.mutex.Unlock()
+}
+
+func (c *Conn) WriteValue(v resp.RESPValue) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// replies of commands run by EXEC become elements of its array
+	if c.captured != nil {
+		c.captured = append(c.captured, v)
+		return nil
+	}
+	return c.writeLocked(v)
+}
+
+func (c *Conn) writeLocked(v resp.RESPValue) error {
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	c.writeErr = c.writer.WriteValue(v)
+	return c.writeErr
+}
+
+func (c *Conn) WriteOK() error {
+	return c.WriteSimpleString("OK")
+}
+
+func (c *Conn) WriteSimpleString(s string) error {
+	return c.WriteValue(&resp.RESPSimpleString{Value: s})
+}
+
+// WriteError writes an error reply, msg should start with an error code such as ERR
+func (c *Conn) WriteError(msg string) error {
+	return c.WriteValue(&resp.RESPError{Value: msg})
+}
+
+func (c *Conn) WriteInteger(n int64) error {
+	return c.WriteValue(&resp.RESPInteger{Value: n})
+}
+
+func (c *Conn) WriteBulk(b []byte) error {
+	if b == nil {
+		b = []byte{}
+	}
+	return c.WriteValue(&resp.RESPBulkString{Value: b})
+}
+
+func (c *Conn) WriteBulkString(s string) error {
+	return c.WriteValue(&resp.RESPBulkString{Value: []byte(s)})
+}
+
+// WriteWrongArgs writes the error Redis returns for a wrong number of arguments
+func (c *Conn) WriteWrongArgs(cmd Command) error {
+	return c.WriteError("ERR wrong number of arguments for '" + strings.ToLower(cmd.Name) + "' command")
+}
+
+// WriteNull writes a nil bulk string
+func (c *Conn) WriteNull() error {
+	return c.WriteValue(&resp.RESPBulkString{})
+}
+
+// WriteArray writes an array of the given values, nil values are written as nil bulk strings
+func (c *Conn) WriteArray(items ...resp.RESPValue) error {
+	array := &resp.RESPArray{Items: make([]resp.RESPValue, len(items))}
+	for i, item := range items {
+		if item == nil {
+			item = &resp.RESPBulkString{}
+		}
+		array.Items[i] = item
+	}
+	return c.WriteValue(array)
+}
+
+// Push writes and immediately flushes a value, for messages that don't answer a request
+// such as pubsub deliveries from another goroutine
+func (c *Conn) Push(v resp.RESPValue) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.writeLocked(v); err != nil {
+		return err
+	}
+	return c.flushLocked()
+}
+
+func (c *Conn) flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.flushLocked()
+}
+
+func (c *Conn) flushLocked() error {
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	c.writeErr = c.writer.Flush()
+	return c.writeErr
+}
+
+func (c *Conn) isClosing() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.closing
+}
+
+// DB returns the database selected with SELECT
+func (c *Conn) DB() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.db
+}
+
+func (c *Conn) SetDB(db int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.db = db
+}
+
+// Authenticated reports whether the connection passed AUTH
+func (c *Conn) Authenticated() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.authenticated
+}
+
+func (c *Conn) SetAuthenticated(authenticated bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.authenticated = authenticated
+}
+
+// Name returns the name set with CLIENT SETNAME
+func (c *Conn) Name() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.name
+}
+
+func (c *Conn) SetName(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.name = name
+}
+
+// Get returns per connection state stored by handlers with Set
+func (c *Conn) Get(key string) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.values[key]
+}
+
+func (c *Conn) Set(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.values[key] = value
+}
+
+// Subscribe records a channel subscription and returns the connection's subscription count,
+// the number the SUBSCRIBE ack carries
+func (c *Conn) Subscribe(channel string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.channels[channel] = struct{}{}
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *Conn) Unsubscribe(channel string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.channels, channel)
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *Conn) PSubscribe(pattern string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.patterns[pattern] = struct{}{}
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *Conn) PUnsubscribe(pattern string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.patterns, pattern)
+	return len(c.channels) + len(c.patterns)
+}
+
+// Channels returns the subscribed channels in sorted order
+func (c *Conn) Channels() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return sortedKeys(c.channels)
+}
+
+// Patterns returns the subscribed patterns in sorted order
+func (c *Conn) Patterns() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return sortedKeys(c.patterns)
+}
+
+// SubscriptionCount returns the number of channels and patterns the connection is subscribed to
+func (c *Conn) SubscriptionCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.channels) + len(c.patterns)
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
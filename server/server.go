@@ -0,0 +1,370 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/logging"
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown or Close
+var ErrServerClosed = errors.New("server closed")
+
+const defaultDatabases = 16
+
+// HandlerFunc answers a command by writing to the connection
+type HandlerFunc func(c *Conn, cmd Command)
+
+// subscribeContext lists the commands RESP2 allows while a connection has subscriptions
+var subscribeContext = map[string]bool{
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"SSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"SUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+	"RESET":        true,
+}
+
+// Server serves RESP over TCP or unix sockets with a goroutine per connection. Commands are
+// routed by name to handlers registered with Handle, PING, ECHO, QUIT, SELECT, AUTH, MULTI,
+// EXEC and DISCARD are registered by default and can be replaced. Between MULTI and EXEC
+// other commands are queued and answered with QUEUED, a command that can't be queued makes
+// EXEC fail with EXECABORT
+type Server struct {
+	logger    *logging.Logger
+	mutex     sync.Mutex
+	handlers  map[string]HandlerFunc
+	arities   map[string]int
+	listeners map[net.Listener]struct{}
+	conns     map[*Conn]struct{}
+	onClose   []func(*Conn)
+	onCommand []func(*Conn, Command)
+	password  string
+	databases int
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewServer() *Server {
+	s := &Server{
+		logger:    logging.NewLogger(logging.LogLevelInfo),
+		handlers:  make(map[string]HandlerFunc),
+		arities:   make(map[string]int),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*Conn]struct{}),
+		databases: defaultDatabases,
+	}
+
+	s.HandleArity("PING", -1, handlePing)
+	s.HandleArity("ECHO", 2, handleEcho)
+	s.HandleArity("QUIT", -1, handleQuit)
+	s.HandleArity("SELECT", 2, s.handleSelect)
+	s.HandleArity("AUTH", -2, s.handleAuth)
+	s.HandleArity("MULTI", 1, handleMulti)
+	s.HandleArity("EXEC", 1, s.handleExec)
+	s.HandleArity("DISCARD", 1, handleDiscard)
+	s.HandleArity("UNWATCH", 1, handleUnwatch)
+
+	return s
+}
+
+// Handle registers fn for the command name, matching is case insensitive. fn checks its own
+// arguments, inside a transaction a wrong count only fails when EXEC runs it
+func (s *Server) Handle(name string, fn HandlerFunc) {
+	s.HandleArity(name, 0, fn)
+}
+
+// HandleArity registers fn like Handle with the argument count checked before fn runs, and
+// before the command is queued inside a transaction. Arity counts the command name the way
+// Redis does, n means exactly n and -n at least n. 0 skips the check
+func (s *Server) HandleArity(name string, arity int, fn HandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name = strings.ToUpper(name)
+	s.handlers[name] = fn
+	s.arities[name] = arity
+}
+
+// validArity reports whether cmd has the argument count arity asks for
+func validArity(arity int, cmd Command) bool {
+	n := len(cmd.Args) + 1
+	switch {
+	case arity > 0:
+		return n == arity
+	case arity < 0:
+		return n >= -arity
+	}
+	return true
+}
+
+// OnClose registers fn to run when a connection ends, to release its subscriptions
+func (s *Server) OnClose(fn func(*Conn)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.onClose = append(s.onClose, fn)
+}
+
+// OnCommand registers fn to run on the connection goroutine before each command is dispatched
+func (s *Server) OnCommand(fn func(*Conn, Command)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.onCommand = append(s.onCommand, fn)
+}
+
+// SetPassword requires AUTH before any other command, an empty password disables it
+func (s *Server) SetPassword(password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.password = password
+}
+
+// SetDatabases sets the number of databases SELECT accepts, 16 by default
+func (s *Server) SetDatabases(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.databases = n
+}
+
+// ListenAndServe listens on a "tcp" or "unix" address and serves it until Shutdown
+func (s *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Shutdown or Close, l is closed on return
+func (s *Server) Serve(l net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.listeners, l)
+		s.mutex.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		c := newConn(s, conn)
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+
+		go s.serveConn(c)
+	}
+}
+
+// Shutdown stops accepting connections and interrupts idle reads. Requests already received
+// are answered before each connection closes. If ctx expires first the remaining
+// connections are closed and ctx.Err() is returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.conn.SetReadDeadline(time.Now())
+	}
+	s.mutex.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		s.closeConns()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// Close stops the server immediately, closing every listener and connection
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	s.mutex.Unlock()
+
+	s.closeConns()
+	s.wg.Wait()
+	return nil
+}
+
+// Conns returns the currently open connections
+func (s *Server) Conns() []*Conn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *Server) closeConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.conns {
+		c.conn.Close()
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+func (s *Server) serveConn(c *Conn) {
+	defer s.wg.Done()
+	defer func() {
+		c.conn.Close()
+
+		s.mutex.Lock()
+		delete(s.conns, c)
+		onClose := s.onClose
+		s.mutex.Unlock()
+
+		for _, fn := range onClose {
+			fn(c)
+		}
+	}()
+
+	for {
+		value, err := c.reader.ReadValue()
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case err == io.EOF, errors.Is(err, net.ErrClosed):
+			case errors.As(err, &netErr) && netErr.Timeout():
+				// read deadline set by Shutdown
+			default:
+				s.logger.Debug("Closing connection %s: %v", c.RemoteAddr(), err)
+				c.WriteError("ERR " + err.Error())
+				c.flush()
+			}
+			return
+		}
+
+		s.dispatch(c, value)
+
+		// flush once the pipelined requests already received are answered
+		if c.reader.Buffered() == 0 || c.isClosing() {
+			if err := c.flush(); err != nil {
+				return
+			}
+		}
+
+		if c.isClosing() {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(c *Conn, value resp.RESPValue) {
+	cmd, ok := parseCommand(value)
+	if !ok {
+		c.WriteError("ERR Protocol error: expected an array of bulk strings")
+		c.Close()
+		return
+	}
+
+	s.mutex.Lock()
+	fn, found := s.handlers[cmd.Name]
+	arity := s.arities[cmd.Name]
+	password := s.password
+	onCommand := s.onCommand
+	s.mutex.Unlock()
+
+	for _, hook := range onCommand {
+		hook(c, cmd)
+	}
+
+	if password != "" && !c.Authenticated() && cmd.Name != "AUTH" && cmd.Name != "QUIT" {
+		c.WriteError("NOAUTH Authentication required.")
+		return
+	}
+
+	if c.SubscriptionCount() > 0 && !subscribeContext[cmd.Name] {
+		c.WriteError(fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(cmd.Name)))
+		return
+	}
+
+	if !found {
+		var args strings.Builder
+		for _, arg := range cmd.Args {
+			fmt.Fprintf(&args, "'%s' ", arg)
+		}
+		c.WriteError(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", cmd.raw, args.String()))
+		c.abortTransaction()
+		return
+	}
+
+	if !validArity(arity, cmd) {
+		c.WriteWrongArgs(cmd)
+		c.abortTransaction()
+		return
+	}
+
+	if !transactionControl[cmd.Name] && c.InTransaction() {
+		c.queue(cmd)
+		c.WriteSimpleString("QUEUED")
+		return
+	}
+
+	fn(c, cmd)
+}
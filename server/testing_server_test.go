@@ -0,0 +1,394 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Moonlight-Companies/goresp/command"
+	"github.com/Moonlight-Companies/goresp/resp"
+	"github.com/Moonlight-Companies/goresp/server"
+)
+
+func startServer(t *testing.T, s *server.Server) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().String()
+}
+
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *resp.Reader
+}
+
+func dial(t *testing.T, network, addr string) *client {
+	t.Helper()
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{t: t, conn: conn, reader: resp.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	if _, err := c.conn.Write(command.FormatCommand(args...)); err != nil {
+		c.t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func (c *client) expect(want string) {
+	c.t.Helper()
+	value, err := c.reader.ReadValue()
+	if err != nil {
+		c.t.Fatalf("ReadValue() error = %v, want %q", err, want)
+	}
+	if got, _ := value.AppendRESP(nil); string(got) != want {
+		c.t.Fatalf("reply = %q, want %q", got, want)
+	}
+}
+
+func TestServerBuiltins(t *testing.T) {
+	addr := startServer(t, server.NewServer())
+	c := dial(t, "tcp", addr)
+
+	c.send("PING")
+	c.expect("+PONG\r\n")
+	c.send("ping", "hello")
+	c.expect("$5\r\nhello\r\n")
+	c.send("ECHO", "hi")
+	c.expect("$2\r\nhi\r\n")
+	c.send("ECHO")
+	c.expect("-ERR wrong number of arguments for 'echo' command\r\n")
+	c.send("SELECT", "3")
+	c.expect("+OK\r\n")
+	c.send("SELECT", "16")
+	c.expect("-ERR DB index is out of range\r\n")
+	c.send("FooBar", "a", "b")
+	c.expect("-ERR unknown command 'FooBar', with args beginning with: 'a' 'b' \r\n")
+	c.send("AUTH", "secret")
+	c.expect("-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?\r\n")
+	c.send("QUIT")
+	c.expect("+OK\r\n")
+	if _, err := c.reader.ReadValue(); err != io.EOF {
+		t.Errorf("ReadValue() after QUIT error = %v, want io.EOF", err)
+	}
+}
+
+func TestServerHandlerAndPipeline(t *testing.T) {
+	s := server.NewServer()
+	var mutex sync.Mutex
+	store := map[string][]byte{}
+	s.Handle("set", func(c *server.Conn, cmd server.Command) {
+		if len(cmd.Args) != 2 {
+			c.WriteWrongArgs(cmd)
+			return
+		}
+		mutex.Lock()
+		store[cmd.Arg(0)] = cmd.Args[1]
+		mutex.Unlock()
+		c.WriteOK()
+	})
+	s.Handle("GET", func(c *server.Conn, cmd server.Command) {
+		mutex.Lock()
+		value, ok := store[cmd.Arg(0)]
+		mutex.Unlock()
+		if !ok {
+			c.WriteNull()
+			return
+		}
+		c.WriteBulk(value)
+	})
+	s.Handle("DBINFO", func(c *server.Conn, cmd server.Command) {
+		c.WriteInteger(int64(c.DB()))
+	})
+
+	c := dial(t, "tcp", startServer(t, s))
+
+	var pipeline []byte
+	pipeline = append(pipeline, command.FormatCommand("SET", "k", "v")...)
+	pipeline = append(pipeline, command.FormatCommand("GET", "k")...)
+	pipeline = append(pipeline, command.FormatCommand("GET", "missing")...)
+	pipeline = append(pipeline, command.FormatCommand("SELECT", "2")...)
+	pipeline = append(pipeline, command.FormatCommand("DBINFO")...)
+	pipeline = append(pipeline, "PING inline\r\n"...)
+	if _, err := c.conn.Write(pipeline); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	c.expect("+OK\r\n")
+	c.expect("$1\r\nv\r\n")
+	c.expect("$-1\r\n")
+	c.expect("+OK\r\n")
+	c.expect(":2\r\n")
+	c.expect("$6\r\ninline\r\n")
+}
+
+func TestServerTransactions(t *testing.T) {
+	s := server.NewServer()
+	s.HandleArity("INCR", 2, func(c *server.Conn, cmd server.Command) {
+		n, _ := c.Get(cmd.Arg(0)).(int64)
+		n++
+		c.Set(cmd.Arg(0), n)
+		c.WriteInteger(n)
+	})
+	s.Handle("NOREPLY", func(c *server.Conn, cmd server.Command) {})
+	c := dial(t, "tcp", startServer(t, s))
+
+	c.send("EXEC")
+	c.expect("-ERR EXEC without MULTI\r\n")
+	c.send("DISCARD")
+	c.expect("-ERR DISCARD without MULTI\r\n")
+
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("MULTI")
+	c.expect("-ERR MULTI calls can not be nested\r\n")
+	c.send("INCR", "n")
+	c.expect("+QUEUED\r\n")
+	c.send("PING")
+	c.expect("+QUEUED\r\n")
+	c.send("NOREPLY")
+	c.expect("+QUEUED\r\n")
+	c.send("INCR", "n")
+	c.expect("+QUEUED\r\n")
+	c.send("EXEC")
+	c.expect("*4\r\n:1\r\n+PONG\r\n$-1\r\n:2\r\n")
+
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("INCR", "n")
+	c.expect("+QUEUED\r\n")
+	c.send("DISCARD")
+	c.expect("+OK\r\n")
+	c.send("INCR", "n")
+	c.expect(":3\r\n")
+
+	// an unknown command while queueing aborts the transaction
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("NOSUCH")
+	c.expect("-ERR unknown command 'NOSUCH', with args beginning with: \r\n")
+	c.send("INCR", "n")
+	c.expect("+QUEUED\r\n")
+	c.send("EXEC")
+	c.expect("-EXECABORT Transaction discarded because of previous errors.\r\n")
+	c.send("INCR", "n")
+	c.expect(":4\r\n")
+
+	// so does a wrong number of arguments, caught before the command is queued
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("INCR", "n")
+	c.expect("+QUEUED\r\n")
+	c.send("INCR")
+	c.expect("-ERR wrong number of arguments for 'incr' command\r\n")
+	c.send("ECHO", "a", "b")
+	c.expect("-ERR wrong number of arguments for 'echo' command\r\n")
+	c.send("EXEC")
+	c.expect("-EXECABORT Transaction discarded because of previous errors.\r\n")
+	c.send("INCR", "n")
+	c.expect(":5\r\n")
+
+	// outside of a transaction the arity is checked before the handler runs
+	c.send("INCR", "n", "m")
+	c.expect("-ERR wrong number of arguments for 'incr' command\r\n")
+	c.send("EXEC", "now")
+	c.expect("-ERR wrong number of arguments for 'exec' command\r\n")
+}
+
+func TestServerFailWatch(t *testing.T) {
+	s := server.NewServer()
+	var mutex sync.Mutex
+	var watcher *server.Conn
+	s.Handle("WATCH", func(c *server.Conn, cmd server.Command) {
+		mutex.Lock()
+		watcher = c
+		mutex.Unlock()
+		c.WriteOK()
+	})
+	s.Handle("TOUCH", func(c *server.Conn, cmd server.Command) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if watcher != nil {
+			watcher.FailWatch()
+		}
+		c.WriteInteger(1)
+	})
+	c := dial(t, "tcp", startServer(t, s))
+
+	c.send("WATCH", "k")
+	c.expect("+OK\r\n")
+	c.send("TOUCH", "k")
+	c.expect(":1\r\n")
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("PING")
+	c.expect("+QUEUED\r\n")
+	c.send("EXEC")
+	c.expect("*-1\r\n")
+
+	// EXEC cleared the failure
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("PING")
+	c.expect("+QUEUED\r\n")
+	c.send("EXEC")
+	c.expect("*1\r\n+PONG\r\n")
+
+	c.send("TOUCH", "k")
+	c.expect(":1\r\n")
+	c.send("UNWATCH")
+	c.expect("+OK\r\n")
+	c.send("MULTI")
+	c.expect("+OK\r\n")
+	c.send("EXEC")
+	c.expect("*0\r\n")
+}
+
+func TestServerAuth(t *testing.T) {
+	s := server.NewServer()
+	s.SetPassword("secret")
+	c := dial(t, "tcp", startServer(t, s))
+
+	c.send("PING")
+	c.expect("-NOAUTH Authentication required.\r\n")
+	c.send("AUTH", "wrong")
+	c.expect("-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+	c.send("AUTH", "default", "secret")
+	c.expect("+OK\r\n")
+	c.send("PING")
+	c.expect("+PONG\r\n")
+}
+
+func TestServerSubscribeContext(t *testing.T) {
+	s := server.NewServer()
+	s.Handle("SUBSCRIBE", func(c *server.Conn, cmd server.Command) {
+		for _, channel := range cmd.Args {
+			count := c.Subscribe(string(channel))
+			c.WriteArray(
+				&resp.RESPBulkString{Value: []byte("subscribe")},
+				&resp.RESPBulkString{Value: channel},
+				&resp.RESPInteger{Value: int64(count)},
+			)
+		}
+	})
+
+	closed := make(chan []string, 1)
+	s.OnClose(func(c *server.Conn) {
+		closed <- c.Channels()
+	})
+
+	c := dial(t, "tcp", startServer(t, s))
+	c.send("SUBSCRIBE", "a", "b")
+	c.expect("*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n")
+	c.expect("*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n")
+	c.send("ECHO", "x")
+	c.expect("-ERR Can't execute 'echo': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n")
+	c.send("PING")
+	c.expect("*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+
+	conns := s.Conns()
+	if len(conns) != 1 {
+		t.Fatalf("Conns() = %d connections, want 1", len(conns))
+	}
+	if err := conns[0].Push(&resp.RESPSimpleString{Value: "pushed"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	c.expect("+pushed\r\n")
+
+	c.conn.Close()
+	select {
+	case channels := <-closed:
+		if strings.Join(channels, ",") != "a,b" {
+			t.Errorf("OnClose channels = %v, want [a b]", channels)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnClose was not called")
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := server.NewServer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Handle("SLOW", func(c *server.Conn, cmd server.Command) {
+		close(started)
+		<-release
+		c.WriteOK()
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	idle := dial(t, "tcp", l.Addr().String())
+	busy := dial(t, "tcp", l.Addr().String())
+	idle.send("PING")
+	idle.expect("+PONG\r\n")
+	busy.send("SLOW")
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- s.Shutdown(ctx)
+	}()
+
+	if _, err := idle.reader.ReadValue(); err != io.EOF {
+		t.Errorf("idle connection ReadValue() error = %v, want io.EOF", err)
+	}
+
+	close(release)
+	busy.expect("+OK\r\n")
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-served; err != server.ErrServerClosed {
+		t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServerUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resp.sock")
+	s := server.NewServer()
+	go s.ListenAndServe("unix", path)
+	t.Cleanup(func() { s.Close() })
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Close()
+
+	c := dial(t, "unix", path)
+	c.send("PING")
+	c.expect("+PONG\r\n")
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"github.com/Moonlight-Companies/goresp/resp"
+)
+
+// transactionControl lists the commands that run instead of being queued after MULTI
+var transactionControl = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"QUIT":    true,
+	"RESET":   true,
+}
+
+// transaction is the state of a connection between MULTI and EXEC
+type transaction struct {
+	queued  []Command
+	aborted bool
+}
+
+// InTransaction reports whether MULTI was sent and the transaction is not executed yet
+func (c *Conn) InTransaction() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.tx != nil
+}
+
+func (c *Conn) queue(cmd Command) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.tx.queued = append(c.tx.queued, cmd)
+}
+
+// abortTransaction makes EXEC fail, after an error while queueing
+func (c *Conn) abortTransaction() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tx != nil {
+		c.tx.aborted = true
+	}
+}
+
+// FailWatch makes the connection's next EXEC reply with a nil array and run nothing, as
+// when a key it WATCHed changed. Handlers implementing WATCH call it on the watching
+// connections when a key changes. EXEC, DISCARD and UNWATCH clear it
+func (c *Conn) FailWatch() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.watchFailed = true
+}
+
+// clearWatch forgets a failed WATCH and reports whether there was one
+func (c *Conn) clearWatch() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	failed := c.watchFailed
+	c.watchFailed = false
+	return failed
+}
+
+// endTransaction returns the transaction and leaves transaction mode, nil outside of one
+func (c *Conn) endTransaction() *transaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	tx := c.tx
+	c.tx = nil
+	return tx
+}
+
+// capture runs fn with replies collected instead of written. Push is not captured
+func (c *Conn) capture(fn func()) []resp.RESPValue {
+	c.mutex.Lock()
+	c.captured = []resp.RESPValue{}
+	c.mutex.Unlock()
+
+	fn()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	captured := c.captured
+	c.captured = nil
+	return captured
+}
+
+func handleMulti(c *Conn, cmd Command) {
+	c.mutex.Lock()
+	nested := c.tx != nil
+	if !nested {
+		c.tx = &transaction{}
+	}
+	c.mutex.Unlock()
+
+	if nested {
+		c.WriteError("ERR MULTI calls can not be nested")
+		return
+	}
+	c.WriteOK()
+}
+
+func (s *Server) handleExec(c *Conn, cmd Command) {
+	tx := c.endTransaction()
+	if tx == nil {
+		c.WriteError("ERR EXEC without MULTI")
+		return
+	}
+	watchFailed := c.clearWatch()
+	switch {
+	case tx.aborted:
+		c.WriteError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	case watchFailed:
+		c.WriteValue(&resp.RESPArray{})
+		return
+	}
+
+	replies := make([]resp.RESPValue, 0, len(tx.queued))
+	for _, queued := range tx.queued {
+		s.mutex.Lock()
+		fn := s.handlers[queued.Name]
+		s.mutex.Unlock()
+
+		captured := c.capture(func() { fn(c, queued) })
+		if len(captured) == 0 {
+			captured = append(captured, &resp.RESPBulkString{})
+		}
+		replies = append(replies, captured...)
+	}
+	c.WriteValue(&resp.RESPArray{Items: replies})
+}
+
+func handleDiscard(c *Conn, cmd Command) {
+	if c.endTransaction() == nil {
+		c.WriteError("ERR DISCARD without MULTI")
+		return
+	}
+	c.clearWatch()
+	c.WriteOK()
+}
+
+func handleUnwatch(c *Conn, cmd Command) {
+	c.clearWatch()
+	c.WriteOK()
+}